@@ -0,0 +1,382 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package check provides the function File, which reports the definitions
+// in a parsed file that are syntactically valid but break the rules of the
+// language enforced by protoc, such as invalid or duplicate field numbers.
+//
+// The checks only need the file itself. The ones that depend on the
+// definitions in other files, such as the extension ranges of an extended
+// message, are only done if the file has been linked with package linker.
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/campoy/groto/internal/errlist"
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// An Error describes a definition that breaks a rule of the language.
+type Error = errlist.Error
+
+// An ErrorList is a list of errors, sorted by position.
+type ErrorList = errlist.List
+
+// File checks the definitions in the given file, and returns an ErrorList
+// describing all the problems found, or nil if there are none.
+func File(f *proto.File) error {
+	c := &checker{syntax: f.Syntax.Value}
+	pkg := join(f.Package.Identifier)
+
+	var defs []def
+	for i := range f.Messages {
+		m := &f.Messages[i]
+		defs = append(defs, def{name: m.Name, pos: m.Pos})
+		c.message(pkg, m)
+	}
+	for _, e := range f.Enums {
+		defs = append(defs, def{name: e.Name, pos: e.Pos})
+		defs = append(defs, c.enum(e)...)
+	}
+	for _, s := range f.Services {
+		defs = append(defs, def{name: s.Name, pos: s.Pos})
+		c.service(pkg, s)
+	}
+	for _, e := range f.Extends {
+		defs = append(defs, c.extend(pkg, e)...)
+	}
+	c.unique(pkg, defs)
+
+	c.errs.Sort()
+	return c.errs.Err()
+}
+
+type checker struct {
+	syntax string
+	errs   ErrorList
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.errs.Addf(pos, format, args...)
+}
+
+// A def is a named definition in a scope.
+type def struct {
+	name proto.Identifier
+	pos  token.Position
+	enum proto.Identifier // enum of an enum value.
+	mapf proto.Identifier // map field of a map entry message.
+}
+
+// unique reports the definitions in the given scope that have the same
+// name as a previous one.
+func (c *checker) unique(scope string, defs []def) {
+	sort.SliceStable(defs, func(i, j int) bool { return before(defs[i].pos, defs[j].pos) })
+	seen := map[proto.Identifier]def{}
+	for _, d := range defs {
+		prev, ok := seen[d.name]
+		switch {
+		case !ok:
+			seen[d.name] = d
+		case d.mapf != "" || prev.mapf != "":
+			mapf := d.mapf
+			if mapf == "" {
+				mapf = prev.mapf
+			}
+			c.errorf(d.pos, "%s conflicts with the entry message of map field %s", names.Qualify(scope, string(d.name)), mapf)
+		case d.enum != "" && d.enum != prev.enum:
+			// This is a common source of confusion, so give some context.
+			c.errorf(d.pos, "%s is already defined; enum values are siblings of their enum, not children of it, so %s must be unique within %s, not just within %s",
+				names.Qualify(scope, string(d.name)), d.name, scopeName(scope), d.enum)
+		default:
+			c.errorf(d.pos, "%s is already defined", names.Qualify(scope, string(d.name)))
+		}
+	}
+}
+
+// scopeName returns the name of the given scope for error messages.
+func scopeName(scope string) string {
+	if scope == "" {
+		return "the root scope"
+	}
+	return scope
+}
+
+// A numbered is a field of a message, with its name and number.
+type numbered struct {
+	name   proto.Identifier
+	number int
+	pos    token.Position
+}
+
+// An interval is a range of reserved numbers, or of extension numbers.
+type interval struct {
+	from, to int
+	pos      token.Position
+}
+
+func (r interval) String() string {
+	if r.from == r.to {
+		return fmt.Sprint(r.from)
+	}
+	return fmt.Sprintf("%d to %d", r.from, r.to)
+}
+
+func (r interval) contains(n int) bool { return r.from <= n && n <= r.to }
+
+func (r interval) overlaps(s interval) bool { return r.from <= s.to && s.from <= r.to }
+
+// reserved returns the reserved numbers and names of the given statements.
+func reserved(rs []proto.Reserved) ([]interval, map[string]bool) {
+	var ranges []interval
+	names := map[string]bool{}
+	for _, r := range rs {
+		for _, rng := range r.Ranges {
+			ranges = append(ranges, interval{rng.From, rng.To, rng.Pos})
+		}
+		for _, name := range r.Names {
+			names[name] = true
+		}
+	}
+	return ranges, names
+}
+
+// ranges checks that the given ranges are valid and don't overlap, given
+// the kind of numbers they contain, and the smallest and largest numbers.
+func (c *checker) ranges(kind string, ranges []interval, min, max int) {
+	for i, r := range ranges {
+		switch {
+		case r.from < min:
+			if min == 1 {
+				c.errorf(r.pos, "%s numbers must be positive integers", kind)
+			} else {
+				c.errorf(r.pos, "%s numbers must be greater than or equal to %d", kind, min)
+			}
+		case r.to > max:
+			c.errorf(r.pos, "%s numbers cannot be greater than %d", kind, max)
+		case r.to < r.from:
+			c.errorf(r.pos, "%s range end number must be greater than start number", kind)
+		}
+		for _, prev := range ranges[:i] {
+			if r.overlaps(prev) {
+				c.errorf(r.pos, "%s range %v overlaps with already-defined range %v", kind, r, prev)
+				break
+			}
+		}
+	}
+}
+
+// number checks that a field number is valid, given the largest one.
+func (c *checker) number(f numbered, max int) {
+	switch {
+	case f.number < 1:
+		c.errorf(f.pos, "field numbers must be positive integers")
+	case f.number > max:
+		c.errorf(f.pos, "field numbers cannot be greater than %d", max)
+	case 19000 <= f.number && f.number <= 19999:
+		c.errorf(f.pos, "field numbers 19000 through 19999 are reserved for the protocol buffer library implementation")
+	}
+}
+
+func (c *checker) message(scope string, m *proto.Message) {
+	full := names.Qualify(scope, string(m.Name))
+	c.noMapEntry(m.Options)
+
+	var fields []numbered
+	var defs []def
+	for _, f := range m.Fields {
+		fields = append(fields, numbered{f.Name, f.Number, f.Pos})
+		defs = append(defs, def{name: f.Name, pos: f.Pos})
+		c.noDefault(f.Options)
+		if f.Group != nil {
+			defs = append(defs, def{name: f.Group.Name, pos: f.Group.Pos})
+			c.message(full, f.Group)
+		}
+	}
+	for _, f := range m.Maps {
+		fields = append(fields, numbered{f.Name, f.Number, f.Pos})
+		defs = append(defs, def{name: f.Name, pos: f.Pos})
+		defs = append(defs, def{name: f.EntryName(), pos: f.Pos, mapf: f.Name})
+		c.mapTypes(f)
+	}
+	for _, o := range m.OneOfs {
+		defs = append(defs, def{name: o.Name, pos: o.Pos})
+		if len(o.Fields) == 0 {
+			c.errorf(o.Pos, "oneof %s must contain at least one field", o.Name)
+		}
+		for _, f := range o.Fields {
+			fields = append(fields, numbered{f.Name, f.Number, f.Pos})
+			defs = append(defs, def{name: f.Name, pos: f.Pos})
+			c.noDefault(f.Options)
+			if f.Group != nil {
+				defs = append(defs, def{name: f.Group.Name, pos: f.Group.Pos})
+				c.message(full, f.Group)
+			}
+		}
+	}
+	for i := range m.Messages {
+		n := &m.Messages[i]
+		defs = append(defs, def{name: n.Name, pos: n.Pos})
+		c.message(full, n)
+	}
+	for _, e := range m.Enums {
+		defs = append(defs, def{name: e.Name, pos: e.Pos})
+		defs = append(defs, c.enum(e)...)
+	}
+	for _, e := range m.Extends {
+		defs = append(defs, c.extend(full, e)...)
+	}
+	c.unique(full, defs)
+
+	sort.SliceStable(fields, func(i, j int) bool { return before(fields[i].pos, fields[j].pos) })
+	reservedRanges, reservedNames := reserved(m.Reserveds)
+	var extensions []interval
+	for _, e := range m.Extensions {
+		for _, r := range e.Ranges {
+			extensions = append(extensions, interval{r.From, r.To, r.Pos})
+		}
+	}
+	maxExtension := proto.MaxFieldNumber
+	if m.MessageSetWireFormat() {
+		maxExtension = proto.MaxMessageSetNumber
+	}
+	c.ranges("reserved", reservedRanges, 1, proto.MaxFieldNumber)
+	c.ranges("extension", extensions, 1, maxExtension)
+	for _, e := range extensions {
+		for _, r := range reservedRanges {
+			if e.overlaps(r) {
+				c.errorf(e.pos, "extension range %v overlaps with reserved range %v", e, r)
+			}
+		}
+		for _, f := range fields {
+			if e.contains(f.number) {
+				c.errorf(e.pos, "extension range %v includes field %s (%d)", e, f.name, f.number)
+			}
+		}
+	}
+
+	c.jsonNames(fields)
+	used := map[int]proto.Identifier{}
+	for _, f := range fields {
+		c.number(f, proto.MaxFieldNumber)
+		if prev, ok := used[f.number]; ok {
+			c.errorf(f.pos, "field number %d has already been used in %s by field %s", f.number, full, prev)
+		} else {
+			used[f.number] = f.name
+		}
+		for _, r := range reservedRanges {
+			if r.contains(f.number) {
+				c.errorf(f.pos, "field %s uses reserved number %d", f.name, f.number)
+				break
+			}
+		}
+		if reservedNames[string(f.name)] {
+			c.errorf(f.pos, "field name %s is reserved", f.name)
+		}
+	}
+}
+
+// extend checks the fields of an extend block, and returns their definitions,
+// which belong to the scope where the block is.
+func (c *checker) extend(scope string, e proto.Extend) []def {
+	c.extendee(e)
+	// The extensions of message sets can use larger numbers, and the
+	// ranges of their extension numbers ending in max include them.
+	target := e.Type.Target
+	max := proto.MaxFieldNumber
+	if target != nil && target.Message != nil && target.Message.MessageSetWireFormat() {
+		max = proto.MaxMessageSetNumber
+	}
+	var defs []def
+	for _, f := range e.Fields {
+		defs = append(defs, def{name: f.Name, pos: f.Pos})
+		c.noDefault(f.Options)
+		if f.Group != nil {
+			defs = append(defs, def{name: f.Group.Name, pos: f.Group.Pos})
+			c.message(scope, f.Group)
+		}
+		c.number(numbered{f.Name, f.Number, f.Pos}, max)
+
+		if target == nil || target.Message == nil {
+			continue
+		}
+		declared := false
+		for _, ext := range target.Message.Extensions {
+			for _, r := range ext.Ranges {
+				to := r.To
+				if to == proto.MaxFieldNumber {
+					to = max
+				}
+				declared = declared || r.From <= f.Number && f.Number <= to
+			}
+		}
+		if !declared {
+			c.errorf(f.Pos, "%s does not declare %d as an extension number", target.FullName, f.Number)
+		}
+	}
+	return defs
+}
+
+// service checks that the methods of a service have different names.
+func (c *checker) service(scope string, s proto.Service) {
+	var defs []def
+	for _, rpc := range s.RPCs {
+		defs = append(defs, def{name: rpc.Name, pos: rpc.Pos})
+	}
+	c.unique(names.Qualify(scope, string(s.Name)), defs)
+}
+
+// enum checks an enum, and returns the definitions of its values, which
+// belong to the scope where the enum is, as in C++.
+func (c *checker) enum(e proto.Enum) []def {
+	var defs []def
+	for _, f := range e.Fields {
+		defs = append(defs, def{name: f.Name, pos: f.Pos, enum: e.Name})
+	}
+	if len(e.Fields) == 0 {
+		c.errorf(e.Pos, "enum %s must contain at least one value", e.Name)
+	}
+	c.firstEnumValue(e)
+	ranges, names := reserved(e.Reserveds)
+	c.ranges("reserved", ranges, -1<<31, proto.MaxEnumNumber)
+	for _, f := range e.Fields {
+		for _, r := range ranges {
+			if r.contains(f.Number) {
+				c.errorf(f.Pos, "enum value %s uses reserved number %d", f.Name, f.Number)
+				break
+			}
+		}
+		if names[string(f.Name)] {
+			c.errorf(f.Pos, "enum value %s is reserved", f.Name)
+		}
+	}
+	return defs
+}
+
+// before returns true if the position a is before b, in the same file.
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+func join(ids []proto.Identifier) string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, string(id))
+	}
+	return strings.Join(s, ".")
+}
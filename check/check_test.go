@@ -0,0 +1,275 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/campoy/groto/linker"
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+)
+
+func parse(t *testing.T, src string) *proto.File {
+	t.Helper()
+	f, err := parser.Parse(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("could not parse: %v\n%s", err, src)
+	}
+	return f
+}
+
+// errs returns the messages of the errors returned by File, with their
+// positions.
+func errs(t *testing.T, f *proto.File) []string {
+	t.Helper()
+	err := File(f)
+	if err == nil {
+		return nil
+	}
+	var list ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("expected an ErrorList, got %v", err)
+	}
+	var res []string
+	for _, e := range list {
+		res = append(res, e.Error())
+	}
+	return res
+}
+
+type checkTest struct {
+	name string
+	in   string
+	errs []string
+}
+
+func runTests(t *testing.T, tests []checkTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := errs(t, parse(t, tt.in))
+			if !reflect.DeepEqual(got, tt.errs) {
+				t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(tt.errs, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestFile(t *testing.T) {
+	runTests(t, []checkTest{
+		{"valid", `
+			syntax = "proto2";
+			package foo;
+			message A {
+				optional int32 a = 1;
+				repeated group G = 2 { optional int32 a = 1; }
+				map<string, int32> m = 3;
+				oneof o { string s = 4; }
+				reserved 5, 6 to 10;
+				reserved "b";
+				extensions 20 to 100, 1000 to max;
+				extend A { optional int32 ext = 20; }
+				message B {}
+				enum E { X = 0; }
+			}
+			enum E { X = 0; reserved -5 to -1, 1; reserved "Y"; }
+			service S {}
+			extend A { optional int32 ext = 1000; }`,
+			nil,
+		},
+		{"field numbers", `
+			syntax = "proto3";
+			message A {
+				int32 a = 0;
+				int32 b = 19000;
+				int32 c = 19999;
+				int32 d = 536870912;
+				map<string, int32> e = 536870911;
+				oneof o { int32 f = 2147483647; }
+			}`,
+			[]string{
+				"4:5: field numbers must be positive integers",
+				"5:5: field numbers 19000 through 19999 are reserved for the protocol buffer library implementation",
+				"6:5: field numbers 19000 through 19999 are reserved for the protocol buffer library implementation",
+				"7:5: field numbers cannot be greater than 536870911",
+				"9:15: field numbers cannot be greater than 536870911",
+			},
+		},
+		{"duplicate numbers", `
+			syntax = "proto3";
+			package foo;
+			message A {
+				int32 a = 1;
+				map<string, int32> m = 1;
+				oneof o { string s = 2; }
+				int32 b = 2;
+			}`,
+			[]string{
+				"6:5: field number 1 has already been used in foo.A by field a",
+				"8:5: field number 2 has already been used in foo.A by field s",
+			},
+		},
+		{"reserved", `
+			syntax = "proto3";
+			message A {
+				reserved 2, 10 to max;
+				reserved "b", "c";
+				int32 a = 2;
+				int32 b = 3;
+				map<string, int32> c = 20;
+			}`,
+			[]string{
+				"6:5: field a uses reserved number 2",
+				"7:5: field name b is reserved",
+				"8:5: field c uses reserved number 20",
+				"8:5: field name c is reserved",
+			},
+		},
+		{"ranges", `
+			syntax = "proto2";
+			message A {
+				optional int32 a = 15;
+				reserved 0, 5 to 1, 2 to 3;
+				reserved 3;
+				extensions 10 to 20, 20, 3;
+			}`,
+			[]string{
+				"5:14: reserved numbers must be positive integers",
+				"5:17: reserved range end number must be greater than start number",
+				"6:14: reserved range 3 overlaps with already-defined range 2 to 3",
+				"7:16: extension range 10 to 20 includes field a (15)",
+				"7:26: extension range 20 overlaps with already-defined range 10 to 20",
+				"7:30: extension range 3 overlaps with reserved range 2 to 3",
+				"7:30: extension range 3 overlaps with reserved range 3",
+			},
+		},
+		{"enums", `
+			syntax = "proto3";
+			enum A {}
+			enum B {
+				reserved 1 to 3, 2;
+				reserved "Y";
+				X = 0;
+				Y = 3;
+			}`,
+			[]string{
+				"3:4: enum A must contain at least one value",
+				"5:22: reserved range 2 overlaps with already-defined range 1 to 3",
+				"8:5: enum value Y uses reserved number 3",
+				"8:5: enum value Y is reserved",
+			},
+		},
+		{"groups in oneofs", `
+			syntax = "proto2";
+			message A {
+				optional int32 a = 1;
+				oneof o {
+					group G = 1 { optional int32 x = 1; optional int32 x = 2; }
+				}
+				message G {}
+			}`,
+			[]string{
+				"6:6: field number 1 has already been used in A by field a",
+				"6:42: A.G.x is already defined",
+				"8:5: A.G is already defined",
+			},
+		},
+		{"names", `
+			syntax = "proto2";
+			package foo;
+			message A {
+				optional int32 a = 1;
+				map<string, int32> a = 2;
+				oneof a { int32 b = 3; }
+				optional int32 b = 4;
+				message B {}
+				optional group B = 5 {}
+				enum a { X = 0; }
+				extend A { optional int32 b = 100; }
+				extensions 100;
+			}
+			message A {}
+			enum A { X = 0; }
+			service A {}
+			extend foo.A { optional int32 A = 101; }`,
+			[]string{
+				"6:5: foo.A.a is already defined",
+				"7:5: foo.A.a is already defined",
+				"8:5: foo.A.b is already defined",
+				"10:5: foo.A.b is already defined",
+				"10:5: foo.A.B is already defined",
+				"11:5: foo.A.a is already defined",
+				"12:16: foo.A.b is already defined",
+				"15:4: foo.A is already defined",
+				"16:4: foo.A is already defined",
+				"17:4: foo.A is already defined",
+				"18:19: foo.A is already defined",
+			},
+		},
+		{"empty oneof", `
+			syntax = "proto3";
+			message A { oneof o {} }`,
+			[]string{"3:16: oneof o must contain at least one field"},
+		},
+		{"message sets", `
+			syntax = "proto2";
+			message Set {
+				option message_set_wire_format = true;
+				extensions 4 to 2147483646;
+			}
+			message A { extensions 4 to 2147483646; }`,
+			[]string{"7:27: extension numbers cannot be greater than 536870911"},
+		},
+		{"methods", `
+			syntax = "proto3";
+			package foo;
+			message M {}
+			service S {
+				rpc Get(M) returns (M);
+				rpc Put(M) returns (M);
+				rpc Get(M) returns (stream M);
+			}
+			service T { rpc Get(M) returns (M); }`,
+			[]string{"8:5: foo.S.Get is already defined"},
+		},
+	})
+}
+
+func TestFileLinked(t *testing.T) {
+	f := parse(t, `
+		syntax = "proto2";
+		message A { extensions 10 to 20; }
+		message B {}
+		extend A { optional int32 a = 10; optional int32 b = 21; }
+		extend B { optional int32 c = 1; }
+		message Set { option message_set_wire_format = true; extensions 4 to max; }
+		extend Set { optional B d = 2147483646; }
+		extend A { optional B e = 2147483646; }`)
+	if err := linker.Link(map[string]*proto.File{"a.proto": f}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"5:37: A does not declare 21 as an extension number",
+		"6:14: B does not declare 1 as an extension number",
+		"9:14: field numbers cannot be greater than 536870911",
+		"9:14: A does not declare 2147483646 as an extension number",
+	}
+	if got := errs(t, f); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import "github.com/campoy/groto/proto"
+
+// The parser only accepts valid key types, and reports maps used as map
+// values, in oneofs, or with labels, but maps can also be built by hand.
+// The name of the entry message of a map field, see proto.Map.Entry, must
+// not be used by other definitions in the message containing the field.
+
+// mapTypes checks the key and value types of a map field.
+func (c *checker) mapTypes(m proto.Map) {
+	switch key := m.KeyType; {
+	case key.Predefined == proto.TypeInvalid && key.Target != nil && key.Target.Enum != nil:
+		c.errorf(key.Pos, "key in map fields cannot be enum types")
+	case key.Predefined == proto.TypeInvalid, key.Predefined == proto.TypeFloat,
+		key.Predefined == proto.TypeDouble, key.Predefined == proto.TypeBytes:
+		c.errorf(key.Pos, "key in map fields cannot be float/double, bytes or message types")
+	}
+}
+
+// noMapEntry checks that the option map_entry is not set in the options of
+// a message, as only the entry messages of map fields can have it.
+func (c *checker) noMapEntry(opts []proto.Option) {
+	for _, opt := range opts {
+		if opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == "map_entry" {
+			c.errorf(opt.Pos, "map_entry should not be set explicitly, use map<KeyType, ValueType> instead")
+		}
+	}
+}
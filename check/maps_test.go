@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/campoy/groto/linker"
+	"github.com/campoy/groto/proto"
+)
+
+func TestMaps(t *testing.T) {
+	runTests(t, []checkTest{
+		{"entry names", `
+			syntax = "proto3";
+			package foo;
+			message M {
+				map<string, int32> foo_bar = 1;
+				message FooBarEntry {}
+				message BarEntry {}
+				map<int64, string> bar = 2;
+				map<int64, string> fooBar = 3;
+			}`,
+			[]string{
+				"6:5: foo.M.FooBarEntry conflicts with the entry message of map field foo_bar",
+				"8:5: foo.M.BarEntry conflicts with the entry message of map field bar",
+				"9:5: foo.M.FooBarEntry conflicts with the entry message of map field fooBar",
+				"9:5: the JSON name fooBar of field fooBar conflicts with field foo_bar",
+			},
+		},
+		{"explicit map entry", `
+			syntax = "proto2";
+			message M {
+				option map_entry = true;
+				optional string key = 1;
+				optional string value = 2;
+			}`,
+			[]string{"4:5: map_entry should not be set explicitly, use map<KeyType, ValueType> instead"},
+		},
+	})
+}
+
+func TestMapKeyTypes(t *testing.T) {
+	f := parse(t, `
+		syntax = "proto3";
+		enum E { X = 0; }
+		message M {}
+		message A {
+			map<string, int32> a = 1;
+			map<string, int32> b = 2;
+			map<string, int32> c = 3;
+			map<string, int32> d = 4;
+		}`)
+	maps := f.Messages[1].Maps
+	maps[0].KeyType = proto.Type{Span: maps[0].KeyType.Span, Predefined: proto.TypeBytes}
+	maps[1].KeyType = proto.Type{Span: maps[1].KeyType.Span, Predefined: proto.TypeDouble}
+	maps[2].KeyType = proto.Type{Span: maps[2].KeyType.Span, UserDefined: []proto.Identifier{"E"}}
+	maps[3].KeyType = proto.Type{Span: maps[3].KeyType.Span, UserDefined: []proto.Identifier{"M"}}
+	if err := linker.Link(map[string]*proto.File{"a.proto": f}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"6:8: key in map fields cannot be float/double, bytes or message types",
+		"7:8: key in map fields cannot be float/double, bytes or message types",
+		"8:8: key in map fields cannot be enum types",
+		"9:8: key in map fields cannot be float/double, bytes or message types",
+	}
+	if got := errs(t, f); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"strings"
+
+	"github.com/campoy/groto/proto"
+)
+
+// The rules in this file only apply to proto3 files. The parser already
+// reports the constructs that proto3 doesn't support at all, such as
+// required fields, groups, and extension ranges.
+
+// firstEnumValue checks that the first value of an enum is zero, as it is
+// used as the default value of the fields of the enum type.
+func (c *checker) firstEnumValue(e proto.Enum) {
+	if c.syntax == proto.Proto3 && len(e.Fields) > 0 && e.Fields[0].Number != 0 {
+		c.errorf(e.Fields[0].Pos, "the first enum value must be zero in proto3")
+	}
+}
+
+// noDefault checks that the given field options don't set a default value.
+func (c *checker) noDefault(opts []proto.Option) {
+	if c.syntax != proto.Proto3 {
+		return
+	}
+	for _, opt := range opts {
+		if opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == "default" {
+			c.errorf(opt.Pos, "explicit default values are not allowed in proto3")
+		}
+	}
+}
+
+// jsonNames checks that the given fields of a message have different JSON
+// names, as protoc requires in proto3.
+func (c *checker) jsonNames(fields []numbered) {
+	if c.syntax != proto.Proto3 {
+		return
+	}
+	seen := map[string]proto.Identifier{}
+	for _, f := range fields {
+		json := proto.JSONName(string(f.name))
+		if prev, ok := seen[json]; ok && prev != f.name {
+			c.errorf(f.pos, "the JSON name %s of field %s conflicts with field %s", json, f.name, prev)
+			continue
+		}
+		seen[json] = f.name
+	}
+}
+
+// extendee checks that an extended message is one of the options defined in
+// google/protobuf/descriptor.proto, as custom options are the only
+// extensions allowed in proto3. This is only checked in linked files.
+func (c *checker) extendee(e proto.Extend) {
+	t := e.Type.Target
+	if c.syntax != proto.Proto3 || t == nil {
+		return
+	}
+	name := strings.TrimPrefix(t.FullName, "google.protobuf.")
+	if name == t.FullName || !strings.HasSuffix(name, "Options") || strings.Contains(name, ".") {
+		c.errorf(e.Type.Pos, "extensions in proto3 are only allowed for defining options")
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package check
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/campoy/groto/linker"
+	"github.com/campoy/groto/proto"
+)
+
+func TestProto3(t *testing.T) {
+	runTests(t, []checkTest{
+		{"first enum value", `
+			syntax = "proto3";
+			enum A { X = 1; Y = 0; }
+			message M { enum B { Z = 0; W = 1; } }`,
+			[]string{"3:13: the first enum value must be zero in proto3"},
+		},
+		{"first enum value in proto2", `
+			syntax = "proto2";
+			enum A { X = 1; }`,
+			nil,
+		},
+		{"defaults", `
+			syntax = "proto3";
+			message M {
+				int32 a = 1 [default = 1];
+				oneof o { string b = 2 [deprecated = true, default = "b"]; }
+			}`,
+			[]string{
+				"4:18: explicit default values are not allowed in proto3",
+				"5:48: explicit default values are not allowed in proto3",
+			},
+		},
+		{"defaults in proto2", `
+			syntax = "proto2";
+			message M { optional int32 a = 1 [default = 1]; }`,
+			nil,
+		},
+	})
+}
+
+func TestEnumValueScope(t *testing.T) {
+	runTests(t, []checkTest{
+		{"sibling enums", `
+			syntax = "proto3";
+			package foo;
+			enum A { UNKNOWN = 0; X = 1; }
+			enum B { UNKNOWN = 0; }
+			message M {
+				enum C { UNKNOWN = 0; }
+				enum D { UNKNOWN = 0; }
+			}`,
+			[]string{
+				"5:13: foo.UNKNOWN is already defined; enum values are siblings of their enum, not children of it, so UNKNOWN must be unique within foo, not just within B",
+				"8:14: foo.M.UNKNOWN is already defined; enum values are siblings of their enum, not children of it, so UNKNOWN must be unique within foo.M, not just within D",
+			},
+		},
+		{"other definitions", `
+			syntax = "proto2";
+			enum A { X = 0; M = 1; }
+			message X {}
+			message M { optional int32 a = 1; enum B { a = 0; } }`,
+			[]string{
+				"4:4: X is already defined",
+				"5:4: M is already defined",
+				"5:47: M.a is already defined; enum values are siblings of their enum, not children of it, so a must be unique within M, not just within B",
+			},
+		},
+		{"same enum", `
+			syntax = "proto3";
+			enum A { X = 0; X = 1; }`,
+			[]string{"3:20: X is already defined"},
+		},
+	})
+}
+
+func TestJSONNames(t *testing.T) {
+	runTests(t, []checkTest{
+		{"proto3", `
+			syntax = "proto3";
+			message M {
+				int32 foo_bar = 1;
+				map<string, int32> fooBar = 2;
+				oneof o { string FooBar = 3; string foo_bar2 = 4; }
+				int32 foo_bar_2 = 5;
+			}`,
+			[]string{
+				"5:5: the JSON name fooBar of field fooBar conflicts with field foo_bar",
+				"7:5: the JSON name fooBar2 of field foo_bar_2 conflicts with field foo_bar2",
+			},
+		},
+		{"proto2", `
+			syntax = "proto2";
+			message M {
+				optional int32 foo_bar = 1;
+				optional int32 fooBar = 2;
+			}`,
+			nil,
+		},
+	})
+}
+
+func TestProto3Extensions(t *testing.T) {
+	f := parse(t, `
+		syntax = "proto3";
+		import "google/protobuf/descriptor.proto";
+		message M {}
+		extend google.protobuf.FieldOptions { int32 a = 50000; }
+		extend M { int32 b = 1; }
+		extend google.protobuf.FileDescriptorProto { int32 c = 2; }`)
+	desc := parse(t, `
+		syntax = "proto2";
+		package google.protobuf;
+		message FieldOptions { extensions 1000 to max; }
+		message FileDescriptorProto { extensions 1 to 10; }`)
+	files := map[string]*proto.File{"a.proto": f, "google/protobuf/descriptor.proto": desc}
+	if err := linker.Link(files); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"6:10: extensions in proto3 are only allowed for defining options",
+		"6:14: M does not declare 1 as an extension number",
+		"7:10: extensions in proto3 are only allowed for defining options",
+	}
+	if got := errs(t, f); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
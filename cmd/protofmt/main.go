@@ -0,0 +1,189 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Protofmt formats .proto files, as gofmt does for Go files.
+//
+// Without an explicit path, it processes the standard input. Given a file,
+// it operates on that file; given a directory, it operates on all .proto
+// files in that directory, recursively. By default, protofmt prints the
+// reformatted sources to standard output.
+//
+// Usage:
+//
+//	protofmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different than protofmt's, print diffs
+//		to standard output.
+//	-l
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from protofmt's, print its name
+//		to standard output.
+//	-w
+//		Do not print reformatted sources to standard output.
+//		If a file's formatting is different from protofmt's, overwrite it
+//		with protofmt's version.
+//
+// The formatting is the one of package printer, which keeps comments.
+// Files with syntax errors are reported and left untouched, and protofmt
+// exits with status 2.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/printer"
+)
+
+var (
+	list   = flag.Bool("l", false, "list files whose formatting differs from protofmt's")
+	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: protofmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run processes the given paths, or the standard input if there are none,
+// reporting errors to stderr. It returns the exit status.
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	status := 0
+	report := func(err error) {
+		var errs parser.ErrorList
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				fmt.Fprintln(stderr, e)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		status = 2
+	}
+
+	if len(paths) == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "error: cannot use -w with standard input")
+			return 2
+		}
+		if err := processFile("<standard input>", stdin, stdout, true); err != nil {
+			report(err)
+		}
+		return status
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			report(err)
+		case info.IsDir():
+			err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && strings.HasSuffix(path, ".proto") {
+					err = processFile(path, nil, stdout, false)
+				}
+				if err != nil {
+					report(err)
+				}
+				return nil
+			})
+			if err != nil {
+				report(err)
+			}
+		default:
+			if err := processFile(path, nil, stdout, false); err != nil {
+				report(err)
+			}
+		}
+	}
+	return status
+}
+
+// processFile formats the file with the given name, whose contents are read
+// from in if not nil, and writes the result to out, or lists, diffs or
+// rewrites the file depending on the flags.
+func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error {
+	var perm fs.FileMode = 0644
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		in, perm = f, info.Mode().Perm()
+	}
+
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	res, err := format(filename, src)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(src, res) {
+		if *list {
+			fmt.Fprintln(out, filename)
+		}
+		if *write {
+			if err := os.WriteFile(filename, res, perm); err != nil {
+				return err
+			}
+		}
+		if *doDiff {
+			fmt.Fprintf(out, "diff -u %s.orig %s\n", filename, filename)
+			diff(out, filename+".orig", filename, string(src), string(res))
+		}
+	}
+	if !*list && !*write && !*doDiff {
+		_, err = out.Write(res)
+	}
+	return err
+}
+
+// format returns the formatted version of the given source.
+func format(filename string, src []byte) ([]byte, error) {
+	f, err := parser.ParseFile(filename, bytes.NewReader(src), parser.Recover)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
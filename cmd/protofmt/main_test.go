@@ -0,0 +1,172 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	unformatted = "syntax=\"proto3\";\nmessage Foo{string a=1;}\n"
+	formatted   = "syntax = \"proto3\";\nmessage Foo {\n  string a = 1;\n}\n"
+)
+
+// setFlags sets the flags for the duration of a test.
+func setFlags(t *testing.T, l, w, d bool) {
+	old := []bool{*list, *write, *doDiff}
+	*list, *write, *doDiff = l, w, d
+	t.Cleanup(func() { *list, *write, *doDiff = old[0], old[1], old[2] })
+}
+
+func TestStdin(t *testing.T) {
+	setFlags(t, false, false, false)
+	var stdout, stderr bytes.Buffer
+	if status := run(nil, strings.NewReader(unformatted), &stdout, &stderr); status != 0 {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+	if got := stdout.String(); got != formatted {
+		t.Errorf("expected output:\n%s\ngot:\n%s", formatted, got)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.proto")
+	b := filepath.Join(dir, "sub", "b.proto")
+	if err := os.MkdirAll(filepath.Dir(b), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{a: unformatted, b: formatted, filepath.Join(dir, "c.txt"): unformatted} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		l, w, d bool
+		out     string
+	}{
+		{"list", true, false, false, a + "\n"},
+		{"diff", false, false, true, "diff -u " + a + ".orig " + a + "\n" +
+			"--- " + a + ".orig\n" +
+			"+++ " + a + "\n" +
+			"@@ -1,2 +1,4 @@\n" +
+			"-syntax=\"proto3\";\n" +
+			"-message Foo{string a=1;}\n" +
+			"+syntax = \"proto3\";\n" +
+			"+message Foo {\n" +
+			"+  string a = 1;\n" +
+			"+}\n"},
+		{"write and list", true, true, false, a + "\n"},
+		{"nothing left to do", true, false, false, ""},
+	}
+	for _, tt := range tests {
+		setFlags(t, tt.l, tt.w, tt.d)
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{dir}, nil, &stdout, &stderr); status != 0 {
+			t.Fatalf("%s: unexpected status %d: %s", tt.name, status, stderr.String())
+		}
+		if got := stdout.String(); got != tt.out {
+			t.Errorf("%s: expected output:\n%s\ngot:\n%s", tt.name, tt.out, got)
+		}
+	}
+
+	got, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != formatted {
+		t.Errorf("expected a.proto to be rewritten as:\n%s\ngot:\n%s", formatted, got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	setFlags(t, false, false, false)
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.proto")
+	src := "syntax = \"proto3\";\nmessage Foo {\n  string = 1;\n  int32 b 2;\n}\n"
+	if err := os.WriteFile(bad, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{bad, filepath.Join(dir, "missing.proto")}, nil, &stdout, &stderr); status != 2 {
+		t.Errorf("expected status 2, got %d", status)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 errors, got:\n%s", stderr.String())
+	}
+	for i, prefix := range []string{bad + ":3:10: ", bad + ":4:11: ", "stat " + filepath.Join(dir, "missing.proto")} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected error starting with %q, got %q", prefix, lines[i])
+		}
+	}
+	if stdout.Len() > 0 {
+		t.Errorf("expected no output, got:\n%s", stdout.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		out      string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n", `--- old
++++ new
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`},
+		{"merged hunks", "a\nb\nc\nd\ne\nf\ng\n", "a\nB\nc\nd\ne\nF\ng\n", `--- old
++++ new
+@@ -1,7 +1,7 @@
+ a
+-b
++B
+ c
+ d
+ e
+-f
++F
+ g
+`},
+		{"from empty", "", "a\n", "--- old\n+++ new\n@@ -0,0 +1,1 @@\n+a\n"},
+		{"no newline", "a", "a\n", "--- old\n+++ new\n@@ -1,1 +1,1 @@\n-a\n\\ No newline at end of file\n+a\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		diff(&buf, "old", "new", tt.old, tt.new)
+		if got := buf.String(); got != tt.out {
+			t.Errorf("%s: expected diff:\n%s\ngot:\n%s", tt.name, tt.out, got)
+		}
+	}
+}
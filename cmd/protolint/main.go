@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Protolint checks that .proto files follow the conventions of the Protocol
+// Buffers style guide, with the rules of package lint.
+//
+// Without an explicit path, it processes the standard input. Given a file,
+// it operates on that file; given a directory, it operates on all .proto
+// files in that directory, recursively. The problems found are printed to
+// standard output, one per line, followed by the name of the rule.
+//
+// Usage:
+//
+//	protolint [flags] [path ...]
+//
+// The flags are:
+//
+//	-enable RULE,...
+//		Only check the given rules, instead of all of them.
+//	-disable RULE,...
+//		Do not check the given rules.
+//	-list
+//		Print the available rules with their description, and exit.
+//	-fix
+//		Fix the problems that can be fixed automatically, rewriting the
+//		files with minimal edits, and only print the remaining problems.
+//
+// Problems can also be suppressed with comments in the linted files, as
+// described in package lint.
+//
+// Protolint exits with status 1 if it finds any problems, and with status 2
+// if a file could not be read or parsed.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/campoy/groto/lint"
+	"github.com/campoy/groto/parser"
+)
+
+var (
+	enable  = flag.String("enable", "", "comma separated list of the only rules to check")
+	disable = flag.String("disable", "", "comma separated list of rules not to check")
+	list    = flag.Bool("list", false, "list the available rules and exit")
+	fix     = flag.Bool("fix", false, "rewrite files fixing the problems found, when possible")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: protolint [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	os.Exit(run(flag.Args(), os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run lints the given paths, or the standard input if there are none,
+// reporting errors to stderr. It returns the exit status.
+func run(paths []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if *list {
+		for _, r := range lint.Rules() {
+			fmt.Fprintf(stdout, "%s\t%s\n", r.Name, r.Doc)
+		}
+		return 0
+	}
+
+	rules, err := lint.Select(split(*enable), split(*disable))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	status := 0
+	report := func(err error) {
+		var errs parser.ErrorList
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				fmt.Fprintln(stderr, e)
+			}
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		status = 2
+	}
+	process := func(filename string, in io.Reader) {
+		found, err := processFile(filename, in, stdout, rules)
+		if err != nil {
+			report(err)
+		} else if found && status == 0 {
+			status = 1
+		}
+	}
+
+	if len(paths) == 0 {
+		if *fix {
+			fmt.Fprintln(stderr, "error: cannot use -fix with standard input")
+			return 2
+		}
+		process("<standard input>", stdin)
+		return status
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		switch {
+		case err != nil:
+			report(err)
+		case info.IsDir():
+			err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					report(err)
+				} else if !d.IsDir() && strings.HasSuffix(path, ".proto") {
+					process(path, nil)
+				}
+				return nil
+			})
+			if err != nil {
+				report(err)
+			}
+		default:
+			process(path, nil)
+		}
+	}
+	return status
+}
+
+// processFile lints the file with the given name, whose contents are read
+// from in if not nil, and prints the problems found to out, or fixes them
+// and prints the remaining ones if the -fix flag is set. It returns whether
+// any problems were printed.
+func processFile(filename string, in io.Reader, out io.Writer, rules []*lint.Rule) (bool, error) {
+	var perm fs.FileMode = 0644
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return false, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return false, err
+		}
+		in, perm = f, info.Mode().Perm()
+	}
+
+	src, err := io.ReadAll(in)
+	if err != nil {
+		return false, err
+	}
+	var problems []lint.Problem
+	if *fix {
+		var res []byte
+		res, problems, err = lint.Fix(filename, src, rules)
+		if err == nil && !bytes.Equal(src, res) {
+			err = os.WriteFile(filename, res, perm)
+		}
+	} else {
+		problems, err = lint.Lint(filename, src, rules)
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, p := range problems {
+		fmt.Fprintln(out, p)
+	}
+	return len(problems) > 0, nil
+}
+
+// split returns the elements of a comma separated list, ignoring spaces
+// around them and empty ones.
+func split(s string) []string {
+	var res []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const src = `syntax = "proto3";
+package foo;
+
+// Foo is documented.
+message Foo {
+  string fooBar = 1;
+}
+`
+
+// setFlags sets the flags for the duration of a test.
+func setFlags(t *testing.T, e, d string, l, f bool) {
+	oldEnable, oldDisable, oldList, oldFix := *enable, *disable, *list, *fix
+	*enable, *disable, *list, *fix = e, d, l, f
+	t.Cleanup(func() { *enable, *disable, *list, *fix = oldEnable, oldDisable, oldList, oldFix })
+}
+
+func TestStdin(t *testing.T) {
+	setFlags(t, "", "", false, false)
+	var stdout, stderr bytes.Buffer
+	if status := run(nil, strings.NewReader(src), &stdout, &stderr); status != 1 {
+		t.Fatalf("expected status 1, got %d: %s", status, stderr.String())
+	}
+	want := "<standard input>:6:3: field name fooBar must be lower_snake_case, such as foo_bar (FIELD_NAMES_LOWER_SNAKE_CASE)\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "foo", "a.proto")
+	b := filepath.Join(dir, "b.proto")
+	if err := os.MkdirAll(filepath.Dir(a), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{a, b, filepath.Join(dir, "c.txt")} {
+		if err := os.WriteFile(name, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fieldA := a + ":6:3: field name fooBar must be lower_snake_case, such as foo_bar (FIELD_NAMES_LOWER_SNAKE_CASE)\n"
+	fieldB := b + ":6:3: field name fooBar must be lower_snake_case, such as foo_bar (FIELD_NAMES_LOWER_SNAKE_CASE)\n"
+	pkgB := b + ":2:1: package foo must be in a directory named foo, found in " + filepath.ToSlash(dir) + " (PACKAGE_DIRECTORY_MATCH)\n"
+	tests := []struct {
+		name            string
+		enable, disable string
+		status          int
+		out             string
+	}{
+		{"all", "", "", 1, pkgB + fieldB + fieldA},
+		{"enable", "PACKAGE_DIRECTORY_MATCH, MESSAGES_HAVE_COMMENT", "", 1, pkgB},
+		{"disable", "", "PACKAGE_DIRECTORY_MATCH,FIELD_NAMES_LOWER_SNAKE_CASE", 0, ""},
+	}
+	for _, tt := range tests {
+		setFlags(t, tt.enable, tt.disable, false, false)
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{dir}, nil, &stdout, &stderr); status != tt.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.name, tt.status, status, stderr.String())
+		}
+		if got := stdout.String(); got != tt.out {
+			t.Errorf("%s: expected output:\n%s\ngot:\n%s", tt.name, tt.out, got)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	setFlags(t, "", "", true, false)
+	var stdout, stderr bytes.Buffer
+	if status := run(nil, nil, &stdout, &stderr); status != 0 {
+		t.Fatalf("unexpected status %d: %s", status, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "FIELD_NAMES_LOWER_SNAKE_CASE\tfield names are lower_snake_case\n") {
+		t.Errorf("expected the list of rules, got:\n%s", stdout.String())
+	}
+}
+
+func TestErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.proto")
+	if err := os.WriteFile(bad, []byte("syntax = \"proto3\";\nmessage {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	setFlags(t, "", "", false, false)
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{bad, filepath.Join(dir, "missing.proto")}, nil, &stdout, &stderr); status != 2 {
+		t.Errorf("expected status 2, got %d", status)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 errors, got:\n%s", stderr.String())
+	}
+	for i, prefix := range []string{bad + ":2:9: ", "stat " + filepath.Join(dir, "missing.proto")} {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("expected error starting with %q, got %q", prefix, lines[i])
+		}
+	}
+
+	setFlags(t, "FOO", "", false, false)
+	stderr.Reset()
+	if status := run([]string{bad}, nil, &stdout, &stderr); status != 2 || stderr.String() != "unknown rule FOO\n" {
+		t.Errorf("expected status 2 and an unknown rule error, got %d: %s", status, stderr.String())
+	}
+}
+
+func TestFix(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "foo", "a.proto")
+	if err := os.MkdirAll(filepath.Dir(a), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(a, []byte(src+"message bar {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	setFlags(t, "", "MESSAGES_HAVE_COMMENT", false, true)
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{dir}, nil, &stdout, &stderr); status != 1 {
+		t.Fatalf("expected status 1, got %d: %s", status, stderr.String())
+	}
+	want := a + ":8:1: message name bar must be UpperCamelCase (MESSAGE_NAMES_UPPER_CAMEL_CASE)\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("expected output:\n%s\ngot:\n%s", want, got)
+	}
+	got, err := os.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(src, "fooBar", "foo_bar", 1) + "message bar {}\n"; string(got) != want {
+		t.Errorf("expected a.proto to be rewritten as:\n%s\ngot:\n%s", want, got)
+	}
+	if info, err := os.Stat(a); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the permissions of a.proto to be kept, got %v", info.Mode())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if status := run(nil, strings.NewReader(src), &stdout, &stderr); status != 2 || stdout.Len() > 0 {
+		t.Errorf("expected status 2 and no output with the standard input, got %d: %s", status, stdout.String())
+	}
+}
@@ -0,0 +1,906 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package desc converts the files parsed by package parser to descriptors,
+// the messages defined in google/protobuf/descriptor.proto that protoc
+// gives to its plugins and most protobuf tooling understands.
+//
+// The descriptors are the same protoc generates for the same input, which
+// are described in the documentation of descriptor.proto:
+// https://github.com/protocolbuffers/protobuf/blob/main/src/google/protobuf/descriptor.proto
+package desc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/campoy/groto/internal/errlist"
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// Options control how a file is converted to a descriptor.
+type Options struct {
+	// Source is the content of the file. If set, the descriptor includes
+	// the SourceCodeInfo that protoc generates with --include_source_info.
+	Source []byte
+
+	// Imports are the descriptors of the files imported by the file, and
+	// of the files they import. Files not found in Imports are looked up
+	// in protoregistry.GlobalFiles, which contains descriptor.proto and
+	// the well-known types.
+	Imports []*descriptorpb.FileDescriptorProto
+}
+
+// An Error describes a problem found while converting a file, such as a
+// reference to an undefined type or an option with a value of the wrong type,
+// at the position of the definition with the problem.
+type Error = errlist.Error
+
+// ToDescriptor returns the descriptor of the given file, named after the
+// file name in its positions.
+//
+// All the names of types are fully qualified, fields have a json_name, map
+// fields have their map entry messages, and proto3 optional fields their
+// synthetic oneofs. Options are interpreted, and custom options are kept
+// as unknown fields of the options messages.
+func ToDescriptor(f *proto.File, opts Options) (fd *descriptorpb.FileDescriptorProto, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			e, ok := rec.(*Error)
+			if !ok {
+				panic(rec)
+			}
+			fd, err = nil, e
+		}
+	}()
+
+	b := &builder{file: f, fd: &descriptorpb.FileDescriptorProto{}}
+	if opts.Source != nil {
+		b.src = newSource(f.Pos.Filename, opts.Source)
+	}
+	b.loadImports(opts.Imports)
+	b.build()
+	b.resolve()
+	b.interpretOptions()
+	if b.src != nil {
+		b.fd.SourceCodeInfo = &descriptorpb.SourceCodeInfo{Location: b.locs}
+	}
+	return b.fd, nil
+}
+
+// A builder builds the descriptor of a file in the same order protoc does,
+// so the locations in SourceCodeInfo are listed in the same order too.
+type builder struct {
+	file *proto.File
+	fd   *descriptorpb.FileDescriptorProto
+	src  *source // nil if the source is not known.
+	locs []*descriptorpb.SourceCodeInfo_Location
+
+	imports *imports
+	syms    symbols
+	refs    []ref                // type references to be resolved once all types are known.
+	sites   []*site              // options to be interpreted once all types are known.
+	counts  map[string]int       // number of times each option has been set.
+	fields  map[string]string    // options set through one of their fields.
+	self    *protoregistry.Files // imported files and this one, built lazily.
+}
+
+func (b *builder) errorf(pos token.Position, format string, args ...interface{}) {
+	panic(&Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// add adds a location with the given path and span, and the given comments
+// if not nil, and returns it so its path can be set later if needed.
+func (b *builder) add(path []int32, span proto.Span, c *proto.Comments) *descriptorpb.SourceCodeInfo_Location {
+	if b.src == nil {
+		return nil
+	}
+	loc := &descriptorpb.SourceCodeInfo_Location{Path: path, Span: b.src.span(span)}
+	if c != nil {
+		if c.LeadingComments != "" {
+			loc.LeadingComments = protobuf.String(c.LeadingComments)
+		}
+		if c.TrailingComment != "" {
+			loc.TrailingComments = protobuf.String(c.TrailingComment)
+		}
+		loc.LeadingDetachedComments = c.LeadingDetachedComments
+	}
+	b.locs = append(b.locs, loc)
+	return loc
+}
+
+// tok returns the span of the token with index i.
+func (b *builder) tok(i int) proto.Span { return b.src.tokens(i, i) }
+
+// A decl is a declaration in a file or block. Declarations are built in
+// the order they appear in the file, whatever their kind.
+type decl struct {
+	pos   token.Position
+	build func()
+}
+
+func build(decls []decl) {
+	sort.SliceStable(decls, func(i, j int) bool {
+		a, b := decls[i].pos, decls[j].pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	for _, d := range decls {
+		d.build()
+	}
+}
+
+// path returns a copy of the given path with the given elements appended.
+func path(p []int32, elems ...int) []int32 {
+	res := append([]int32(nil), p...)
+	for _, e := range elems {
+		res = append(res, int32(e))
+	}
+	return res
+}
+
+// Field numbers used in the paths of SourceCodeInfo, as defined in descriptor.proto.
+const (
+	filePackageTag          = 2
+	fileDependencyTag       = 3
+	fileMessagesTag         = 4
+	fileEnumsTag            = 5
+	fileServicesTag         = 6
+	fileExtensionsTag       = 7
+	fileOptionsTag          = 8
+	filePublicDependencyTag = 10
+	fileWeakDependencyTag   = 11
+	fileSyntaxTag           = 12
+	fileEditionTag          = 14
+
+	messageNameTag           = 1
+	messageFieldsTag         = 2
+	messageNestedTag         = 3
+	messageEnumsTag          = 4
+	messageExtensionRangeTag = 5
+	messageExtensionsTag     = 6
+	messageOptionsTag        = 7
+	messageOneofsTag         = 8
+	messageReservedRangeTag  = 9
+	messageReservedNameTag   = 10
+
+	fieldNameTag     = 1
+	fieldExtendeeTag = 2
+	fieldNumberTag   = 3
+	fieldLabelTag    = 4
+	fieldTypeTag     = 5
+	fieldTypeNameTag = 6
+	fieldDefaultTag  = 7
+	fieldOptionsTag  = 8
+	fieldJSONNameTag = 10
+
+	oneofNameTag = 1
+
+	extensionRangeStartTag   = 1
+	extensionRangeEndTag     = 2
+	extensionRangeOptionsTag = 3
+
+	enumNameTag          = 1
+	enumValuesTag        = 2
+	enumOptionsTag       = 3
+	enumReservedRangeTag = 4
+	enumReservedNameTag  = 5
+
+	enumValueNameTag    = 1
+	enumValueNumberTag  = 2
+	enumValueOptionsTag = 3
+
+	serviceNameTag    = 1
+	serviceMethodsTag = 2
+	serviceOptionsTag = 3
+
+	methodNameTag         = 1
+	methodInputTag        = 2
+	methodOutputTag       = 3
+	methodOptionsTag      = 4
+	methodInputStreamTag  = 5
+	methodOutputStreamTag = 6
+)
+
+func (b *builder) build() {
+	f, fd := b.file, b.fd
+	if name := f.Pos.Filename; name != "" {
+		fd.Name = protobuf.String(name)
+	}
+	pkg := join(f.Package.Identifier)
+	if pkg != "" {
+		fd.Package = protobuf.String(pkg)
+	}
+	switch f.Syntax.Value {
+	case proto.Proto3:
+		fd.Syntax = protobuf.String(proto.Proto3)
+	case proto.Editions:
+		fd.Syntax = protobuf.String(proto.Editions)
+		fd.Edition = descriptorpb.Edition_EDITION_2023.Enum()
+	}
+
+	if b.src != nil {
+		// The location of the file spans from its first token to the last one.
+		var span proto.Span
+		if n := len(b.src.toks); n > 0 {
+			span = b.src.tokens(0, n-1)
+		}
+		b.add(nil, span, nil)
+	}
+	if f.Syntax.Pos.IsValid() {
+		b.add(path(nil, fileSyntaxTag), f.Syntax.Span, &f.Syntax.Comments)
+	}
+	if f.Edition.Pos.IsValid() {
+		b.add(path(nil, fileEditionTag), f.Edition.Span, &f.Edition.Comments)
+	}
+
+	opts := b.site(fd, pkg, path(nil, fileOptionsTag))
+	var decls []decl
+	if f.Package.Pos.IsValid() {
+		decls = append(decls, decl{f.Package.Pos, func() {
+			b.add(path(nil, filePackageTag), f.Package.Span, &f.Package.Comments)
+		}})
+	}
+	for _, imp := range f.Imports {
+		imp := imp
+		decls = append(decls, decl{imp.Pos, func() { b.importDecl(imp) }})
+	}
+	for _, opt := range f.Options {
+		opt := opt
+		decls = append(decls, decl{opt.Pos, func() { b.option(opts, opt) }})
+	}
+	for _, m := range f.Messages {
+		m := m
+		decls = append(decls, decl{m.Pos, func() {
+			p := path(nil, fileMessagesTag, len(fd.MessageType))
+			fd.MessageType = append(fd.MessageType, b.message(m, pkg, p, nil, b.tok(b.src.at(m.Pos)+1)))
+		}})
+	}
+	for _, e := range f.Enums {
+		e := e
+		decls = append(decls, decl{e.Pos, func() {
+			fd.EnumType = append(fd.EnumType, b.enum(e, pkg, path(nil, fileEnumsTag, len(fd.EnumType))))
+		}})
+	}
+	for _, s := range f.Services {
+		s := s
+		decls = append(decls, decl{s.Pos, func() {
+			fd.Service = append(fd.Service, b.service(s, pkg, path(nil, fileServicesTag, len(fd.Service))))
+		}})
+	}
+	for _, e := range f.Extends {
+		e := e
+		decls = append(decls, decl{e.Pos, func() {
+			b.extend(e, pkg, &fd.Extension, path(nil, fileExtensionsTag), &fd.MessageType, path(nil, fileMessagesTag))
+		}})
+	}
+	build(decls)
+}
+
+// import = "import" [ "weak" | "public" ] strLit ";"
+func (b *builder) importDecl(imp proto.Import) {
+	fd := b.fd
+	i := len(fd.Dependency)
+	fd.Dependency = append(fd.Dependency, imp.Path)
+	b.add(path(nil, fileDependencyTag, i), imp.Span, &imp.Comments)
+	modifier := b.tok(b.src.at(imp.Pos) + 1)
+	switch imp.Modifier {
+	case proto.PublicImport:
+		b.add(path(nil, filePublicDependencyTag, len(fd.PublicDependency)), modifier, nil)
+		fd.PublicDependency = append(fd.PublicDependency, int32(i))
+	case proto.WeakImport:
+		b.add(path(nil, fileWeakDependencyTag, len(fd.WeakDependency)), modifier, nil)
+		fd.WeakDependency = append(fd.WeakDependency, int32(i))
+	}
+}
+
+// message returns the descriptor of a message declared in the given scope,
+// with the given path. For groups, fieldPath is the path of the field, and
+// name is the span of the name of the message.
+func (b *builder) message(m proto.Message, scope string, p, fieldPath []int32, name proto.Span) *descriptorpb.DescriptorProto {
+	msg := &descriptorpb.DescriptorProto{Name: protobuf.String(string(m.Name))}
+	full := names.Qualify(scope, string(m.Name))
+	b.add(p, m.Span, &m.Comments)
+	b.add(path(p, messageNameTag), name, nil)
+	if fieldPath != nil {
+		b.add(path(fieldPath, fieldTypeNameTag), name, nil)
+	}
+
+	opts := b.site(msg, scope, path(p, messageOptionsTag))
+	messageSet := m.MessageSetWireFormat()
+
+	var decls []decl
+	for _, opt := range m.Options {
+		opt := opt
+		decls = append(decls, decl{opt.Pos, func() { b.option(opts, opt) }})
+	}
+	for _, f := range m.Fields {
+		f := f
+		decls = append(decls, decl{f.Pos, func() {
+			b.field(f, full, &msg.Field, path(p, messageFieldsTag), &msg.NestedType, path(p, messageNestedTag), nil)
+		}})
+	}
+	for _, f := range m.Maps {
+		f := f
+		decls = append(decls, decl{f.Pos, func() { b.mapField(msg, f, full, p) }})
+	}
+	for _, o := range m.OneOfs {
+		o := o
+		decls = append(decls, decl{o.Pos, func() { b.oneof(msg, o, full, p) }})
+	}
+	for _, n := range m.Messages {
+		n := n
+		decls = append(decls, decl{n.Pos, func() {
+			np := path(p, messageNestedTag, len(msg.NestedType))
+			msg.NestedType = append(msg.NestedType, b.message(n, full, np, nil, b.tok(b.src.at(n.Pos)+1)))
+		}})
+	}
+	for _, e := range m.Enums {
+		e := e
+		decls = append(decls, decl{e.Pos, func() {
+			msg.EnumType = append(msg.EnumType, b.enum(e, full, path(p, messageEnumsTag, len(msg.EnumType))))
+		}})
+	}
+	for _, e := range m.Extends {
+		e := e
+		decls = append(decls, decl{e.Pos, func() {
+			b.extend(e, full, &msg.Extension, path(p, messageExtensionsTag), &msg.NestedType, path(p, messageNestedTag))
+		}})
+	}
+	for _, r := range m.Extensions {
+		r := r
+		decls = append(decls, decl{r.Pos, func() { b.extensionRange(msg, r, full, p, messageSet) }})
+	}
+	for _, r := range m.Reserveds {
+		r := r
+		decls = append(decls, decl{r.Pos, func() {
+			b.reserved(r, p, messageReservedNameTag, messageReservedRangeTag, &msg.ReservedName, func(from, to int) int {
+				end := int32(to) + 1
+				if to == proto.MaxFieldNumber && messageSet {
+					end = 1<<31 - 1
+				}
+				msg.ReservedRange = append(msg.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+					Start: protobuf.Int32(int32(from)),
+					End:   protobuf.Int32(end),
+				})
+				return len(msg.ReservedRange) - 1
+			})
+		}})
+	}
+	build(decls)
+
+	// protoc adds the synthetic oneofs after the ones declared in the message.
+	oneofs := m.SyntheticOneOfs(b.file.Syntax.Value)
+	for _, f := range msg.Field {
+		if f.GetProto3Optional() {
+			f.OneofIndex = protobuf.Int32(int32(len(msg.OneofDecl)))
+			name := string(oneofs[proto.Identifier(f.GetName())])
+			msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: protobuf.String(name)})
+		}
+	}
+	return msg
+}
+
+// field adds the descriptor of a field declared in the given scope to fields,
+// whose path is fieldsPath. Groups also add their message to msgs. The fields
+// of extend blocks have the given extendee.
+func (b *builder) field(f proto.Field, scope string, fields *[]*descriptorpb.FieldDescriptorProto, fieldsPath []int32,
+	msgs *[]*descriptorpb.DescriptorProto, msgsPath []int32, extendee *proto.Extend) {
+	p := path(fieldsPath, len(*fields))
+	fd := &descriptorpb.FieldDescriptorProto{
+		Name:     protobuf.String(string(f.Name)),
+		Number:   protobuf.Int32(int32(f.Number)),
+		Label:    label(f.Label),
+		JsonName: protobuf.String(proto.JSONName(string(f.Name))),
+	}
+	*fields = append(*fields, fd)
+
+	i := b.src.at(f.Pos)
+	if f.Group != nil {
+		// The comments of a group are attached to its message.
+		b.add(p, f.Span, nil)
+	} else {
+		b.add(p, f.Span, &f.Comments)
+	}
+	if extendee != nil {
+		fd.Extendee = protobuf.String(typeName(extendee.Type))
+		b.addRef(scope, extendee.Type, false, func(full string, kind names.Kind) {
+			if kind != names.Message {
+				b.errorf(extendee.Type.Pos, "%s is not a message type", typeName(extendee.Type))
+			}
+			fd.Extendee = protobuf.String("." + full)
+		})
+		b.add(path(p, fieldExtendeeTag), extendee.Type.Span, nil)
+	}
+	if f.Label != proto.NoLabel {
+		b.add(path(p, fieldLabelTag), b.tok(i), nil)
+		i++
+	}
+
+	if f.Group != nil {
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_GROUP.Enum()
+		fd.TypeName = protobuf.String("." + names.Qualify(scope, string(f.Group.Name)))
+		b.add(path(p, fieldTypeTag), b.tok(i), nil)
+		name := b.tok(i + 1)
+		b.add(path(p, fieldNameTag), name, nil)
+		b.add(path(p, fieldNumberTag), b.tok(i+3), nil)
+		b.fieldOptions(fd, f, scope, p, i+4)
+		mp := path(msgsPath, len(*msgs))
+		*msgs = append(*msgs, b.message(*f.Group, scope, mp, p, name))
+		return
+	}
+
+	if f.Type.Predefined != proto.TypeInvalid {
+		fd.Type = scalarTypes[f.Type.Predefined].Enum()
+		b.add(path(p, fieldTypeTag), f.Type.Span, nil)
+	} else {
+		fd.TypeName = protobuf.String(typeName(f.Type))
+		b.addRef(scope, f.Type, true, func(full string, kind names.Kind) {
+			fd.TypeName = protobuf.String("." + full)
+			if kind == names.Enum {
+				fd.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+				if v := fd.DefaultValue; v != nil && !b.syms.values[full][*v] {
+					b.errorf(f.Pos, "enum %s has no value named %s", full, *v)
+				}
+				return
+			}
+			fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+			if fd.DefaultValue != nil {
+				b.errorf(f.Pos, "message fields can't have default values")
+			}
+		})
+		b.add(path(p, fieldTypeNameTag), f.Type.Span, nil)
+	}
+	i = b.src.at(f.Type.End)
+	b.add(path(p, fieldNameTag), b.tok(i), nil)
+	b.add(path(p, fieldNumberTag), b.tok(i+2), nil)
+	b.fieldOptions(fd, f, scope, p, i+3)
+
+	if f.Label == proto.OptionalLabel && b.file.Syntax.Value == proto.Proto3 {
+		fd.Proto3Optional = protobuf.Bool(true)
+	}
+}
+
+// fieldOptions adds the options of field f, written in brackets starting
+// with the token with index i. The pseudo-options default and json_name
+// are set in the field descriptor fd itself.
+func (b *builder) fieldOptions(fd *descriptorpb.FieldDescriptorProto, f proto.Field, scope string, p []int32, i int) {
+	s := b.site(fd, scope, path(p, fieldOptionsTag))
+	if len(f.Options) == 0 {
+		return
+	}
+	b.add(s.path, b.src.tokens(i, b.src.brackets(i)), nil)
+	for _, opt := range f.Options {
+		switch {
+		case isOption(opt, "default"):
+			b.defaultValue(fd, f, opt)
+			b.add(path(p, fieldDefaultTag), opt.Span, nil)
+		case isOption(opt, "json_name"):
+			name, ok := opt.Value.(string)
+			if !ok {
+				b.errorf(opt.Pos, "json_name must be a string")
+			}
+			if fd.Extendee != nil {
+				b.errorf(opt.Pos, "json_name is not allowed on extensions")
+			}
+			fd.JsonName = protobuf.String(name)
+			b.add(path(p, fieldJSONNameTag), opt.Span, nil)
+		default:
+			s.add(opt, b.add(nil, opt.Span, nil))
+		}
+	}
+}
+
+// mapField adds the descriptor of a map field to msg, together with its
+// map entry message, built from proto.Map.Entry. The entry has no source
+// locations, as in the descriptors built by protoc.
+func (b *builder) mapField(msg *descriptorpb.DescriptorProto, m proto.Map, scope string, p []int32) {
+	entry := m.Entry()
+	entryScope := names.Qualify(scope, string(entry.Name))
+	nested := &descriptorpb.DescriptorProto{Name: protobuf.String(string(entry.Name))}
+	for _, f := range entry.Fields {
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     protobuf.String(string(f.Name)),
+			Number:   protobuf.Int32(int32(f.Number)),
+			Label:    label(f.Label),
+			JsonName: protobuf.String(proto.JSONName(string(f.Name))),
+		}
+		if f.Type.Predefined != proto.TypeInvalid {
+			fd.Type = scalarTypes[f.Type.Predefined].Enum()
+		} else {
+			fd.TypeName = protobuf.String(typeName(f.Type))
+			b.addRef(entryScope, f.Type, true, func(full string, kind names.Kind) {
+				fd.TypeName = protobuf.String("." + full)
+				fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				if kind == names.Enum {
+					fd.Type = descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum()
+				}
+			})
+		}
+		nested.Field = append(nested.Field, fd)
+	}
+	for _, opt := range entry.Options {
+		if isOption(opt, "map_entry") {
+			mapEntry, _ := opt.Value.(bool)
+			nested.Options = &descriptorpb.MessageOptions{MapEntry: protobuf.Bool(mapEntry)}
+		}
+	}
+
+	fp := path(p, messageFieldsTag, len(msg.Field))
+	fd := &descriptorpb.FieldDescriptorProto{
+		Name:     protobuf.String(string(m.Name)),
+		Number:   protobuf.Int32(int32(m.Number)),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+		TypeName: protobuf.String("." + entryScope),
+		JsonName: protobuf.String(proto.JSONName(string(m.Name))),
+	}
+	msg.Field = append(msg.Field, fd)
+	msg.NestedType = append(msg.NestedType, nested)
+
+	// map<K, V> is located as the type name of the field.
+	b.add(fp, m.Span, &m.Comments)
+	i := b.src.at(m.ValueType.End)
+	b.add(path(fp, fieldTypeNameTag), b.src.tokens(b.src.at(m.Pos), i), nil)
+	b.add(path(fp, fieldNameTag), b.tok(i+1), nil)
+	b.add(path(fp, fieldNumberTag), b.tok(i+3), nil)
+	b.fieldOptions(fd, proto.Field{Span: m.Span, Name: m.Name, Options: m.Options}, scope, fp, i+4)
+}
+
+// oneof = "oneof" oneofName "{" { oneofField | group | emptyStatement } "}"
+func (b *builder) oneof(msg *descriptorpb.DescriptorProto, o proto.OneOf, scope string, p []int32) {
+	index := len(msg.OneofDecl)
+	msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: protobuf.String(string(o.Name))})
+	op := path(p, messageOneofsTag, index)
+	b.add(op, o.Span, &o.Comments)
+	b.add(path(op, oneofNameTag), b.tok(b.src.at(o.Pos)+1), nil)
+	for _, f := range o.Fields {
+		field := proto.Field{
+			Span:     f.Span,
+			Comments: f.Comments,
+			Type:     f.Type,
+			Name:     f.Name,
+			Number:   f.Number,
+			Options:  f.Options,
+			Group:    f.Group,
+		}
+		b.field(field, scope, &msg.Field, path(p, messageFieldsTag), &msg.NestedType, path(p, messageNestedTag), nil)
+		msg.Field[len(msg.Field)-1].OneofIndex = protobuf.Int32(int32(index))
+	}
+}
+
+// extend = "extend" messageType "{" { field | group | emptyStatement } "}"
+func (b *builder) extend(e proto.Extend, scope string, exts *[]*descriptorpb.FieldDescriptorProto, extsPath []int32,
+	msgs *[]*descriptorpb.DescriptorProto, msgsPath []int32) {
+	b.add(extsPath, e.Span, &e.Comments)
+	for _, f := range e.Fields {
+		b.field(f, scope, exts, extsPath, msgs, msgsPath, &e)
+	}
+}
+
+// extensions = "extensions" ranges [ "[" fieldOptions "]" ] ";"
+func (b *builder) extensionRange(msg *descriptorpb.DescriptorProto, r proto.ExtensionRange, scope string, p []int32, messageSet bool) {
+	rp := path(p, messageExtensionRangeTag)
+	b.add(rp, r.Span, &r.Comments)
+	first := len(msg.ExtensionRange)
+	for _, rng := range r.Ranges {
+		end := int32(rng.To) + 1
+		if rng.To == proto.MaxFieldNumber && messageSet {
+			end = proto.MaxMessageSetNumber + 1
+		}
+		ip := path(rp, len(msg.ExtensionRange))
+		msg.ExtensionRange = append(msg.ExtensionRange, &descriptorpb.DescriptorProto_ExtensionRange{
+			Start: protobuf.Int32(int32(rng.From)),
+			End:   protobuf.Int32(end),
+		})
+		from, to := b.rangeBounds(rng.Span)
+		b.add(ip, rng.Span, nil)
+		b.add(path(ip, extensionRangeStartTag), from, nil)
+		b.add(path(ip, extensionRangeEndTag), to, nil)
+	}
+
+	// All the ranges share the options, which are located after all of them.
+	var i int
+	if n := len(r.Ranges); n > 0 {
+		i = b.src.at(r.Ranges[n-1].End)
+	}
+	for j := range r.Ranges {
+		s := b.site(msg.ExtensionRange[first+j], scope, path(rp, first+j, extensionRangeOptionsTag))
+		if len(r.Options) == 0 {
+			continue
+		}
+		b.add(s.path, b.src.tokens(i, b.src.brackets(i)), nil)
+		for _, opt := range r.Options {
+			s.add(opt, b.add(nil, opt.Span, nil))
+		}
+	}
+}
+
+// rangeBounds returns the spans of the start and end of the range with the
+// given span, which are the same if the range has a single number.
+func (b *builder) rangeBounds(span proto.Span) (from, to proto.Span) {
+	if b.src == nil {
+		return span, span
+	}
+	i, j := b.src.at(span.Pos), b.src.at(span.End)-1
+	for k := i; k <= j; k++ {
+		if b.src.is(k, token.To) {
+			return b.src.tokens(i, k-1), b.src.tokens(k+1, j)
+		}
+	}
+	return span, span
+}
+
+// reserved adds the names and ranges of a reserved statement of a message
+// or enum with path p, in the order they were declared. The names are
+// appended to names, and the ranges with addRange, which returns their index.
+func (b *builder) reserved(r proto.Reserved, p []int32, namesTag, rangesTag int, names *[]string, addRange func(from, to int) int) {
+	comments := &r.Comments
+	if len(r.Names) > 0 {
+		b.add(path(p, namesTag), r.Span, comments)
+		comments = nil
+		// Names have no spans of their own, but the string literals of the
+		// statement are them, in order.
+		var spans []proto.Span
+		if b.src != nil {
+			for i := b.src.at(r.Pos) + 1; i < b.src.at(r.End)-1; i++ {
+				if b.src.is(i, token.StringLiteral) {
+					spans = append(spans, b.tok(i))
+				}
+			}
+		}
+		for i, name := range r.Names {
+			if i < len(spans) {
+				b.add(path(p, namesTag, len(*names)), spans[i], nil)
+			}
+			*names = append(*names, name)
+		}
+	}
+	if len(r.Ranges) > 0 {
+		b.add(path(p, rangesTag), r.Span, comments)
+		for _, rng := range r.Ranges {
+			rp := path(p, rangesTag, addRange(rng.From, rng.To))
+			from, to := b.rangeBounds(rng.Span)
+			b.add(rp, rng.Span, nil)
+			b.add(path(rp, 1), from, nil)
+			b.add(path(rp, 2), to, nil)
+		}
+	}
+}
+
+// enum = "enum" enumName "{" { option | enumField | reserved | emptyStatement } "}"
+func (b *builder) enum(e proto.Enum, scope string, p []int32) *descriptorpb.EnumDescriptorProto {
+	ed := &descriptorpb.EnumDescriptorProto{Name: protobuf.String(string(e.Name))}
+	b.add(p, e.Span, &e.Comments)
+	b.add(path(p, enumNameTag), b.tok(b.src.at(e.Pos)+1), nil)
+
+	opts := b.site(ed, scope, path(p, enumOptionsTag))
+	var decls []decl
+	for _, opt := range e.Options {
+		opt := opt
+		decls = append(decls, decl{opt.Pos, func() { b.option(opts, opt) }})
+	}
+	for _, v := range e.Fields {
+		v := v
+		decls = append(decls, decl{v.Pos, func() {
+			ed.Value = append(ed.Value, b.enumValue(v, scope, path(p, enumValuesTag, len(ed.Value))))
+		}})
+	}
+	for _, r := range e.Reserveds {
+		r := r
+		decls = append(decls, decl{r.Pos, func() {
+			b.reserved(r, p, enumReservedNameTag, enumReservedRangeTag, &ed.ReservedName, func(from, to int) int {
+				ed.ReservedRange = append(ed.ReservedRange, &descriptorpb.EnumDescriptorProto_EnumReservedRange{
+					Start: protobuf.Int32(int32(from)),
+					End:   protobuf.Int32(int32(to)),
+				})
+				return len(ed.ReservedRange) - 1
+			})
+		}})
+	}
+	build(decls)
+	return ed
+}
+
+// enumField = ident "=" [ "-" ] intLit [ "[" enumValueOption { ","  enumValueOption } "]" ] ";"
+func (b *builder) enumValue(v proto.EnumField, scope string, p []int32) *descriptorpb.EnumValueDescriptorProto {
+	vd := &descriptorpb.EnumValueDescriptorProto{
+		Name:   protobuf.String(string(v.Name)),
+		Number: protobuf.Int32(int32(v.Number)),
+	}
+	b.add(p, v.Span, &v.Comments)
+	i := b.src.at(v.Pos)
+	b.add(path(p, enumValueNameTag), b.tok(i), nil)
+	j := i + 2
+	if b.src.is(j, token.Minus) {
+		j++
+	}
+	b.add(path(p, enumValueNumberTag), b.src.tokens(i+2, j), nil)
+
+	s := b.site(vd, scope, path(p, enumValueOptionsTag))
+	if len(v.Options) > 0 {
+		b.add(s.path, b.src.tokens(j+1, b.src.brackets(j+1)), nil)
+		for _, opt := range v.Options {
+			s.add(opt, b.add(nil, opt.Span, nil))
+		}
+	}
+	return vd
+}
+
+// service = "service" serviceName "{" { option | rpc | emptyStatement } "}"
+func (b *builder) service(s proto.Service, scope string, p []int32) *descriptorpb.ServiceDescriptorProto {
+	sd := &descriptorpb.ServiceDescriptorProto{Name: protobuf.String(string(s.Name))}
+	full := names.Qualify(scope, string(s.Name))
+	b.add(p, s.Span, &s.Comments)
+	b.add(path(p, serviceNameTag), b.tok(b.src.at(s.Pos)+1), nil)
+
+	opts := b.site(sd, scope, path(p, serviceOptionsTag))
+	var decls []decl
+	for _, opt := range s.Options {
+		opt := opt
+		decls = append(decls, decl{opt.Pos, func() { b.option(opts, opt) }})
+	}
+	for _, rpc := range s.RPCs {
+		rpc := rpc
+		decls = append(decls, decl{rpc.Pos, func() {
+			sd.Method = append(sd.Method, b.method(rpc, full, path(p, serviceMethodsTag, len(sd.Method))))
+		}})
+	}
+	build(decls)
+	return sd
+}
+
+// rpc = "rpc" rpcName rpcParam "returns" rpcParam (( "{" {option | emptyStatement } "}" ) | ";")
+func (b *builder) method(rpc proto.RPC, scope string, p []int32) *descriptorpb.MethodDescriptorProto {
+	md := &descriptorpb.MethodDescriptorProto{Name: protobuf.String(string(rpc.Name))}
+	if rpc.In.Stream {
+		md.ClientStreaming = protobuf.Bool(true)
+	}
+	if rpc.Out.Stream {
+		md.ServerStreaming = protobuf.Bool(true)
+	}
+	b.add(p, rpc.Span, &rpc.Comments)
+	b.add(path(p, methodNameTag), b.tok(b.src.at(rpc.Pos)+1), nil)
+	md.InputType = b.param(rpc.In, scope, p, methodInputStreamTag, methodInputTag)
+	md.OutputType = b.param(rpc.Out, scope, p, methodOutputStreamTag, methodOutputTag)
+
+	// As in protoc, methods with a body have options, even if empty.
+	if len(rpc.Options) > 0 || rpc.Body {
+		md.Options = &descriptorpb.MethodOptions{}
+	}
+	opts := b.site(md, scope, path(p, methodOptionsTag))
+	for _, opt := range rpc.Options {
+		b.option(opts, opt)
+	}
+	return md
+}
+
+// param returns the type name of the input or output of a method, adding the
+// locations of its stream keyword and its type with the given tags.
+//
+// rpcParam = "(" [ "stream" ] messageType ")"
+func (b *builder) param(param proto.RPCParam, scope string, p []int32, streamTag, typeTag int) *string {
+	typ := proto.Type{Span: param.Span, UserDefined: param.Type, FullyQualified: param.FullyQualified}
+	i, j := b.src.at(param.Pos)+1, b.src.at(param.End)-2
+	if param.Stream {
+		b.add(path(p, streamTag), b.tok(i), nil)
+		i++
+	}
+	if b.src != nil {
+		typ.Span = b.src.tokens(i, j)
+	}
+	b.add(path(p, typeTag), typ.Span, nil)
+
+	name := protobuf.String(typeName(typ))
+	b.addRef(scope, typ, false, func(full string, kind names.Kind) {
+		if kind != names.Message {
+			b.errorf(typ.Pos, "%s is not a message type", typeName(typ))
+		}
+		*name = "." + full
+	})
+	return name
+}
+
+// defaultValue sets the default value of a field, with the same format
+// protoc uses in descriptors.
+func (b *builder) defaultValue(fd *descriptorpb.FieldDescriptorProto, f proto.Field, opt proto.Option) {
+	switch {
+	case b.file.Syntax.Value == proto.Proto3:
+		b.errorf(opt.Pos, "default values are not allowed in proto3")
+	case f.Label == proto.RepeatedLabel:
+		b.errorf(opt.Pos, "repeated fields can't have default values")
+	case f.Group != nil, fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_MESSAGE:
+		b.errorf(opt.Pos, "message fields can't have default values")
+	case fd.Type == nil:
+		// The type is resolved later, it must be an enum.
+		if v, ok := opt.Value.([]proto.Identifier); ok && len(v) == 1 {
+			fd.DefaultValue = protobuf.String(string(v[0]))
+			return
+		}
+		b.errorf(opt.Pos, "default value of %s must be an enum value name", f.Name)
+	}
+
+	kind := protoreflect.Kind(fd.GetType())
+	v := b.scalar(kind, nil, opt.Value, opt.Pos)
+	var s string
+	switch kind {
+	case protoreflect.StringKind:
+		s = v.String()
+	case protoreflect.BytesKind:
+		s = cEscape(v.Bytes())
+	case protoreflect.FloatKind:
+		s = formatFloat(v.Float(), 32)
+	case protoreflect.DoubleKind:
+		s = formatFloat(v.Float(), 64)
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+	fd.DefaultValue = protobuf.String(s)
+}
+
+func label(l proto.Label) *descriptorpb.FieldDescriptorProto_Label {
+	switch l {
+	case proto.RequiredLabel:
+		return descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+	case proto.RepeatedLabel:
+		return descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	default:
+		return descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	}
+}
+
+var scalarTypes = map[proto.PredefinedType]descriptorpb.FieldDescriptorProto_Type{
+	proto.TypeBytes:    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+	proto.TypeDouble:   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	proto.TypeFloat:    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	proto.TypeBool:     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	proto.TypeFixed32:  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	proto.TypeFixed64:  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	proto.TypeInt32:    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	proto.TypeInt64:    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	proto.TypeSfixed32: descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	proto.TypeSfixed64: descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	proto.TypeSint32:   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	proto.TypeSint64:   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	proto.TypeString:   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	proto.TypeUint32:   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	proto.TypeUint64:   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+}
+
+// typeName returns a type as written in the file.
+func typeName(t proto.Type) string {
+	name := join(t.UserDefined)
+	if t.FullyQualified {
+		return "." + name
+	}
+	return name
+}
+
+func join(ids []proto.Identifier) string {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = string(id)
+	}
+	return strings.Join(s, ".")
+}
+
+func isOption(opt proto.Option, name proto.Identifier) bool {
+	return opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == name
+}
@@ -0,0 +1,669 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/campoy/groto/parser"
+)
+
+func toDescriptor(t *testing.T, name, in string, opts Options) (*descriptorpb.FileDescriptorProto, error) {
+	t.Helper()
+	f, err := parser.ParseFile(name, strings.NewReader(in), 0)
+	if err != nil {
+		t.Fatalf("could not parse %s: %v", name, err)
+	}
+	return ToDescriptor(f, opts)
+}
+
+func TestToDescriptor(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string // the descriptor in text format, without the name.
+	}{
+		{name: "empty proto2 file", in: ``, out: ``},
+		{name: "proto3 message", in: `
+			syntax = "proto3";
+			package foo.bar;
+			message Foo {
+				string foo_bar = 1;
+				repeated Foo children = 2;
+				.foo.bar.Foo parent = 3 [json_name = "up"];
+			}`,
+			out: `
+			package: "foo.bar"
+			message_type: {
+				name: "Foo"
+				field: {name: "foo_bar" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "fooBar"}
+				field: {name: "children" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".foo.bar.Foo" json_name: "children"}
+				field: {name: "parent" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".foo.bar.Foo" json_name: "up"}
+			}
+			syntax: "proto3"`,
+		},
+		{name: "editions", in: `
+			edition = "2023";
+			option features.field_presence = IMPLICIT;`,
+			out: `
+			options: {features: {field_presence: IMPLICIT}}
+			syntax: "editions"
+			edition: EDITION_2023`,
+		},
+		{name: "nested types and scopes", in: `
+			syntax = "proto2";
+			package a;
+			message A {
+				message B { optional C c = 1; }
+				enum C { X = 0; }
+				optional B b = 1;
+				optional A.B ab = 2;
+				optional a.C ac = 3;
+			}
+			message C { optional A.C x = 1 [default = X]; }`,
+			out: `
+			package: "a"
+			message_type: {
+				name: "A"
+				field: {name: "b" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".a.A.B" json_name: "b"}
+				field: {name: "ab" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".a.A.B" json_name: "ab"}
+				field: {name: "ac" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".a.C" json_name: "ac"}
+				nested_type: {
+					name: "B"
+					field: {name: "c" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".a.A.C" json_name: "c"}
+				}
+				enum_type: {name: "C" value: {name: "X" number: 0}}
+			}
+			message_type: {
+				name: "C"
+				field: {name: "x" number: 1 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".a.A.C" default_value: "X" json_name: "x"}
+			}`,
+		},
+		{name: "maps", in: `
+			syntax = "proto3";
+			message Foo {
+				map<string, Foo> foo_bar = 1;
+				map<int32, Kind> kinds = 2;
+				enum Kind { A = 0; }
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				field: {name: "foo_bar" number: 1 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".Foo.FooBarEntry" json_name: "fooBar"}
+				field: {name: "kinds" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".Foo.KindsEntry" json_name: "kinds"}
+				nested_type: {
+					name: "FooBarEntry"
+					field: {name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "key"}
+					field: {name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".Foo" json_name: "value"}
+					options: {map_entry: true}
+				}
+				nested_type: {
+					name: "KindsEntry"
+					field: {name: "key" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "key"}
+					field: {name: "value" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".Foo.Kind" json_name: "value"}
+					options: {map_entry: true}
+				}
+				enum_type: {name: "Kind" value: {name: "A" number: 0}}
+			}
+			syntax: "proto3"`,
+		},
+		{name: "oneofs and proto3 optional", in: `
+			syntax = "proto3";
+			message Foo {
+				optional int32 foo = 1;
+				oneof choice {
+					string a = 2;
+					bytes b = 3;
+				}
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				field: {name: "foo" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "foo" oneof_index: 1 proto3_optional: true}
+				field: {name: "a" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "a" oneof_index: 0}
+				field: {name: "b" number: 3 label: LABEL_OPTIONAL type: TYPE_BYTES json_name: "b" oneof_index: 0}
+				oneof_decl: {name: "choice"}
+				oneof_decl: {name: "_foo"}
+			}
+			syntax: "proto3"`,
+		},
+		{name: "groups and extensions", in: `
+			syntax = "proto2";
+			message Foo {
+				optional group Result = 1 {
+					required string url = 2;
+				}
+				extensions 100 to 199, 300 to max;
+			}
+			extend Foo {
+				repeated group More = 100 { optional int32 x = 1; }
+				optional string foo_name = 101;
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				field: {name: "result" number: 1 label: LABEL_OPTIONAL type: TYPE_GROUP type_name: ".Foo.Result" json_name: "result"}
+				nested_type: {
+					name: "Result"
+					field: {name: "url" number: 2 label: LABEL_REQUIRED type: TYPE_STRING json_name: "url"}
+				}
+				extension_range: {start: 100 end: 200}
+				extension_range: {start: 300 end: 536870912}
+			}
+			message_type: {
+				name: "More"
+				field: {name: "x" number: 1 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "x"}
+			}
+			extension: {name: "more" number: 100 label: LABEL_REPEATED type: TYPE_GROUP type_name: ".More" extendee: ".Foo" json_name: "more"}
+			extension: {name: "foo_name" number: 101 label: LABEL_OPTIONAL type: TYPE_STRING extendee: ".Foo" json_name: "fooName"}`,
+		},
+		{name: "groups in oneofs", in: `
+			syntax = "proto2";
+			message M {
+				oneof o {
+					group G = 1 { optional int32 a = 2; }
+				}
+			}`,
+			out: `
+			message_type: {
+				name: "M"
+				field: {name: "g" number: 1 label: LABEL_OPTIONAL type: TYPE_GROUP type_name: ".M.G" json_name: "g" oneof_index: 0}
+				nested_type: {
+					name: "G"
+					field: {name: "a" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "a"}
+				}
+				oneof_decl: {name: "o"}
+			}`,
+		},
+		{name: "reserved", in: `
+			syntax = "proto3";
+			message Foo {
+				reserved 2, 15, 9 to 11;
+				reserved "foo", "bar";
+			}
+			enum Bar {
+				A = 0;
+				reserved -5 to -1, 3, 10 to max;
+				reserved "B";
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				reserved_range: {start: 2 end: 3}
+				reserved_range: {start: 15 end: 16}
+				reserved_range: {start: 9 end: 12}
+				reserved_name: "foo"
+				reserved_name: "bar"
+			}
+			enum_type: {
+				name: "Bar"
+				value: {name: "A" number: 0}
+				reserved_range: {start: -5 end: -1}
+				reserved_range: {start: 3 end: 3}
+				reserved_range: {start: 10 end: 2147483647}
+				reserved_name: "B"
+			}
+			syntax: "proto3"`,
+		},
+		{name: "message sets", in: `
+			syntax = "proto2";
+			message Set {
+				option message_set_wire_format = true;
+				extensions 4 to max;
+			}`,
+			out: `
+			message_type: {
+				name: "Set"
+				extension_range: {start: 4 end: 2147483647}
+				options: {message_set_wire_format: true}
+			}`,
+		},
+		{name: "default values", in: `
+			syntax = "proto2";
+			message Foo {
+				optional string s = 1 [default = "a\tb\001\"'\\"];
+				optional bytes b = 2 [default = "\377x\n"];
+				optional int32 i = 3 [default = -0x10];
+				optional uint64 u = 4 [default = 18446744073709551615];
+				optional double d = 5 [default = 1e10];
+				optional float f = 6 [default = 3.4028235e38];
+				optional double inf = 7 [default = -inf];
+				optional float nan = 8 [default = nan];
+				optional bool ok = 9 [default = true];
+				optional double tenth = 10 [default = 0.1];
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				field: {name: "s" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING default_value: "a\tb\001\"'\\" json_name: "s"}
+				field: {name: "b" number: 2 label: LABEL_OPTIONAL type: TYPE_BYTES default_value: "\\377x\\n" json_name: "b"}
+				field: {name: "i" number: 3 label: LABEL_OPTIONAL type: TYPE_INT32 default_value: "-16" json_name: "i"}
+				field: {name: "u" number: 4 label: LABEL_OPTIONAL type: TYPE_UINT64 default_value: "18446744073709551615" json_name: "u"}
+				field: {name: "d" number: 5 label: LABEL_OPTIONAL type: TYPE_DOUBLE default_value: "10000000000" json_name: "d"}
+				field: {name: "f" number: 6 label: LABEL_OPTIONAL type: TYPE_FLOAT default_value: "3.40282347e+38" json_name: "f"}
+				field: {name: "inf" number: 7 label: LABEL_OPTIONAL type: TYPE_DOUBLE default_value: "-inf" json_name: "inf"}
+				field: {name: "nan" number: 8 label: LABEL_OPTIONAL type: TYPE_FLOAT default_value: "nan" json_name: "nan"}
+				field: {name: "ok" number: 9 label: LABEL_OPTIONAL type: TYPE_BOOL default_value: "true" json_name: "ok"}
+				field: {name: "tenth" number: 10 label: LABEL_OPTIONAL type: TYPE_DOUBLE default_value: "0.1" json_name: "tenth"}
+			}`,
+		},
+		{name: "services", in: `
+			syntax = "proto3";
+			package foo;
+			import "google/protobuf/empty.proto";
+			service Foo {
+				option deprecated = true;
+				rpc Get(google.protobuf.Empty) returns (stream Msg);
+				rpc Put(stream Msg) returns (google.protobuf.Empty) {}
+				rpc Chat(stream Msg) returns (stream Msg) {
+					option idempotency_level = IDEMPOTENT;
+				}
+			}
+			message Msg {}`,
+			out: `
+			package: "foo"
+			dependency: "google/protobuf/empty.proto"
+			message_type: {name: "Msg"}
+			service: {
+				name: "Foo"
+				method: {name: "Get" input_type: ".google.protobuf.Empty" output_type: ".foo.Msg" server_streaming: true}
+				method: {name: "Put" input_type: ".foo.Msg" output_type: ".google.protobuf.Empty" options: {} client_streaming: true}
+				method: {
+					name: "Chat" input_type: ".foo.Msg" output_type: ".foo.Msg"
+					options: {idempotency_level: IDEMPOTENT}
+					client_streaming: true server_streaming: true
+				}
+				options: {deprecated: true}
+			}
+			syntax: "proto3"`,
+		},
+		{name: "standard options", in: `
+			syntax = "proto3";
+			option java_package = "com.example";
+			option java_multiple_files = true;
+			option optimize_for = CODE_SIZE;
+			message Foo {
+				option deprecated = true;
+				repeated int32 ids = 1 [packed = false, deprecated = true];
+			}
+			enum Bar {
+				option allow_alias = true;
+				A = 0;
+				B = 0 [deprecated = true];
+			}`,
+			out: `
+			message_type: {
+				name: "Foo"
+				field: {name: "ids" number: 1 label: LABEL_REPEATED type: TYPE_INT32 json_name: "ids" options: {packed: false deprecated: true}}
+				options: {deprecated: true}
+			}
+			enum_type: {
+				name: "Bar"
+				value: {name: "A" number: 0}
+				value: {name: "B" number: 0 options: {deprecated: true}}
+				options: {allow_alias: true}
+			}
+			options: {java_package: "com.example" java_multiple_files: true optimize_for: CODE_SIZE}
+			syntax: "proto3"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toDescriptor(t, "test.proto", tt.in, Options{Source: []byte(tt.in)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got.SourceCodeInfo = nil
+			want := &descriptorpb.FileDescriptorProto{}
+			if err := prototext.Unmarshal([]byte(tt.out), want); err != nil {
+				t.Fatalf("bad expected descriptor: %v", err)
+			}
+			want.Name = protobuf.String("test.proto")
+			if !protobuf.Equal(got, want) {
+				t.Errorf("expected descriptor:\n%v\ngot:\n%v", prototext.Format(want), prototext.Format(got))
+			}
+		})
+	}
+}
+
+// ext returns the encoding of a custom option with the given number and
+// encoded value.
+func ext(num protowire.Number, typ protowire.Type, value []byte) []byte {
+	return append(protowire.AppendTag(nil, num, typ), value...)
+}
+
+func varint(v uint64) []byte { return protowire.AppendVarint(nil, v) }
+
+func embedded(b ...[]byte) []byte {
+	var res []byte
+	for _, b := range b {
+		res = append(res, b...)
+	}
+	return protowire.AppendBytes(nil, res)
+}
+
+func TestCustomOptions(t *testing.T) {
+	in := `
+	syntax = "proto2";
+	package foo;
+	import "google/protobuf/descriptor.proto";
+
+	message Agg {
+		optional int32 a = 1;
+		repeated string b = 2;
+		optional Agg c = 3;
+		optional group G = 4 { optional int32 x = 1; }
+		extensions 100 to 200;
+	}
+	extend Agg { optional int32 ext = 100; }
+
+	extend google.protobuf.MessageOptions {
+		optional string name = 50000;
+		repeated int32 ids = 50001;
+		optional Agg agg = 50002;
+		optional Kind kind = 50003;
+	}
+	enum Kind { UNKNOWN = 0; GOOD = 1; }
+
+	message Foo {
+		option (ids) = 1;
+		option deprecated = true;
+		option (name) = "foo";
+		option (ids) = 2;
+		option (agg) = { a: 1 b: ["x", "y"] c { a: 2 } G { x: 3 } [ext]: 4 };
+		option (foo.kind) = GOOD;
+	}
+
+	message Bar {
+		option (agg).c.a = 1;
+	}
+
+	message Baz {
+		option (agg).c.a = 1;
+		option (name) = "baz";
+		option (agg).a = 2;
+		option (agg).c.b = "x";
+	}
+	`
+	fd, err := toDescriptor(t, "test.proto", in, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts protobuf.Message
+		want []byte
+	}{
+		{"Foo", fd.MessageType[1].Options, concat(
+			ext(3, protowire.VarintType, varint(1)), // deprecated is a known field.
+			ext(50001, protowire.VarintType, varint(1)),
+			ext(50000, protowire.BytesType, embedded([]byte("foo"))),
+			ext(50001, protowire.VarintType, varint(2)),
+			ext(50002, protowire.BytesType, embedded(
+				ext(1, protowire.VarintType, varint(1)),
+				ext(2, protowire.BytesType, embedded([]byte("x"))),
+				ext(2, protowire.BytesType, embedded([]byte("y"))),
+				ext(3, protowire.BytesType, embedded(ext(1, protowire.VarintType, varint(2)))),
+				ext(4, protowire.StartGroupType, ext(1, protowire.VarintType, varint(3))),
+				protowire.AppendTag(nil, 4, protowire.EndGroupType),
+				ext(100, protowire.VarintType, varint(4)),
+			)),
+			ext(50003, protowire.VarintType, varint(1)),
+		)},
+		{"Bar", fd.MessageType[2].Options, concat(
+			ext(50002, protowire.BytesType, embedded(
+				ext(3, protowire.BytesType, embedded(ext(1, protowire.VarintType, varint(1)))),
+			)),
+		)},
+		{"Baz", fd.MessageType[3].Options, concat(
+			ext(50002, protowire.BytesType, embedded(
+				ext(1, protowire.VarintType, varint(2)),
+				ext(3, protowire.BytesType, embedded(
+					ext(1, protowire.VarintType, varint(1)),
+					ext(2, protowire.BytesType, embedded([]byte("x"))),
+				)),
+			)),
+			ext(50000, protowire.BytesType, embedded([]byte("baz"))),
+		)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := protobuf.Marshal(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("expected options %x, got %x", tt.want, got)
+			}
+		})
+	}
+}
+
+func concat(b ...[]byte) []byte {
+	var res []byte
+	for _, b := range b {
+		res = append(res, b...)
+	}
+	return res
+}
+
+func TestImports(t *testing.T) {
+	dep, err := toDescriptor(t, "dep.proto", `
+		syntax = "proto3";
+		package dep;
+		import public "google/protobuf/timestamp.proto";
+		message Dep { enum Kind { A = 0; } }`, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fd, err := toDescriptor(t, "test.proto", `
+		syntax = "proto3";
+		package dep.test;
+		import weak "dep.proto";
+		message Foo {
+			Dep.Kind kind = 1;
+			google.protobuf.Timestamp time = 2;
+		}`, Options{Imports: []*descriptorpb.FileDescriptorProto{dep}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{".dep.Dep.Kind", ".google.protobuf.Timestamp"}
+	for i, f := range fd.MessageType[0].Field {
+		if f.GetTypeName() != want[i] {
+			t.Errorf("expected type %s for field %s, got %s", want[i], f.GetName(), f.GetTypeName())
+		}
+	}
+	if fmt.Sprint(fd.WeakDependency) != "[0]" {
+		t.Errorf("expected weak dependency [0], got %v", fd.WeakDependency)
+	}
+}
+
+func TestSourceCodeInfo(t *testing.T) {
+	in := `// Detached.
+
+// Leading.
+syntax = "proto3"; // Trailing.
+
+package foo;
+
+import "google/protobuf/descriptor.proto";
+
+option java_package = "foo"; // Option.
+
+/* Block
+ * comment. */
+message Foo {
+	map<string, int32> m = 1 [deprecated = true];
+  // Field.
+  repeated Foo foos = 2;
+  reserved 5, 8 to 10;
+}
+
+enum Kind {
+  A = 0;
+  B = -1 [(name) = "b"];
+}
+
+extend google.protobuf.EnumValueOptions {
+  string name = 50000;
+}
+`
+	want := []string{
+		`[] [3 0 27 1]`,
+		`[12] [3 0 18] leading:" Leading.\n" trailing:" Trailing.\n" detached:[" Detached.\n"]`,
+		`[2] [5 0 12]`,
+		`[3 0] [7 0 42]`,
+		`[8] [9 0 28]`,
+		`[8 1] [9 0 28] trailing:" Option.\n"`,
+		`[4 0] [13 0 18 1] leading:" Block\n comment. "`,
+		`[4 0 1] [13 8 11]`,
+		`[4 0 2 0] [14 8 53]`,
+		`[4 0 2 0 6] [14 8 26]`,
+		`[4 0 2 0 1] [14 27 28]`,
+		`[4 0 2 0 3] [14 31 32]`,
+		`[4 0 2 0 8] [14 33 52]`,
+		`[4 0 2 0 8 3] [14 34 51]`,
+		`[4 0 2 1] [16 2 24] leading:" Field.\n"`,
+		`[4 0 2 1 4] [16 2 10]`,
+		`[4 0 2 1 6] [16 11 14]`,
+		`[4 0 2 1 1] [16 15 19]`,
+		`[4 0 2 1 3] [16 22 23]`,
+		`[4 0 9] [17 2 22]`,
+		`[4 0 9 0] [17 11 12]`,
+		`[4 0 9 0 1] [17 11 12]`,
+		`[4 0 9 0 2] [17 11 12]`,
+		`[4 0 9 1] [17 14 21]`,
+		`[4 0 9 1 1] [17 14 15]`,
+		`[4 0 9 1 2] [17 19 21]`,
+		`[5 0] [20 0 23 1]`,
+		`[5 0 1] [20 5 9]`,
+		`[5 0 2 0] [21 2 8]`,
+		`[5 0 2 0 1] [21 2 3]`,
+		`[5 0 2 0 2] [21 6 7]`,
+		`[5 0 2 1] [22 2 24]`,
+		`[5 0 2 1 1] [22 2 3]`,
+		`[5 0 2 1 2] [22 6 8]`,
+		`[5 0 2 1 3] [22 9 23]`,
+		`[5 0 2 1 3 50000] [22 10 22]`,
+		`[7] [25 0 27 1]`,
+		`[7 0] [26 2 22]`,
+		`[7 0 2] [25 7 39]`,
+		`[7 0 5] [26 2 8]`,
+		`[7 0 1] [26 9 13]`,
+		`[7 0 3] [26 16 21]`,
+	}
+
+	fd, err := toDescriptor(t, "test.proto", in, Options{Source: []byte(in)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, loc := range fd.SourceCodeInfo.Location {
+		s := fmt.Sprint(loc.Path, " ", loc.Span)
+		if loc.LeadingComments != nil {
+			s += fmt.Sprintf(" leading:%q", loc.GetLeadingComments())
+		}
+		if loc.TrailingComments != nil {
+			s += fmt.Sprintf(" trailing:%q", loc.GetTrailingComments())
+		}
+		if loc.LeadingDetachedComments != nil {
+			s += fmt.Sprintf(" detached:%q", loc.LeadingDetachedComments)
+		}
+		got = append(got, s)
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d locations, got %d", len(want), len(got))
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		if got[i] != want[i] {
+			t.Errorf("location %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"undefined type", `syntax = "proto3"; message Foo { Bar bar = 1; }`,
+			`test.proto:1:34: Bar is not defined`},
+		{"partially resolved type", `syntax = "proto3"; package a; message a { } message Foo { a.Foo foo = 1; }`,
+			`test.proto:1:59: a.Foo resolved to a.a.Foo, which is not defined`},
+		{"not a type", `syntax = "proto3"; message Foo { int32 x = 1; Foo.x y = 2; }`,
+			`test.proto:1:47: Foo.x is not a type`},
+		{"extendee not a message", `syntax = "proto2"; enum E { A = 0; } extend E { optional int32 x = 1; }`,
+			`test.proto:1:45: E is not a message type`},
+		{"method input not a message", `syntax = "proto3"; enum E { A = 0; } service S { rpc M(E) returns (E); }`,
+			`test.proto:1:55: E is not a message type`},
+		{"missing import", `syntax = "proto3"; import "missing.proto";`,
+			`test.proto:1:20: file not found: missing.proto`},
+		{"unknown option", `syntax = "proto3"; option foo = 1;`,
+			`test.proto:1:20: option foo is unknown`},
+		{"unknown custom option", `syntax = "proto3"; option (foo) = 1;`,
+			`test.proto:1:20: foo is not defined`},
+		{"option of the wrong type", `syntax = "proto3"; option java_package = 1;`,
+			`test.proto:1:20: value must be a string, got 1`},
+		{"option out of range", `syntax = "proto2"; import "google/protobuf/descriptor.proto";
+			extend google.protobuf.FileOptions { optional int32 x = 5000; } option (x) = 3000000000;`,
+			`test.proto:2:68: value must be an integer between -2147483648 and 2147483647, got 3000000000`},
+		{"option set twice", `syntax = "proto3"; option java_package = "a"; option java_package = "b";`,
+			`test.proto:1:47: option java_package was already set`},
+		{"option set after its fields", `edition = "2023"; option features.field_presence = IMPLICIT; option features = { enum_type: OPEN };`,
+			`test.proto:1:62: option features was already set by option features.field_presence`},
+		{"option fields set after the option", `edition = "2023"; option features = { enum_type: OPEN }; option features.field_presence = IMPLICIT;`,
+			`test.proto:1:58: option features was already set`},
+		{"unknown enum value", `syntax = "proto3"; option optimize_for = FAST;`,
+			`test.proto:1:20: enum google.protobuf.FileOptions.OptimizeMode has no value named FAST`},
+		{"wrong extendee", `syntax = "proto2"; import "google/protobuf/descriptor.proto";
+			extend google.protobuf.FileOptions { optional int32 x = 5000; } message M { option (x) = 1; }`,
+			`test.proto:2:80: x is an extension of google.protobuf.FileOptions, not of google.protobuf.MessageOptions`},
+		{"default in proto3", `syntax = "proto3"; message M { int32 x = 1 [default = 1]; }`,
+			`test.proto:1:45: default values are not allowed in proto3`},
+		{"default of wrong type", `syntax = "proto2"; message M { optional int32 x = 1 [default = "a"]; }`,
+			`test.proto:1:54: value must be an integer between -2147483648 and 2147483647, got a`},
+		{"default for a message", `syntax = "proto2"; message M { optional M x = 1 [default = X]; }`,
+			`test.proto:1:32: message fields can't have default values`},
+		{"unknown enum default", `syntax = "proto2"; enum E { A = 0; } message M { optional E x = 1 [default = B]; }`,
+			`test.proto:1:50: enum E has no value named B`},
+		{"json_name on extension", `syntax = "proto2"; message M { extensions 1 to 10; }
+			extend M { optional int32 x = 1 [json_name = "y"]; }`,
+			`test.proto:2:37: json_name is not allowed on extensions`},
+		{"explicit map entry", `syntax = "proto3"; message M { option map_entry = true; }`,
+			`test.proto:1:32: map_entry should not be set explicitly, use map<KeyType, ValueType> instead`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := toDescriptor(t, "test.proto", tt.in, Options{})
+			if err == nil {
+				t.Fatalf("expected error %q, got nil", tt.err)
+			}
+			if err.Error() != tt.err {
+				t.Errorf("expected error %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
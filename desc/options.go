@@ -0,0 +1,648 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// A site is a descriptor with options, such as a message or a field. Options
+// are interpreted once all the definitions in the file are known, since
+// custom options can be defined in the same file.
+type site struct {
+	msg   protoreflect.Message // the descriptor.
+	scope string               // scope used to resolve the names in the options.
+	path  []int32              // path of the options in SourceCodeInfo.
+	opts  []option
+}
+
+// An option of a site, together with its location, whose path is only
+// known once the option is interpreted.
+type option struct {
+	proto.Option
+	loc *descriptorpb.SourceCodeInfo_Location
+}
+
+// A record is the encoding of an option. Options setting a field of a
+// message option, such as (foo).bar, are encoded as fields of that message,
+// so they can be merged.
+type record struct {
+	msg protoreflect.FieldDescriptor // the message option, if any.
+	b   []byte
+}
+
+func (b *builder) site(desc protobuf.Message, scope string, p []int32) *site {
+	s := &site{msg: desc.ProtoReflect(), scope: scope, path: p}
+	b.sites = append(b.sites, s)
+	return s
+}
+
+func (s *site) add(opt proto.Option, loc *descriptorpb.SourceCodeInfo_Location) {
+	s.opts = append(s.opts, option{opt, loc})
+}
+
+// options returns the field of the descriptor holding its options.
+func (s *site) options() protoreflect.FieldDescriptor {
+	return s.msg.Descriptor().Fields().ByName("options")
+}
+
+// option adds an option statement to a site.
+func (b *builder) option(s *site, opt proto.Option) {
+	b.add(s.path, opt.Span, nil)
+	s.add(opt, b.add(nil, opt.Span, &opt.Comments))
+}
+
+// interpretOptions sets the options of all the descriptors in the file.
+//
+// As protoc does, each option is encoded on its own, and the options of each
+// descriptor are decoded from the concatenation of all their encodings. The
+// options setting fields of the same message are merged into a single value.
+// The standard options are interpreted first, since they're needed to build
+// the descriptors of the custom options defined in the file. Custom options
+// are kept as unknown fields, in the order they were declared.
+func (b *builder) interpretOptions() {
+	b.counts = map[string]int{}
+	b.fields = map[string]string{}
+	records := make([][]record, len(b.sites))
+	for i, s := range b.sites {
+		records[i] = make([]record, len(s.opts))
+		for j, opt := range s.opts {
+			if opt.Prefix == nil {
+				records[i][j] = b.interpret(s, opt)
+			}
+		}
+		b.setOptions(s, records[i])
+	}
+	for i, s := range b.sites {
+		custom := false
+		for j, opt := range s.opts {
+			if opt.Prefix != nil {
+				records[i][j] = b.interpret(s, opt)
+				custom = true
+			}
+		}
+		if custom {
+			b.setOptions(s, records[i])
+		}
+	}
+}
+
+// setOptions sets the options of a site to the given encoded options.
+func (b *builder) setOptions(s *site, records []record) {
+	var buf []byte
+	for _, r := range b.merge(s, records) {
+		buf = append(buf, r...)
+	}
+	if len(buf) == 0 {
+		return
+	}
+	fd := s.options()
+	opts := s.msg.NewField(fd).Message()
+	// Without a resolver, extensions are kept as unknown fields.
+	err := protobuf.UnmarshalOptions{Resolver: (*protoregistry.Types)(nil)}.Unmarshal(buf, opts.Interface())
+	if err != nil {
+		b.errorf(s.opts[0].Pos, "invalid options: %v", err)
+	}
+	s.msg.Set(fd, protoreflect.ValueOfMessage(opts))
+}
+
+// merge returns the encodings of the options of a site, where the options
+// setting fields of the same message are merged, in the place of the first
+// of them.
+func (b *builder) merge(s *site, records []record) [][]byte {
+	res := make([][]byte, len(records))
+	seen := map[protoreflect.FullName]bool{}
+	for i, r := range records {
+		if r.msg == nil {
+			res[i] = r.b
+			continue
+		}
+		if seen[r.msg.FullName()] {
+			continue
+		}
+		seen[r.msg.FullName()] = true
+		var fields []byte
+		for _, r2 := range records[i:] {
+			if r2.msg != nil && r2.msg.FullName() == r.msg.FullName() {
+				fields = append(fields, r2.b...)
+			}
+		}
+		// The files are only known once the standard options are set, so
+		// extensions in the values of standard options are kept unknown.
+		opts := protobuf.UnmarshalOptions{Resolver: (*protoregistry.Types)(nil)}
+		if r.msg.IsExtension() {
+			opts.Resolver = dynamicpb.NewTypes(b.files())
+		}
+		msg := dynamicpb.NewMessage(r.msg.Message())
+		err := opts.Unmarshal(fields, msg)
+		if err != nil {
+			b.errorf(s.opts[i].Pos, "invalid value for option %s: %v", optionName(s.opts[i].Option), err)
+		}
+		res[i] = wrap(r.msg, appendMessage(nil, msg))
+	}
+	return res
+}
+
+// interpret returns the encoding of an option of the given site, and sets
+// the path of its location.
+func (b *builder) interpret(s *site, opt option) record {
+	name := optionName(opt.Option)
+	typ := s.options().Message()
+	var fds []protoreflect.FieldDescriptor
+	names := opt.Name
+	if opt.Prefix == nil {
+		if names[0] == "map_entry" && typ.FullName() == "google.protobuf.MessageOptions" {
+			b.errorf(opt.Pos, "map_entry should not be set explicitly, use map<KeyType, ValueType> instead")
+		}
+		fd := typ.Fields().ByName(protoreflect.Name(names[0]))
+		if fd == nil {
+			b.errorf(opt.Pos, "option %s is unknown", name)
+		}
+		fds = append(fds, fd)
+		names = names[1:]
+	} else {
+		fds = append(fds, b.extension(s, opt.Option, typ))
+	}
+	for _, n := range names {
+		prev := fds[len(fds)-1]
+		if prev.Message() == nil || prev.IsList() || prev.IsMap() {
+			b.errorf(opt.Pos, "option %s: %s is not a message", name, prev.FullName())
+		}
+		fd := prev.Message().Fields().ByName(protoreflect.Name(n))
+		if fd == nil {
+			b.errorf(opt.Pos, "option %s: %s has no field named %s", name, prev.Message().FullName(), n)
+		}
+		fds = append(fds, fd)
+	}
+
+	leaf := fds[len(fds)-1]
+	var v protoreflect.Value
+	switch {
+	case leaf.IsMap():
+		b.errorf(opt.Pos, "option %s: map fields can only be set in aggregate values", name)
+	case leaf.Message() != nil:
+		v = b.aggregate(s.scope, leaf, opt.Option)
+	default:
+		v = b.scalar(leaf.Kind(), leaf, opt.Value, opt.Pos)
+	}
+	rec := record{b: appendValue(nil, leaf, v)}
+	for i := len(fds) - 2; i >= 1; i-- {
+		rec.b = wrap(fds[i], rec.b)
+	}
+	if len(fds) > 1 {
+		rec.msg = fds[0]
+	}
+
+	p := append([]int32(nil), s.path...)
+	for _, fd := range fds {
+		p = append(p, int32(fd.Number()))
+	}
+	key := fmt.Sprint(p)
+	// A message can't be set both as a whole and through its fields.
+	if prev := b.fields[key]; prev != "" {
+		b.errorf(opt.Pos, "option %s was already set by option %s", name, prev)
+	}
+	for i := len(s.path) + 1; i < len(p); i++ {
+		n := i - len(s.path)
+		if opt.Prefix != nil {
+			n--
+		}
+		k := fmt.Sprint(p[:i])
+		if b.counts[k] > 0 {
+			prefix := optionName(proto.Option{Prefix: opt.Prefix, Name: opt.Name[:n]})
+			b.errorf(opt.Pos, "option %s was already set", prefix)
+		}
+		if b.fields[k] == "" {
+			b.fields[k] = name
+		}
+	}
+	if leaf.IsList() {
+		p = append(p, int32(b.counts[key]))
+	} else if b.counts[key] > 0 {
+		b.errorf(opt.Pos, "option %s was already set", name)
+	}
+	b.counts[key]++
+	if opt.loc != nil {
+		opt.loc.Path = p
+	}
+	return rec
+}
+
+// extension returns the descriptor of the extension used in a custom
+// option, which must extend the options of type typ.
+func (b *builder) extension(s *site, opt proto.Option, typ protoreflect.MessageDescriptor) protoreflect.FieldDescriptor {
+	name := join(opt.Prefix)
+	full, kind, err := b.syms.lookup(s.scope, name, false)
+	if err != nil {
+		b.errorf(opt.Pos, "%v", err)
+	}
+	if kind != names.Field {
+		b.errorf(opt.Pos, "%s is not an extension", name)
+	}
+	d, err := b.files().FindDescriptorByName(protoreflect.FullName(full))
+	fd, ok := d.(protoreflect.FieldDescriptor)
+	if err != nil || !ok || !fd.IsExtension() {
+		b.errorf(opt.Pos, "%s is not an extension", name)
+	}
+	if fd.ContainingMessage().FullName() != typ.FullName() {
+		b.errorf(opt.Pos, "%s is an extension of %s, not of %s", name, fd.ContainingMessage().FullName(), typ.FullName())
+	}
+	return fd
+}
+
+// files returns the registry with the imported files and the file itself,
+// which is used to interpret the custom options.
+func (b *builder) files() *protoregistry.Files {
+	if b.self != nil {
+		return b.self
+	}
+	files := new(protoregistry.Files)
+	b.imports.registry.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		files.RegisterFile(f)
+		return true
+	})
+	fd := newFile(b.fd)
+	if fd.Name == nil {
+		fd.Name = protobuf.String("input.proto")
+	}
+	f, err := protodesc.FileOptions{AllowUnresolvable: true}.New(fd, files)
+	if err == nil {
+		err = files.RegisterFile(f)
+	}
+	if err != nil {
+		b.errorf(b.file.Pos, "%v", err)
+	}
+	b.self = files
+	return files
+}
+
+// scalar returns the value of an option or default value of the given kind.
+// The descriptor of the field is used to find the values of enums.
+func (b *builder) scalar(kind protoreflect.Kind, fd protoreflect.FieldDescriptor, v interface{}, pos token.Position) protoreflect.Value {
+	n, isNumber := v.(proto.Number)
+	s, isString := v.(string)
+	switch kind {
+	case protoreflect.BoolKind:
+		if v, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(v)
+		}
+		b.errorf(pos, "value must be true or false, got %v", v)
+	case protoreflect.EnumKind:
+		if ids, ok := v.([]proto.Identifier); ok && len(ids) == 1 {
+			if ev := fd.Enum().Values().ByName(protoreflect.Name(ids[0])); ev != nil {
+				return protoreflect.ValueOfEnum(ev.Number())
+			}
+			b.errorf(pos, "enum %s has no value named %s", fd.Enum().FullName(), ids[0])
+		}
+		b.errorf(pos, "value must be a value of enum %s, got %v", fd.Enum().FullName(), v)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, ok := n.Int64(); isNumber && ok && math.MinInt32 <= i && i <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(i))
+		}
+		b.errorf(pos, "value must be an integer between %d and %d, got %v", math.MinInt32, math.MaxInt32, v)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, ok := n.Int64(); isNumber && ok {
+			return protoreflect.ValueOfInt64(i)
+		}
+		b.errorf(pos, "value must be an integer between %d and %d, got %v", int64(math.MinInt64), int64(math.MaxInt64), v)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if u, ok := n.Uint64(); isNumber && ok && u <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(u))
+		}
+		b.errorf(pos, "value must be an integer between 0 and %d, got %v", math.MaxUint32, v)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u, ok := n.Uint64(); isNumber && ok {
+			return protoreflect.ValueOfUint64(u)
+		}
+		b.errorf(pos, "value must be an integer between 0 and %d, got %v", uint64(math.MaxUint64), v)
+	case protoreflect.FloatKind:
+		if isNumber {
+			return protoreflect.ValueOfFloat32(float32(n.Float64()))
+		}
+		b.errorf(pos, "value must be a number, got %v", v)
+	case protoreflect.DoubleKind:
+		if isNumber {
+			return protoreflect.ValueOfFloat64(n.Float64())
+		}
+		b.errorf(pos, "value must be a number, got %v", v)
+	case protoreflect.StringKind:
+		if isString {
+			return protoreflect.ValueOfString(s)
+		}
+		b.errorf(pos, "value must be a string, got %v", v)
+	case protoreflect.BytesKind:
+		if isString {
+			return protoreflect.ValueOfBytes([]byte(s))
+		}
+		b.errorf(pos, "value must be a string, got %v", v)
+	}
+	b.errorf(pos, "values of type %v are not supported", kind)
+	return protoreflect.Value{}
+}
+
+// aggregate returns the value of an option of a message type, which is
+// written in the text format.
+func (b *builder) aggregate(scope string, fd protoreflect.FieldDescriptor, opt proto.Option) protoreflect.Value {
+	agg, ok := opt.Value.(proto.Aggregate)
+	if !ok {
+		b.errorf(opt.Pos, "value of option %s must be a message in braces, got %v", optionName(opt), opt.Value)
+	}
+	var buf strings.Builder
+	b.writeFields(&buf, scope, agg.Fields)
+	msg := dynamicpb.NewMessage(fd.Message())
+	files := b.files()
+	err := prototext.UnmarshalOptions{Resolver: dynamicpb.NewTypes(files)}.Unmarshal([]byte(buf.String()), msg)
+	if err != nil {
+		b.errorf(agg.Pos, "invalid value for option %s: %v", optionName(opt), err)
+	}
+	return protoreflect.ValueOfMessage(msg)
+}
+
+// writeFields writes the fields of an aggregate in the text format, with
+// the names of extensions fully qualified.
+func (b *builder) writeFields(buf *strings.Builder, scope string, fields []proto.AggregateField) {
+	for _, f := range fields {
+		name := join(f.Name)
+		switch {
+		case f.TypeURL != "":
+			name = "[" + f.TypeURL + "/" + name + "]"
+		case f.Extension:
+			full, kind, err := b.syms.lookup(scope, name, false)
+			if err != nil {
+				b.errorf(f.Pos, "%v", err)
+			}
+			if kind != names.Field {
+				b.errorf(f.Pos, "%s is not an extension", name)
+			}
+			name = "[" + full + "]"
+		}
+		buf.WriteString(name)
+		buf.WriteString(": ")
+		b.writeValue(buf, scope, f.Value)
+		buf.WriteString("\n")
+	}
+}
+
+func (b *builder) writeValue(buf *strings.Builder, scope string, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		buf.WriteString(`"` + cEscape([]byte(v)) + `"`)
+	case proto.Number:
+		buf.WriteString(v.Text)
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case []proto.Identifier:
+		buf.WriteString(join(v))
+	case proto.Aggregate:
+		buf.WriteString("{\n")
+		b.writeFields(buf, scope, v.Fields)
+		buf.WriteString("}")
+	case proto.List:
+		buf.WriteString("[")
+		for i, v := range v.Values {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			b.writeValue(buf, scope, v)
+		}
+		buf.WriteString("]")
+	}
+}
+
+// wrap returns the encoding of a message field containing the given encoded
+// fields.
+func wrap(fd protoreflect.FieldDescriptor, fields []byte) []byte {
+	var b []byte
+	if fd.Kind() == protoreflect.GroupKind {
+		b = protowire.AppendTag(b, fd.Number(), protowire.StartGroupType)
+		b = append(b, fields...)
+		return protowire.AppendTag(b, fd.Number(), protowire.EndGroupType)
+	}
+	b = protowire.AppendTag(b, fd.Number(), protowire.BytesType)
+	return protowire.AppendBytes(b, fields)
+}
+
+// appendField appends the encoding of the value of a field to b. Unlike
+// proto.Marshal, fields are always encoded in the order of their numbers,
+// including extensions, as protoc does.
+func appendField(b []byte, fd protoreflect.FieldDescriptor, v protoreflect.Value) []byte {
+	switch {
+	case fd.IsMap():
+		m := v.Map()
+		var keys []protoreflect.MapKey
+		m.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+			keys = append(keys, k)
+			return true
+		})
+		sort.Slice(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		for _, k := range keys {
+			entry := appendValue(nil, fd.MapKey(), k.Value())
+			entry = appendValue(entry, fd.MapValue(), m.Get(k))
+			b = protowire.AppendTag(b, fd.Number(), protowire.BytesType)
+			b = protowire.AppendBytes(b, entry)
+		}
+	case fd.IsList() && fd.IsPacked():
+		l := v.List()
+		var packed []byte
+		for i := 0; i < l.Len(); i++ {
+			packed = appendScalar(packed, fd.Kind(), l.Get(i))
+		}
+		b = protowire.AppendTag(b, fd.Number(), protowire.BytesType)
+		b = protowire.AppendBytes(b, packed)
+	case fd.IsList():
+		l := v.List()
+		for i := 0; i < l.Len(); i++ {
+			b = appendValue(b, fd, l.Get(i))
+		}
+	default:
+		b = appendValue(b, fd, v)
+	}
+	return b
+}
+
+func lessKey(a, b protoreflect.MapKey) bool {
+	switch a.Interface().(type) {
+	case bool:
+		return !a.Bool() && b.Bool()
+	case int32, int64:
+		return a.Int() < b.Int()
+	case uint32, uint64:
+		return a.Uint() < b.Uint()
+	default:
+		return a.String() < b.String()
+	}
+}
+
+// appendValue appends a single value of a field, with its tag, to b.
+func appendValue(b []byte, fd protoreflect.FieldDescriptor, v protoreflect.Value) []byte {
+	switch fd.Kind() {
+	case protoreflect.GroupKind:
+		return append(b, wrap(fd, appendMessage(nil, v.Message()))...)
+	case protoreflect.MessageKind:
+		b = protowire.AppendTag(b, fd.Number(), protowire.BytesType)
+		return protowire.AppendBytes(b, appendMessage(nil, v.Message()))
+	}
+	b = protowire.AppendTag(b, fd.Number(), wireTypes[fd.Kind()])
+	return appendScalar(b, fd.Kind(), v)
+}
+
+// appendMessage appends the fields of a message, followed by its unknown fields.
+func appendMessage(b []byte, m protoreflect.Message) []byte {
+	type field struct {
+		fd protoreflect.FieldDescriptor
+		v  protoreflect.Value
+	}
+	var fields []field
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fields = append(fields, field{fd, v})
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].fd.Number() < fields[j].fd.Number() })
+	for _, f := range fields {
+		b = appendField(b, f.fd, f.v)
+	}
+	return append(b, m.GetUnknown()...)
+}
+
+var wireTypes = map[protoreflect.Kind]protowire.Type{
+	protoreflect.BoolKind:     protowire.VarintType,
+	protoreflect.EnumKind:     protowire.VarintType,
+	protoreflect.Int32Kind:    protowire.VarintType,
+	protoreflect.Sint32Kind:   protowire.VarintType,
+	protoreflect.Uint32Kind:   protowire.VarintType,
+	protoreflect.Int64Kind:    protowire.VarintType,
+	protoreflect.Sint64Kind:   protowire.VarintType,
+	protoreflect.Uint64Kind:   protowire.VarintType,
+	protoreflect.Sfixed32Kind: protowire.Fixed32Type,
+	protoreflect.Fixed32Kind:  protowire.Fixed32Type,
+	protoreflect.FloatKind:    protowire.Fixed32Type,
+	protoreflect.Sfixed64Kind: protowire.Fixed64Type,
+	protoreflect.Fixed64Kind:  protowire.Fixed64Type,
+	protoreflect.DoubleKind:   protowire.Fixed64Type,
+	protoreflect.StringKind:   protowire.BytesType,
+	protoreflect.BytesKind:    protowire.BytesType,
+}
+
+// appendScalar appends a value of a scalar kind, without a tag, to b.
+func appendScalar(b []byte, kind protoreflect.Kind, v protoreflect.Value) []byte {
+	switch kind {
+	case protoreflect.BoolKind:
+		return protowire.AppendVarint(b, protowire.EncodeBool(v.Bool()))
+	case protoreflect.EnumKind:
+		return protowire.AppendVarint(b, uint64(v.Enum()))
+	case protoreflect.Int32Kind, protoreflect.Int64Kind:
+		return protowire.AppendVarint(b, uint64(v.Int()))
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return protowire.AppendVarint(b, protowire.EncodeZigZag(v.Int()))
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		return protowire.AppendVarint(b, v.Uint())
+	case protoreflect.Sfixed32Kind:
+		return protowire.AppendFixed32(b, uint32(v.Int()))
+	case protoreflect.Fixed32Kind:
+		return protowire.AppendFixed32(b, uint32(v.Uint()))
+	case protoreflect.FloatKind:
+		return protowire.AppendFixed32(b, math.Float32bits(float32(v.Float())))
+	case protoreflect.Sfixed64Kind:
+		return protowire.AppendFixed64(b, uint64(v.Int()))
+	case protoreflect.Fixed64Kind:
+		return protowire.AppendFixed64(b, v.Uint())
+	case protoreflect.DoubleKind:
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float()))
+	case protoreflect.StringKind:
+		return protowire.AppendString(b, v.String())
+	default:
+		return protowire.AppendBytes(b, v.Bytes())
+	}
+}
+
+// optionName returns the name of an option as written in the file.
+func optionName(opt proto.Option) string {
+	name := join(opt.Name)
+	if opt.Prefix == nil {
+		return name
+	}
+	if name == "" {
+		return "(" + join(opt.Prefix) + ")"
+	}
+	return "(" + join(opt.Prefix) + ")." + name
+}
+
+// cEscape escapes the bytes of a string as protoc does in default values:
+// non printable ASCII characters and all the bytes that are not ASCII are
+// written in octal.
+func cEscape(s []byte) string {
+	var buf strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '"':
+			buf.WriteString(`\"`)
+		case '\'':
+			buf.WriteString(`\'`)
+		case '\\':
+			buf.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&buf, `\%03o`, c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// formatFloat formats a float with the given number of bits as protoc does
+// in default values, using the shortest of two precisions that keeps the value.
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	short, long := 15, 17
+	if bits == 32 {
+		short, long = 6, 9
+	}
+	s := strconv.FormatFloat(f, 'g', short, bits)
+	if v, err := strconv.ParseFloat(s, bits); err != nil || v != f {
+		s = strconv.FormatFloat(f, 'g', long, bits)
+	}
+	return s
+}
@@ -0,0 +1,275 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"errors"
+
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	// The well-known types are registered in protoregistry.GlobalFiles,
+	// so files can import them without providing their descriptors.
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/apipb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/sourcecontextpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/typepb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+)
+
+// symbols holds the full names of all the definitions visible from a file.
+type symbols struct {
+	kinds  map[string]names.Kind
+	values map[string]map[string]bool // names of the values of each enum.
+}
+
+// collect adds the definitions in the given file to the symbols.
+func (s *symbols) collect(fd *descriptorpb.FileDescriptorProto) {
+	pkg := fd.GetPackage()
+	for scope := pkg; scope != ""; scope = names.Parent(scope) {
+		s.kinds[scope] = names.Package
+	}
+	for _, m := range fd.MessageType {
+		s.message(m, pkg)
+	}
+	for _, e := range fd.EnumType {
+		s.enum(e, pkg)
+	}
+	for _, f := range fd.Extension {
+		s.kinds[names.Qualify(pkg, f.GetName())] = names.Field
+	}
+	for _, svc := range fd.Service {
+		full := names.Qualify(pkg, svc.GetName())
+		s.kinds[full] = names.Service
+		for _, m := range svc.Method {
+			s.kinds[names.Qualify(full, m.GetName())] = names.Method
+		}
+	}
+}
+
+func (s *symbols) message(m *descriptorpb.DescriptorProto, scope string) {
+	full := names.Qualify(scope, m.GetName())
+	s.kinds[full] = names.Message
+	for _, f := range m.Field {
+		s.kinds[names.Qualify(full, f.GetName())] = names.Field
+	}
+	for _, o := range m.OneofDecl {
+		s.kinds[names.Qualify(full, o.GetName())] = names.Oneof
+	}
+	for _, f := range m.Extension {
+		s.kinds[names.Qualify(full, f.GetName())] = names.Field
+	}
+	for _, n := range m.NestedType {
+		s.message(n, full)
+	}
+	for _, e := range m.EnumType {
+		s.enum(e, full)
+	}
+}
+
+// enum adds an enum and its values, which are defined in the same scope
+// as the enum itself, and not inside of it.
+func (s *symbols) enum(e *descriptorpb.EnumDescriptorProto, scope string) {
+	full := names.Qualify(scope, e.GetName())
+	s.kinds[full] = names.Enum
+	s.values[full] = map[string]bool{}
+	for _, v := range e.Value {
+		s.kinds[names.Qualify(scope, v.GetName())] = names.EnumValue
+		s.values[full][v.GetName()] = true
+	}
+}
+
+// lookup returns the full name and kind of the definition a name refers to
+// from the given scope. If typesOnly is true, definitions that are not types
+// are skipped.
+func (s *symbols) lookup(scope, name string, typesOnly bool) (string, names.Kind, error) {
+	full, err := names.Lookup(scope, name, typesOnly, func(full string) (names.Kind, bool) {
+		kind, ok := s.kinds[full]
+		return kind, ok
+	})
+	return full, s.kinds[full], err
+}
+
+// A ref is a reference to a message or enum, which can only be resolved once
+// all the definitions in the file are known.
+type ref struct {
+	scope     string
+	typ       proto.Type
+	typesOnly bool
+	set       func(full string, kind names.Kind)
+}
+
+func (b *builder) addRef(scope string, typ proto.Type, typesOnly bool, set func(full string, kind names.Kind)) {
+	b.refs = append(b.refs, ref{scope, typ, typesOnly, set})
+}
+
+// resolve resolves all the references to types in the file, using the
+// definitions in the file and in the files it imports.
+func (b *builder) resolve() {
+	b.syms = symbols{kinds: map[string]names.Kind{}, values: map[string]map[string]bool{}}
+	b.syms.collect(b.fd)
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		fd := b.imports.descriptor(name)
+		if fd == nil {
+			return
+		}
+		b.syms.collect(fd)
+		// Definitions in files imported publicly are visible too.
+		for _, i := range fd.PublicDependency {
+			if int(i) < len(fd.Dependency) {
+				visit(fd.Dependency[i])
+			}
+		}
+	}
+	for _, dep := range b.fd.Dependency {
+		visit(dep)
+	}
+
+	for _, r := range b.refs {
+		full, kind, err := b.syms.lookup(r.scope, typeName(r.typ), r.typesOnly)
+		if err != nil {
+			b.errorf(r.typ.Pos, "%v", err)
+		}
+		if r.typesOnly && !kind.IsType() {
+			b.errorf(r.typ.Pos, "%s is not a type", typeName(r.typ))
+		}
+		r.set(full, kind)
+	}
+}
+
+// imports holds the descriptors of the files imported by a file, which
+// are needed to resolve names and to interpret custom options.
+type imports struct {
+	files    map[string]*descriptorpb.FileDescriptorProto
+	registry *protoregistry.Files
+}
+
+// loadImports registers the files imported by the file being built, and
+// the files they import, reporting files that can't be found.
+func (b *builder) loadImports(fds []*descriptorpb.FileDescriptorProto) {
+	b.imports = &imports{
+		files:    map[string]*descriptorpb.FileDescriptorProto{},
+		registry: new(protoregistry.Files),
+	}
+	for _, fd := range fds {
+		b.imports.files[fd.GetName()] = fd
+	}
+	pending := map[string]bool{}
+	for _, imp := range b.file.Imports {
+		if err := b.imports.register(imp.Path, pending); err != nil {
+			b.errorf(imp.Pos, "%v", err)
+		}
+	}
+}
+
+// newFile returns a copy of a file descriptor that can be used to create a
+// protoreflect.FileDescriptor. Message sets are not supported by
+// protodesc, so they're turned into regular messages, which makes no
+// difference when interpreting options.
+func newFile(fd *descriptorpb.FileDescriptorProto) *descriptorpb.FileDescriptorProto {
+	fd = protobuf.Clone(fd).(*descriptorpb.FileDescriptorProto)
+	var clear func(msgs []*descriptorpb.DescriptorProto)
+	clear = func(msgs []*descriptorpb.DescriptorProto) {
+		for _, m := range msgs {
+			if m.GetOptions().GetMessageSetWireFormat() {
+				m.Options.MessageSetWireFormat = nil
+				for _, r := range m.ExtensionRange {
+					if r.GetEnd() > proto.MaxFieldNumber+1 {
+						r.End = protobuf.Int32(proto.MaxFieldNumber + 1)
+					}
+				}
+				for _, r := range m.ReservedRange {
+					if r.GetEnd() > proto.MaxFieldNumber+1 {
+						r.End = protobuf.Int32(proto.MaxFieldNumber + 1)
+					}
+				}
+			}
+			clear(m.NestedType)
+		}
+	}
+	clear(fd.MessageType)
+	return fd
+}
+
+// descriptor returns the descriptor of an imported file, or nil if not found.
+func (im *imports) descriptor(name string) *descriptorpb.FileDescriptorProto {
+	if fd, ok := im.files[name]; ok {
+		return fd
+	}
+	if fd, err := im.registry.FindFileByPath(name); err == nil {
+		return protodesc.ToFileDescriptorProto(fd)
+	}
+	return nil
+}
+
+// register adds the file with the given name, and the files it imports, to
+// the registry. Files being registered are pending, which is used to detect
+// import cycles.
+func (im *imports) register(name string, pending map[string]bool) error {
+	if _, err := im.registry.FindFileByPath(name); err == nil {
+		return nil
+	}
+	if pending[name] {
+		return errors.New("import cycle found with " + name)
+	}
+
+	var file protoreflect.FileDescriptor
+	if fd, ok := im.files[name]; ok {
+		pending[name] = true
+		for _, dep := range fd.Dependency {
+			if err := im.register(dep, pending); err != nil {
+				return err
+			}
+		}
+		delete(pending, name)
+		f, err := protodesc.FileOptions{AllowUnresolvable: true}.New(newFile(fd), im.registry)
+		if err != nil {
+			return errors.New("invalid descriptor for " + name + ": " + err.Error())
+		}
+		file = f
+	} else {
+		f, err := protoregistry.GlobalFiles.FindFileByPath(name)
+		if err != nil {
+			return errors.New("file not found: " + name)
+		}
+		imports := f.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := im.register(imports.Get(i).Path(), pending); err != nil {
+				return err
+			}
+		}
+		file = f
+	}
+	if err := im.registry.RegisterFile(file); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,859 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// FromDescriptor returns the file described by a descriptor, which is the
+// reverse of ToDescriptor.
+//
+// Type names are fully qualified, and custom options are named after the
+// extensions defined in the file, in the given imports, or in the files in
+// protoregistry.GlobalFiles. Custom options whose extension can't be found
+// make it fail with an *Error naming the number of their field.
+//
+// If the descriptor has a SourceCodeInfo, the comments are attached to the
+// nodes, which also get the lines and columns of their locations, but no
+// offsets. Otherwise, nodes have invalid spans, and ToDescriptor puts
+// declarations of the same kind together, and options in field number
+// order.
+func FromDescriptor(fd *descriptorpb.FileDescriptorProto, imports ...*descriptorpb.FileDescriptorProto) (f *proto.File, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			e, ok := rec.(*Error)
+			if !ok {
+				panic(rec)
+			}
+			f, err = nil, e
+		}
+	}()
+
+	c := &converter{fd: fd, locs: map[string][]*descriptorpb.SourceCodeInfo_Location{}}
+	for _, loc := range fd.GetSourceCodeInfo().GetLocation() {
+		key := fmt.Sprint(loc.Path)
+		c.locs[key] = append(c.locs[key], loc)
+	}
+	c.loadTypes(imports)
+	return c.file(), nil
+}
+
+// A converter builds a file from its descriptor.
+type converter struct {
+	fd    *descriptorpb.FileDescriptorProto
+	locs  map[string][]*descriptorpb.SourceCodeInfo_Location // indexed by path.
+	types *dynamicpb.Types                                   // used to find the extensions in options.
+}
+
+func (c *converter) errorf(format string, args ...interface{}) {
+	panic(&Error{Pos: token.Position{Filename: c.fd.GetName()}, Msg: fmt.Sprintf(format, args...)})
+}
+
+// loadTypes registers the file and its imports, so the extensions used in
+// custom options can be found. Files that can't be registered are ignored,
+// which only makes their extensions unknown.
+func (c *converter) loadTypes(fds []*descriptorpb.FileDescriptorProto) {
+	im := &imports{
+		files:    map[string]*descriptorpb.FileDescriptorProto{},
+		registry: new(protoregistry.Files),
+	}
+	for _, fd := range fds {
+		im.files[fd.GetName()] = fd
+	}
+	for _, dep := range c.fd.Dependency {
+		im.register(dep, map[string]bool{})
+	}
+	if f, err := (protodesc.FileOptions{AllowUnresolvable: true}).New(newFile(c.fd), im.registry); err == nil {
+		im.registry.RegisterFile(f)
+	}
+	c.types = dynamicpb.NewTypes(im.registry)
+}
+
+// node returns the span and comments of the location with the given path.
+// If there are many, n is the index of the one to use.
+func (c *converter) node(p []int32, n int) (proto.Span, proto.Comments) {
+	locs := c.locs[fmt.Sprint(p)]
+	if n >= len(locs) {
+		return proto.Span{}, proto.Comments{}
+	}
+	loc := locs[n]
+	return c.span(loc), proto.Comments{
+		LeadingDetachedComments: loc.LeadingDetachedComments,
+		LeadingComments:         loc.GetLeadingComments(),
+		TrailingComment:         loc.GetTrailingComments(),
+	}
+}
+
+// optionNode is like node for the option with the given path. Options set
+// through their sub-fields, such as option (a).b = 1, only have locations
+// for those, whose paths start with the path of the option: the first one
+// is used then.
+func (c *converter) optionNode(p []int32) (proto.Span, proto.Comments) {
+	if _, ok := c.locs[fmt.Sprint(p)]; ok {
+		return c.node(p, 0)
+	}
+	for _, loc := range c.fd.GetSourceCodeInfo().GetLocation() {
+		if len(loc.Path) > len(p) && fmt.Sprint(loc.Path[:len(p)]) == fmt.Sprint(p) {
+			return c.node(loc.Path, 0)
+		}
+	}
+	return proto.Span{}, proto.Comments{}
+}
+
+// span returns the span of a location, without offsets.
+func (c *converter) span(loc *descriptorpb.SourceCodeInfo_Location) proto.Span {
+	s := loc.Span
+	if len(s) == 3 {
+		s = []int32{s[0], s[1], s[0], s[2]}
+	}
+	if len(s) != 4 {
+		return proto.Span{}
+	}
+	name := c.fd.GetName()
+	return proto.Span{
+		Pos: token.Position{Filename: name, Line: int(s[0]) + 1, Column: int(s[1]) + 1},
+		End: token.Position{Filename: name, Line: int(s[2]) + 1, Column: int(s[3]) + 1},
+	}
+}
+
+// statements groups the n elements with paths p+[i], such as extension
+// ranges, into the statements they were declared in, which share the path
+// p. Without source information, consecutive elements for which same
+// returns true are grouped.
+func (c *converter) statements(p []int32, n int, same func(i, j int) bool) [][]int {
+	stmts := c.locs[fmt.Sprint(p)]
+	var res [][]int
+	last := -1
+	for i := 0; i < n; i++ {
+		stmt := -1
+		if locs := c.locs[fmt.Sprint(path(p, i))]; len(locs) > 0 {
+			for k, s := range stmts {
+				if contains(c.span(s), c.span(locs[0])) {
+					stmt = k
+					break
+				}
+			}
+		}
+		switch {
+		case len(res) == 0:
+		case stmt >= 0 && stmt == last:
+			res[len(res)-1] = append(res[len(res)-1], i)
+			continue
+		case stmt < 0 && len(stmts) == 0 && same(res[len(res)-1][0], i):
+			res[len(res)-1] = append(res[len(res)-1], i)
+			continue
+		}
+		res = append(res, []int{i})
+		last = stmt
+	}
+	return res
+}
+
+func contains(outer, inner proto.Span) bool {
+	before := func(a, b token.Position) bool {
+		return a.Line < b.Line || a.Line == b.Line && a.Column <= b.Column
+	}
+	return outer.Pos.IsValid() && before(outer.Pos, inner.Pos) && before(inner.End, outer.End)
+}
+
+// statement returns the span and comments of the statement with path p
+// containing the element with path p+[i].
+func (c *converter) statement(p []int32, i int) (proto.Span, proto.Comments) {
+	if locs := c.locs[fmt.Sprint(path(p, i))]; len(locs) > 0 {
+		for k, s := range c.locs[fmt.Sprint(p)] {
+			if contains(c.span(s), c.span(locs[0])) {
+				return c.node(p, k)
+			}
+		}
+	}
+	return proto.Span{}, proto.Comments{}
+}
+
+func (c *converter) file() *proto.File {
+	fd := c.fd
+	f := &proto.File{}
+	f.Span, _ = c.node(nil, 0)
+	f.Pos.Filename = fd.GetName()
+
+	f.Syntax.Value = proto.Proto2
+	switch fd.GetSyntax() {
+	case "", proto.Proto2:
+		// Files without a syntax statement use proto2.
+		if _, ok := c.locs[fmt.Sprint(path(nil, fileSyntaxTag))]; ok {
+			f.Syntax.Span, f.Syntax.Comments = c.node(path(nil, fileSyntaxTag), 0)
+		}
+	case proto.Proto3:
+		f.Syntax.Value = proto.Proto3
+		f.Syntax.Span, f.Syntax.Comments = c.node(path(nil, fileSyntaxTag), 0)
+	case proto.Editions:
+		f.Syntax.Value = proto.Editions
+		f.Edition.Value = strings.TrimPrefix(fd.GetEdition().String(), "EDITION_")
+		f.Edition.Span, f.Edition.Comments = c.node(path(nil, fileEditionTag), 0)
+	default:
+		c.errorf("unknown syntax %q", fd.GetSyntax())
+	}
+
+	if pkg := fd.GetPackage(); pkg != "" {
+		f.Package.Span, f.Package.Comments = c.node(path(nil, filePackageTag), 0)
+		f.Package.Identifier = split(pkg)
+	}
+	for i, dep := range fd.Dependency {
+		imp := proto.Import{Path: dep}
+		imp.Span, imp.Comments = c.node(path(nil, fileDependencyTag, i), 0)
+		for _, j := range fd.PublicDependency {
+			if int(j) == i {
+				imp.Modifier = proto.PublicImport
+			}
+		}
+		for _, j := range fd.WeakDependency {
+			if int(j) == i {
+				imp.Modifier = proto.WeakImport
+			}
+		}
+		f.Imports = append(f.Imports, imp)
+	}
+	f.Options = c.options(fd.Options, path(nil, fileOptionsTag))
+
+	groups := c.groups(fd.GetPackage(), fd.Extension)
+	for i, m := range fd.MessageType {
+		p := path(nil, fileMessagesTag, i)
+		if _, ok := groups[m.GetName()]; !ok {
+			f.Messages = append(f.Messages, c.message(m, fd.GetPackage(), p))
+		}
+	}
+	for i, e := range fd.EnumType {
+		f.Enums = append(f.Enums, c.enum(e, path(nil, fileEnumsTag, i)))
+	}
+	for i, s := range fd.Service {
+		f.Services = append(f.Services, c.service(s, path(nil, fileServicesTag, i)))
+	}
+	f.Extends = c.extends(fd.Extension, fd.GetPackage(), path(nil, fileExtensionsTag), fd.MessageType, path(nil, fileMessagesTag))
+	return f
+}
+
+// groups returns the names of the messages of the groups among the given
+// fields, defined in the given scope.
+func (c *converter) groups(scope string, fields []*descriptorpb.FieldDescriptorProto) map[string]bool {
+	groups := map[string]bool{}
+	if c.fd.GetSyntax() != "" && c.fd.GetSyntax() != proto.Proto2 {
+		return groups
+	}
+	for _, f := range fields {
+		if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			name := strings.TrimPrefix(f.GetTypeName(), ".")
+			if names.Parent(name) == scope {
+				groups[name[strings.LastIndexByte(name, '.')+1:]] = true
+			}
+		}
+	}
+	return groups
+}
+
+// message returns the message with the given descriptor, defined in scope.
+func (c *converter) message(m *descriptorpb.DescriptorProto, scope string, p []int32) proto.Message {
+	full := names.Qualify(scope, m.GetName())
+	msg := proto.Message{Name: proto.Identifier(m.GetName())}
+	msg.Span, msg.Comments = c.node(p, 0)
+	msg.Options = c.options(m.Options, path(p, messageOptionsTag))
+
+	// Map entries and the messages of groups are defined by their fields.
+	nested := map[string]int{}
+	for i, n := range m.NestedType {
+		nested[names.Qualify(full, n.GetName())] = i
+	}
+	groups := c.groups(full, append(append([]*descriptorpb.FieldDescriptorProto(nil), m.Field...), m.Extension...))
+	entries := map[string]bool{}
+
+	synthetic := map[int32]bool{}
+	for _, f := range m.Field {
+		if f.GetProto3Optional() {
+			synthetic[f.GetOneofIndex()] = true
+		}
+	}
+	oneofs := map[int32]int{}
+	for i, o := range m.OneofDecl {
+		if synthetic[int32(i)] {
+			continue
+		}
+		oneof := proto.OneOf{Name: proto.Identifier(o.GetName())}
+		oneof.Span, oneof.Comments = c.node(path(p, messageOneofsTag, i), 0)
+		oneofs[int32(i)] = len(msg.OneOfs)
+		msg.OneOfs = append(msg.OneOfs, oneof)
+	}
+
+	for i, f := range m.Field {
+		fp := path(p, messageFieldsTag, i)
+		if k, ok := oneofs[f.GetOneofIndex()]; ok && f.OneofIndex != nil {
+			field := c.field(f, fp, m.NestedType, path(p, messageNestedTag))
+			msg.OneOfs[k].Fields = append(msg.OneOfs[k].Fields, proto.OneOfField{
+				Span:     field.Span,
+				Comments: field.Comments,
+				Type:     field.Type,
+				Name:     field.Name,
+				Number:   field.Number,
+				Options:  field.Options,
+				Group:    field.Group,
+			})
+			continue
+		}
+		if i, ok := nested[strings.TrimPrefix(f.GetTypeName(), ".")]; ok && m.NestedType[i].GetOptions().GetMapEntry() &&
+			f.GetLabel() == descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+			entries[m.NestedType[i].GetName()] = true
+			msg.Maps = append(msg.Maps, c.mapField(f, m.NestedType[i], fp))
+			continue
+		}
+		msg.Fields = append(msg.Fields, c.field(f, fp, m.NestedType, path(p, messageNestedTag)))
+	}
+
+	for i, n := range m.NestedType {
+		if !entries[n.GetName()] && !groups[n.GetName()] {
+			msg.Messages = append(msg.Messages, c.message(n, full, path(p, messageNestedTag, i)))
+		}
+	}
+	for i, e := range m.EnumType {
+		msg.Enums = append(msg.Enums, c.enum(e, path(p, messageEnumsTag, i)))
+	}
+	msg.Extends = c.extends(m.Extension, full, path(p, messageExtensionsTag), m.NestedType, path(p, messageNestedTag))
+
+	rp := path(p, messageExtensionRangeTag)
+	same := func(i, j int) bool {
+		return protobuf.Equal(m.ExtensionRange[i].Options, m.ExtensionRange[j].Options)
+	}
+	for _, stmt := range c.statements(rp, len(m.ExtensionRange), same) {
+		r := proto.ExtensionRange{
+			Options: c.options(m.ExtensionRange[stmt[0]].Options, path(rp, stmt[0], extensionRangeOptionsTag)),
+		}
+		r.Span, r.Comments = c.statement(rp, stmt[0])
+		for _, i := range stmt {
+			rng := m.ExtensionRange[i]
+			r.Ranges = append(r.Ranges, c.fieldRange(rng.GetStart(), rng.GetEnd(), m, path(rp, i)))
+		}
+		msg.Extensions = append(msg.Extensions, r)
+	}
+
+	rp = path(p, messageReservedRangeTag)
+	for _, stmt := range c.statements(rp, len(m.ReservedRange), func(i, j int) bool { return true }) {
+		var r proto.Reserved
+		r.Span, r.Comments = c.statement(rp, stmt[0])
+		for _, i := range stmt {
+			rng := m.ReservedRange[i]
+			r.Ranges = append(r.Ranges, c.fieldRange(rng.GetStart(), rng.GetEnd(), m, path(rp, i)))
+		}
+		msg.Reserveds = append(msg.Reserveds, r)
+	}
+	msg.Reserveds = append(msg.Reserveds, c.reservedNames(m.ReservedName, path(p, messageReservedNameTag))...)
+	return msg
+}
+
+// fieldRange returns a range of field numbers of a message, whose end is
+// exclusive in descriptors.
+func (c *converter) fieldRange(start, end int32, m *descriptorpb.DescriptorProto, p []int32) proto.Range {
+	r := proto.Range{From: int(start), To: int(end) - 1}
+	if end == math.MaxInt32 && m.GetOptions().GetMessageSetWireFormat() {
+		r.To = proto.MaxFieldNumber
+	}
+	r.Span, _ = c.node(p, 0)
+	return r
+}
+
+// reservedNames returns the reserved statements for the given names.
+func (c *converter) reservedNames(names []string, p []int32) []proto.Reserved {
+	var res []proto.Reserved
+	for _, stmt := range c.statements(p, len(names), func(i, j int) bool { return true }) {
+		var r proto.Reserved
+		r.Span, r.Comments = c.statement(p, stmt[0])
+		for _, i := range stmt {
+			r.Names = append(r.Names, names[i])
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// field returns the field with the given descriptor. If it's a group, its
+// message is found in msgs, whose path is msgsPath.
+func (c *converter) field(f *descriptorpb.FieldDescriptorProto, p []int32, msgs []*descriptorpb.DescriptorProto, msgsPath []int32) proto.Field {
+	field := proto.Field{
+		Name:   proto.Identifier(f.GetName()),
+		Number: int(f.GetNumber()),
+	}
+	field.Span, field.Comments = c.node(p, 0)
+
+	syntax := c.fd.GetSyntax()
+	switch f.GetLabel() {
+	case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		field.Label = proto.RepeatedLabel
+	case descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+		if syntax == "" || syntax == proto.Proto2 {
+			field.Label = proto.RequiredLabel
+		}
+	default:
+		if syntax == "" || syntax == proto.Proto2 {
+			field.Label = proto.OptionalLabel
+		}
+		if f.GetProto3Optional() {
+			field.Label = proto.OptionalLabel
+		}
+	}
+	if f.OneofIndex != nil && !f.GetProto3Optional() {
+		field.Label = proto.NoLabel
+	}
+	field.Type = c.fieldType(f)
+
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP && (syntax == "" || syntax == proto.Proto2) {
+		name := f.GetTypeName()[strings.LastIndexByte(f.GetTypeName(), '.')+1:]
+		for i, m := range msgs {
+			if m.GetName() == name {
+				scope := names.Parent(strings.TrimPrefix(f.GetTypeName(), "."))
+				group := c.message(m, scope, path(msgsPath, i))
+				// The comments of a group are attached to its message.
+				field.Group = &group
+				field.Type = proto.Type{UserDefined: []proto.Identifier{proto.Identifier(name)}}
+				break
+			}
+		}
+		if field.Group == nil {
+			c.errorf("message of group %s not found", f.GetName())
+		}
+	}
+
+	if f.DefaultValue != nil {
+		field.Options = append(field.Options, proto.Option{
+			Name:  []proto.Identifier{"default"},
+			Value: c.defaultValue(f),
+		})
+	}
+	if f.JsonName != nil && f.GetJsonName() != proto.JSONName(f.GetName()) {
+		field.Options = append(field.Options, proto.Option{
+			Name:  []proto.Identifier{"json_name"},
+			Value: f.GetJsonName(),
+		})
+	}
+	field.Options = append(field.Options, c.options(f.Options, path(p, fieldOptionsTag))...)
+	return field
+}
+
+// fieldType returns the type of a field. Message and enum types are fully
+// qualified, unless they were not resolved in the descriptor.
+func (c *converter) fieldType(f *descriptorpb.FieldDescriptorProto) proto.Type {
+	for typ, t := range scalarTypes {
+		if t == f.GetType() && f.Type != nil {
+			return proto.Type{Predefined: typ}
+		}
+	}
+	name := f.GetTypeName()
+	if name == "" {
+		c.errorf("field %s has no type", f.GetName())
+	}
+	return proto.Type{
+		UserDefined:    split(strings.TrimPrefix(name, ".")),
+		FullyQualified: strings.HasPrefix(name, "."),
+	}
+}
+
+// param returns the input or output of a method with the given type name.
+func (c *converter) param(name string, stream bool) proto.RPCParam {
+	return proto.RPCParam{
+		Stream:         stream,
+		Type:           split(strings.TrimPrefix(name, ".")),
+		FullyQualified: strings.HasPrefix(name, "."),
+	}
+}
+
+// mapField returns the map field with the given descriptor and map entry.
+func (c *converter) mapField(f *descriptorpb.FieldDescriptorProto, entry *descriptorpb.DescriptorProto, p []int32) proto.Map {
+	m := proto.Map{
+		Name:    proto.Identifier(f.GetName()),
+		Number:  int(f.GetNumber()),
+		Options: c.options(f.Options, path(p, fieldOptionsTag)),
+	}
+	m.Span, m.Comments = c.node(p, 0)
+	for _, ef := range entry.Field {
+		switch ef.GetNumber() {
+		case 1:
+			m.KeyType = c.fieldType(ef)
+		case 2:
+			m.ValueType = c.fieldType(ef)
+		}
+	}
+	if f.JsonName != nil && f.GetJsonName() != proto.JSONName(f.GetName()) {
+		m.Options = append([]proto.Option{{Name: []proto.Identifier{"json_name"}, Value: f.GetJsonName()}}, m.Options...)
+	}
+	return m
+}
+
+// extends returns the extend blocks declaring the given extensions, whose
+// path is p. The messages of groups are found in msgs.
+func (c *converter) extends(exts []*descriptorpb.FieldDescriptorProto, scope string, p []int32,
+	msgs []*descriptorpb.DescriptorProto, msgsPath []int32) []proto.Extend {
+	var res []proto.Extend
+	same := func(i, j int) bool { return exts[i].GetExtendee() == exts[j].GetExtendee() }
+	for _, stmt := range c.statements(p, len(exts), same) {
+		e := proto.Extend{Type: c.fieldType(&descriptorpb.FieldDescriptorProto{
+			Name:     exts[stmt[0]].Name,
+			TypeName: exts[stmt[0]].Extendee,
+		})}
+		e.Span, e.Comments = c.statement(p, stmt[0])
+		for _, i := range stmt {
+			e.Fields = append(e.Fields, c.field(exts[i], path(p, i), msgs, msgsPath))
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+// enum returns the enum with the given descriptor.
+func (c *converter) enum(e *descriptorpb.EnumDescriptorProto, p []int32) proto.Enum {
+	enum := proto.Enum{
+		Name:    proto.Identifier(e.GetName()),
+		Options: c.options(e.Options, path(p, enumOptionsTag)),
+	}
+	enum.Span, enum.Comments = c.node(p, 0)
+	for i, v := range e.Value {
+		vp := path(p, enumValuesTag, i)
+		f := proto.EnumField{
+			Name:    proto.Identifier(v.GetName()),
+			Number:  int(v.GetNumber()),
+			Options: c.options(v.Options, path(vp, enumValueOptionsTag)),
+		}
+		f.Span, f.Comments = c.node(vp, 0)
+		enum.Fields = append(enum.Fields, f)
+	}
+
+	rp := path(p, enumReservedRangeTag)
+	for _, stmt := range c.statements(rp, len(e.ReservedRange), func(i, j int) bool { return true }) {
+		var r proto.Reserved
+		r.Span, r.Comments = c.statement(rp, stmt[0])
+		for _, i := range stmt {
+			rng := proto.Range{From: int(e.ReservedRange[i].GetStart()), To: int(e.ReservedRange[i].GetEnd())}
+			rng.Span, _ = c.node(path(rp, i), 0)
+			r.Ranges = append(r.Ranges, rng)
+		}
+		enum.Reserveds = append(enum.Reserveds, r)
+	}
+	enum.Reserveds = append(enum.Reserveds, c.reservedNames(e.ReservedName, path(p, enumReservedNameTag))...)
+	return enum
+}
+
+// service returns the service with the given descriptor.
+func (c *converter) service(s *descriptorpb.ServiceDescriptorProto, p []int32) proto.Service {
+	svc := proto.Service{
+		Name:    proto.Identifier(s.GetName()),
+		Options: c.options(s.Options, path(p, serviceOptionsTag)),
+	}
+	svc.Span, svc.Comments = c.node(p, 0)
+	for i, m := range s.Method {
+		mp := path(p, serviceMethodsTag, i)
+		rpc := proto.RPC{
+			Name:    proto.Identifier(m.GetName()),
+			In:      c.param(m.GetInputType(), m.GetClientStreaming()),
+			Out:     c.param(m.GetOutputType(), m.GetServerStreaming()),
+			Options: c.options(m.Options, path(mp, methodOptionsTag)),
+			Body:    m.Options != nil,
+		}
+		rpc.Span, rpc.Comments = c.node(mp, 0)
+		svc.RPCs = append(svc.RPCs, rpc)
+	}
+	return svc
+}
+
+// options returns the options set in an options message, whose path is p.
+// Repeated options are set once for each value, and custom options are
+// named after their extension.
+func (c *converter) options(opts protobuf.Message, p []int32) []proto.Option {
+	if opts == nil || !opts.ProtoReflect().IsValid() {
+		return nil
+	}
+	// Decoding the options again resolves the extensions, which are
+	// usually unknown fields.
+	b, err := protobuf.MarshalOptions{Deterministic: true}.Marshal(opts)
+	if err != nil {
+		c.errorf("invalid options: %v", err)
+	}
+	msg := opts.ProtoReflect().New()
+	if err := (protobuf.UnmarshalOptions{Resolver: c.types}).Unmarshal(b, msg.Interface()); err != nil {
+		c.errorf("invalid options: %v", err)
+	}
+	if unknown := msg.GetUnknown(); len(unknown) > 0 {
+		num, _, n := protowire.ConsumeTag(unknown)
+		if n < 0 {
+			c.errorf("invalid options: %v", protowire.ParseError(n))
+		}
+		c.errorf("unknown custom option: no extension of %s with number %d was found", msg.Descriptor().FullName(), num)
+	}
+
+	var res []proto.Option
+	for _, f := range sortedFields(msg) {
+		fd, v := f.fd, f.v
+		if fd.Name() == "map_entry" || fd.Name() == "uninterpreted_option" {
+			continue
+		}
+		opt := proto.Option{Name: []proto.Identifier{proto.Identifier(fd.Name())}}
+		if fd.IsExtension() {
+			opt = proto.Option{Prefix: split(string(fd.FullName()))}
+		}
+		op := path(p, int(fd.Number()))
+		if !fd.IsList() {
+			opt.Span, opt.Comments = c.optionNode(op)
+			opt.Value = c.value(fd, v)
+			res = append(res, opt)
+			continue
+		}
+		for i := 0; i < v.List().Len(); i++ {
+			opt := opt
+			opt.Span, opt.Comments = c.node(path(op, i), 0)
+			opt.Value = c.value(fd, v.List().Get(i))
+			res = append(res, opt)
+		}
+	}
+	return res
+}
+
+type field struct {
+	fd protoreflect.FieldDescriptor
+	v  protoreflect.Value
+}
+
+// sortedFields returns the fields set in a message, sorted by number.
+func sortedFields(m protoreflect.Message) []field {
+	var fields []field
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fields = append(fields, field{fd, v})
+		return true
+	})
+	sort.Slice(fields, func(i, j int) bool { return fields[i].fd.Number() < fields[j].fd.Number() })
+	return fields
+}
+
+// value returns a single value of a field as the value of an option.
+func (c *converter) value(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return []proto.Identifier{proto.Identifier(ev.Name())}
+		}
+		return intNumber(int64(v.Enum()))
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return intNumber(v.Int())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return proto.Number{Kind: proto.UintNumber, Text: strconv.FormatUint(u, 10), Uint: u}
+		}
+		return intNumber(int64(v.Uint()))
+	case protoreflect.FloatKind:
+		return floatNumber(v.Float(), 32)
+	case protoreflect.DoubleKind:
+		return floatNumber(v.Float(), 64)
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return string(v.Bytes())
+	default:
+		return c.aggregate(v.Message())
+	}
+}
+
+// aggregate returns the value of an option of a message type.
+func (c *converter) aggregate(m protoreflect.Message) proto.Aggregate {
+	var agg proto.Aggregate
+	for _, f := range sortedFields(m) {
+		fd, v := f.fd, f.v
+		af := proto.AggregateField{Name: []proto.Identifier{proto.Identifier(fd.Name())}}
+		switch {
+		case fd.IsExtension():
+			af.Name, af.Extension = split(string(fd.FullName())), true
+		case fd.Kind() == protoreflect.GroupKind:
+			af.Name = []proto.Identifier{proto.Identifier(fd.Message().Name())}
+		}
+		switch {
+		case fd.IsList():
+			var l proto.List
+			for i := 0; i < v.List().Len(); i++ {
+				l.Values = append(l.Values, c.value(fd, v.List().Get(i)))
+			}
+			af.Value = l
+		case fd.IsMap():
+			var entries []field
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				entries = append(entries, field{v: k.Value()}, field{v: v})
+				return true
+			})
+			var l proto.List
+			for i := 0; i < len(entries); i += 2 {
+				l.Values = append(l.Values, proto.Aggregate{Fields: []proto.AggregateField{
+					{Name: []proto.Identifier{"key"}, Value: c.value(fd.MapKey(), entries[i].v)},
+					{Name: []proto.Identifier{"value"}, Value: c.value(fd.MapValue(), entries[i+1].v)},
+				}})
+			}
+			sort.SliceStable(l.Values, func(i, j int) bool {
+				return lessKey(entries[2*i].v.MapKey(), entries[2*j].v.MapKey())
+			})
+			af.Value = l
+		default:
+			af.Value = c.value(fd, v)
+		}
+		agg.Fields = append(agg.Fields, af)
+	}
+	return agg
+}
+
+// defaultValue returns the default value of a field, as written in a file.
+func (c *converter) defaultValue(f *descriptorpb.FieldDescriptorProto) interface{} {
+	s := f.GetDefaultValue()
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+		return s
+	case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+		b, err := cUnescape(s)
+		if err != nil {
+			c.errorf("invalid default value of %s: %v", f.GetName(), err)
+		}
+		return string(b)
+	case descriptorpb.FieldDescriptorProto_TYPE_BOOL:
+		return s == "true"
+	case descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return []proto.Identifier{proto.Identifier(s)}
+	case descriptorpb.FieldDescriptorProto_TYPE_FLOAT, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE:
+		switch s {
+		case "inf", "-inf":
+			return proto.Number{Kind: proto.InfNumber, Text: s, Float: math.Inf(strings.Count(s, "-")*-2 + 1)}
+		case "nan", "-nan":
+			return proto.Number{Kind: proto.NaNNumber, Text: s, Float: math.NaN()}
+		}
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			c.errorf("invalid default value of %s: %v", f.GetName(), err)
+		}
+		return proto.Number{Kind: proto.FloatNumber, Text: s, Float: v}
+	case descriptorpb.FieldDescriptorProto_TYPE_UINT32, descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+		descriptorpb.FieldDescriptorProto_TYPE_FIXED32, descriptorpb.FieldDescriptorProto_TYPE_FIXED64:
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			c.errorf("invalid default value of %s: %v", f.GetName(), err)
+		}
+		if v > math.MaxInt64 {
+			return proto.Number{Kind: proto.UintNumber, Text: s, Uint: v}
+		}
+		return proto.Number{Kind: proto.IntNumber, Text: s, Int: int64(v)}
+	default:
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			c.errorf("invalid default value of %s: %v", f.GetName(), err)
+		}
+		return proto.Number{Kind: proto.IntNumber, Text: s, Int: v}
+	}
+}
+
+func intNumber(v int64) proto.Number {
+	return proto.Number{Kind: proto.IntNumber, Text: strconv.FormatInt(v, 10), Int: v}
+}
+
+// floatNumber returns a float with the given number of bits as a Number,
+// written with as few digits as needed to keep its value.
+func floatNumber(v float64, bits int) proto.Number {
+	switch {
+	case math.IsInf(v, 1):
+		return proto.Number{Kind: proto.InfNumber, Text: "inf", Float: v}
+	case math.IsInf(v, -1):
+		return proto.Number{Kind: proto.InfNumber, Text: "-inf", Float: v}
+	case math.IsNaN(v):
+		return proto.Number{Kind: proto.NaNNumber, Text: "nan", Float: v}
+	}
+	return proto.Number{Kind: proto.FloatNumber, Text: strconv.FormatFloat(v, 'g', -1, bits), Float: v}
+}
+
+// cUnescape reverses cEscape, decoding the escape sequences protoc uses
+// in default values.
+func cUnescape(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return nil, fmt.Errorf("invalid escape sequence at the end of %q", s)
+		}
+		switch c := s[i]; c {
+		case 'a':
+			b = append(b, '\a')
+		case 'b':
+			b = append(b, '\b')
+		case 'f':
+			b = append(b, '\f')
+		case 'n':
+			b = append(b, '\n')
+		case 'r':
+			b = append(b, '\r')
+		case 't':
+			b = append(b, '\t')
+		case 'v':
+			b = append(b, '\v')
+		case 'x', 'X':
+			j := i + 1
+			for j < len(s) && j < i+3 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i+1:j], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex escape in %q", s)
+			}
+			b = append(b, byte(v))
+			i = j - 1
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			j := i
+			for j < len(s) && j < i+3 && '0' <= s[j] && s[j] <= '7' {
+				j++
+			}
+			v, err := strconv.ParseUint(s[i:j], 8, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid octal escape in %q", s)
+			}
+			b = append(b, byte(v))
+			i = j - 1
+		default:
+			b = append(b, c)
+		}
+	}
+	return b, nil
+}
+
+// split returns the identifiers in a full name.
+func split(name string) []proto.Identifier {
+	var ids []proto.Identifier
+	for _, s := range strings.Split(name, ".") {
+		ids = append(ids, proto.Identifier(s))
+	}
+	return ids
+}
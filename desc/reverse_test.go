@@ -0,0 +1,361 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/encoding/protowire"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/campoy/groto/proto"
+)
+
+func TestFromDescriptor(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty file", ``},
+		{"proto3", `
+			syntax = "proto3";
+			package foo.bar;
+			import "google/protobuf/timestamp.proto";
+			option go_package = "foo/bar";
+			message Foo {
+				string foo_bar = 1 [json_name = "fb"];
+				repeated Foo children = 2 [deprecated = true];
+				optional int32 count = 3;
+				map<string, google.protobuf.Timestamp> times = 4;
+				oneof choice {
+					string a = 5;
+					bytes b = 6 [deprecated = true];
+				}
+				reserved 10, 12 to 14, 20 to max;
+				reserved "x", "y";
+			}
+			enum Kind {
+				option allow_alias = true;
+				A = 0;
+				B = 1;
+				C = 1 [deprecated = true];
+				reserved 9, 5 to 7;
+				reserved "D";
+			}
+			service Svc {
+				option deprecated = true;
+				rpc Get(Foo) returns (stream Foo);
+				rpc Put(stream Foo) returns (Foo) { option idempotency_level = IDEMPOTENT; }
+			}`,
+		},
+		{"proto2", `
+			syntax = "proto2";
+			message Foo {
+				required string s = 1 [default = "a\tb\001\"'\\"];
+				optional bytes b = 2 [default = "\377x\n"];
+				optional float f = 3 [default = -inf];
+				optional double d = 4 [default = 1.5e10];
+				optional uint64 u = 5 [default = 18446744073709551615];
+				optional Kind k = 6 [default = B];
+				optional bool ok = 7 [default = true];
+				optional group Result = 8 {
+					required string url = 1;
+					optional group Inner = 2 { optional int32 x = 1; }
+				}
+				oneof choice {
+					int32 i = 9;
+					group Choice = 10 { optional int32 x = 1; }
+				}
+				extensions 100 to 199, 300;
+				extensions 1000 to max [verification = UNVERIFIED];
+				extend Foo { optional int32 nested = 101; }
+			}
+			message Set {
+				option message_set_wire_format = true;
+				extensions 4 to max;
+			}
+			enum Kind { A = 0; B = 1; }
+			extend Foo {
+				repeated group More = 102 { optional int32 x = 1; }
+				optional string name = 103;
+			}
+			extend Set { optional Foo foo = 4; }`,
+		},
+		{"editions", `
+			edition = "2023";
+			option features.field_presence = IMPLICIT;
+			message Foo {
+				int32 a = 1 [features.field_presence = EXPLICIT];
+				repeated int32 b = 2;
+			}`,
+		},
+		{"custom options", `
+			syntax = "proto2";
+			package foo;
+			import "google/protobuf/descriptor.proto";
+			message Agg {
+				optional int32 a = 1;
+				repeated string b = 2;
+				optional Agg c = 3;
+				optional group G = 4 { optional int32 x = 1; }
+				optional double d = 5;
+				map<string, int32> m = 6;
+				extensions 100 to 200;
+			}
+			extend Agg { optional int32 ext = 100; }
+			extend google.protobuf.MessageOptions {
+				optional string name = 50000;
+				repeated int32 ids = 50001;
+				optional Agg agg = 50002;
+				optional Kind kind = 50003;
+				optional uint64 big = 50004;
+				optional float ratio = 50005;
+			}
+			enum Kind { UNKNOWN = 0; GOOD = 1; }
+			message Foo {
+				option deprecated = true;
+				option (name) = "foo";
+				option (ids) = 1;
+				option (ids) = 2;
+				option (agg) = { a: 1 b: ["x", "y"] c { a: 2 } G { x: 3 } [foo.ext]: 4 m [{key: "b" value: 2}, {key: "a" value: 1}] d: nan };
+				option (foo.kind) = GOOD;
+				option (big) = 18446744073709551615;
+				option (ratio) = 0.1;
+			}
+			message Bar { option (agg).c.a = 1; }`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := toDescriptor(t, "test.proto", tt.in, Options{Source: []byte(tt.in)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, source := range []bool{true, false} {
+				fd := protobuf.Clone(want).(*descriptorpb.FileDescriptorProto)
+				if !source {
+					fd.SourceCodeInfo = nil
+				}
+				f, err := FromDescriptor(fd)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if f.Pos.Filename != "test.proto" {
+					t.Errorf("expected file name test.proto, got %q", f.Pos.Filename)
+				}
+				got, err := ToDescriptor(f, Options{})
+				if err != nil {
+					t.Fatalf("could not convert back: %v", err)
+				}
+				got.SourceCodeInfo, fd.SourceCodeInfo = nil, nil
+				if !protobuf.Equal(got, fd) {
+					t.Errorf("with source info %v, expected descriptor\n%v\ngot\n%v", source, prototext.Format(fd), prototext.Format(got))
+				}
+			}
+		})
+	}
+}
+
+func TestFromDescriptorComments(t *testing.T) {
+	in := `// Detached.
+
+// Leading.
+syntax = "proto3"; // Trailing.
+
+// Foo is a message.
+message Foo {
+  // The bar.
+  int32 bar = 1; // Bar.
+
+  // Deprecated.
+  option deprecated = true;
+
+  // Choice.
+  oneof choice {
+    // A.
+    string a = 2;
+  }
+
+  // Reserved.
+  reserved 3, 4;
+  reserved "baz"; // Baz.
+}
+
+// Kind.
+enum Kind {
+  A = 0; // A.
+}
+
+// Svc.
+service Svc {
+  // Get.
+  rpc Get(Foo) returns (Foo);
+}
+`
+	fd, err := toDescriptor(t, "test.proto", in, Options{Source: []byte(in)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := FromDescriptor(fd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	foo := f.Messages[0]
+	tests := []struct {
+		name string
+		got  proto.Comments
+		want proto.Comments
+	}{
+		{"syntax", f.Syntax.Comments, proto.Comments{
+			LeadingDetachedComments: []string{" Detached.\n"},
+			LeadingComments:         " Leading.\n",
+			TrailingComment:         " Trailing.\n",
+		}},
+		{"message", foo.Comments, proto.Comments{LeadingComments: " Foo is a message.\n"}},
+		{"field", foo.Fields[0].Comments, proto.Comments{LeadingComments: " The bar.\n", TrailingComment: " Bar.\n"}},
+		{"option", foo.Options[0].Comments, proto.Comments{LeadingComments: " Deprecated.\n"}},
+		{"oneof", foo.OneOfs[0].Comments, proto.Comments{LeadingComments: " Choice.\n"}},
+		{"oneof field", foo.OneOfs[0].Fields[0].Comments, proto.Comments{LeadingComments: " A.\n"}},
+		{"reserved numbers", foo.Reserveds[0].Comments, proto.Comments{LeadingComments: " Reserved.\n"}},
+		{"reserved names", foo.Reserveds[1].Comments, proto.Comments{TrailingComment: " Baz.\n"}},
+		{"enum", f.Enums[0].Comments, proto.Comments{LeadingComments: " Kind.\n"}},
+		{"enum value", f.Enums[0].Fields[0].Comments, proto.Comments{TrailingComment: " A.\n"}},
+		{"service", f.Services[0].Comments, proto.Comments{LeadingComments: " Svc.\n"}},
+		{"rpc", f.Services[0].RPCs[0].Comments, proto.Comments{LeadingComments: " Get.\n"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: expected comments %#v, got %#v", tt.name, tt.want, tt.got)
+		}
+	}
+
+	if got := foo.Fields[0].Pos; got.Line != 9 || got.Column != 3 {
+		t.Errorf("expected field bar at 9:3, got %d:%d", got.Line, got.Column)
+	}
+	if got := len(foo.Reserveds[0].Ranges); got != 2 {
+		t.Errorf("expected 2 reserved numbers in the first statement, got %d", got)
+	}
+
+	// Declarations are kept in the order they were written in.
+	back, err := ToDescriptor(f, Options{})
+	if err != nil {
+		t.Fatalf("could not convert back: %v", err)
+	}
+	if !protobuf.Equal(back.MessageType[0], fd.MessageType[0]) {
+		t.Errorf("expected message\n%v\ngot\n%v", prototext.Format(fd.MessageType[0]), prototext.Format(back.MessageType[0]))
+	}
+}
+
+func TestFromDescriptorOptionNames(t *testing.T) {
+	fd, err := toDescriptor(t, "test.proto", `
+		syntax = "proto3";
+		package foo;
+		import "google/protobuf/descriptor.proto";
+		extend google.protobuf.FieldOptions { string tag = 50000; }
+		message Foo { int32 a = 1 [(tag) = "x", deprecated = true]; }`, Options{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := FromDescriptor(fd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := f.Messages[0].Fields[0].Options
+	if len(opts) != 2 {
+		t.Fatalf("expected 2 options, got %d", len(opts))
+	}
+	if got := opts[0]; !reflect.DeepEqual(got.Name, []proto.Identifier{"deprecated"}) || got.Value != true {
+		t.Errorf("expected option deprecated = true, got %v = %v", got.Name, got.Value)
+	}
+	if got := opts[1]; !reflect.DeepEqual(got.Prefix, []proto.Identifier{"foo", "tag"}) || got.Value != "x" {
+		t.Errorf("expected option (foo.tag) = \"x\", got %v = %v", got.Prefix, got.Value)
+	}
+}
+
+func TestFromDescriptorSubFieldOptions(t *testing.T) {
+	src := `syntax = "proto3";
+import "google/protobuf/descriptor.proto";
+message R { string get = 1; }
+extend google.protobuf.FileOptions { R r = 50001; }
+// Get.
+option (r).get = "x";
+`
+	fd, err := toDescriptor(t, "test.proto", src, Options{Source: []byte(src)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err := FromDescriptor(fd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(f.Options) != 1 {
+		t.Fatalf("expected 1 option, got %d", len(f.Options))
+	}
+	if opt := f.Options[0]; opt.Pos.Line != 6 || opt.LeadingComments != " Get.\n" {
+		t.Errorf("expected option at line 6 with comment \" Get.\\n\", got line %d with %q", opt.Pos.Line, opt.LeadingComments)
+	}
+}
+
+func TestFromDescriptorUnknownOption(t *testing.T) {
+	fd := &descriptorpb.FileDescriptorProto{
+		Name: protobuf.String("a.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: protobuf.String("A"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:    protobuf.String("x"),
+				Number:  protobuf.Int32(1),
+				Type:    descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				Options: &descriptorpb.FieldOptions{},
+			}},
+		}},
+	}
+	b := protowire.AppendTag(nil, 50000, protowire.VarintType)
+	fd.MessageType[0].Field[0].Options.ProtoReflect().SetUnknown(protowire.AppendVarint(b, 1))
+
+	want := "a.proto: unknown custom option: no extension of google.protobuf.FieldOptions with number 50000 was found"
+	if _, err := FromDescriptor(fd); err == nil || err.Error() != want {
+		t.Errorf("expected error %q, got %v", want, err)
+	}
+}
+
+func TestFromDescriptorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fd   string
+		err  string
+	}{
+		{"unknown syntax", `name: "a.proto" syntax: "proto4"`, `a.proto: unknown syntax "proto4"`},
+		{"field without type", `name: "a.proto" message_type: {name: "A" field: {name: "x" number: 1}}`,
+			"a.proto: field x has no type"},
+		{"missing group message", `name: "a.proto" message_type: {name: "A" field: {name: "g" number: 1 type: TYPE_GROUP type_name: ".A.G"}}`,
+			"a.proto: message of group g not found"},
+		{"invalid default", `name: "a.proto" message_type: {name: "A" field: {name: "x" number: 1 type: TYPE_INT32 default_value: "y"}}`,
+			`a.proto: invalid default value of x: strconv.ParseInt: parsing "y": invalid syntax`},
+	}
+	for _, tt := range tests {
+		fd := new(descriptorpb.FileDescriptorProto)
+		if err := prototext.Unmarshal([]byte(tt.fd), fd); err != nil {
+			t.Fatalf("%s: bad descriptor: %v", tt.name, err)
+		}
+		_, err := FromDescriptor(fd)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package desc
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/scanner"
+	"github.com/campoy/groto/token"
+)
+
+// source holds the tokens of a file, used to find the parts of a definition
+// whose positions are not kept in the nodes, such as names and numbers.
+// All the methods can be called on a nil source, returning invalid spans.
+type source struct {
+	data  []byte
+	toks  []scanner.Token // all the tokens except comments and EOF.
+	lines []int           // offset where each line starts.
+}
+
+func newSource(name string, data []byte) *source {
+	s := &source{data: data, lines: []int{0}}
+	sc := scanner.NewFile(name, bytes.NewReader(data))
+	for {
+		tok := sc.Scan()
+		if tok.Is(token.EOF) {
+			break
+		}
+		if !tok.Is(token.Comment) {
+			s.toks = append(s.toks, tok)
+		}
+	}
+	for i, c := range data {
+		if c == '\n' {
+			s.lines = append(s.lines, i+1)
+		}
+	}
+	return s
+}
+
+// at returns the index of the first token starting at the given position
+// or after it.
+func (s *source) at(pos token.Position) int {
+	if s == nil {
+		return 0
+	}
+	return sort.Search(len(s.toks), func(i int) bool { return s.toks[i].Pos.Offset >= pos.Offset })
+}
+
+// is returns true if the token with index i exists and is of the given kind.
+func (s *source) is(i int, kind token.Kind) bool {
+	return s != nil && 0 <= i && i < len(s.toks) && s.toks[i].Is(kind)
+}
+
+// tokens returns the span going from the start of token i to the end of token j.
+func (s *source) tokens(i, j int) proto.Span {
+	if s == nil || i < 0 || j < i || j >= len(s.toks) {
+		return proto.Span{}
+	}
+	return proto.Span{Pos: s.toks[i].Pos, End: s.toks[j].End}
+}
+
+// brackets returns the index of the ']' closing the '[' with index i.
+func (s *source) brackets(i int) int {
+	if s == nil {
+		return i
+	}
+	depth := 0
+	for ; i < len(s.toks); i++ {
+		switch s.toks[i].Kind {
+		case token.OpenBracket:
+			depth++
+		case token.CloseBracket:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s.toks) - 1
+}
+
+// span returns the given span in the format used by SourceCodeInfo: zero
+// based line and column of the start, line of the end if different, and
+// column of the end. As in protoc, columns count bytes, and tabs advance
+// to the next multiple of 8.
+func (s *source) span(sp proto.Span) []int32 {
+	startLine, startCol := s.position(sp.Pos.Offset)
+	endLine, endCol := s.position(sp.End.Offset)
+	if startLine == endLine {
+		return []int32{startLine, startCol, endCol}
+	}
+	return []int32{startLine, startCol, endLine, endCol}
+}
+
+func (s *source) position(offset int) (line, col int32) {
+	l := sort.Search(len(s.lines), func(i int) bool { return s.lines[i] > offset }) - 1
+	for _, c := range s.data[s.lines[l]:offset] {
+		if c == '\t' {
+			col += 8 - col%8
+		} else {
+			col++
+		}
+	}
+	return int32(l), col
+}
@@ -0,0 +1,80 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package errlist provides the positioned errors reported by the packages
+// that work on parsed files, which export them under their own names. The
+// parser, whose errors have more details, formats them as these ones.
+package errlist
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/campoy/groto/token"
+)
+
+// An Error describes a problem found at a position of a file.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+// Error returns the message of the error, prefixed by its position if known.
+func (e *Error) Error() string {
+	if e.Pos.Filename != "" || e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Msg
+	}
+	return e.Msg
+}
+
+// A List is a list of errors.
+type List []*Error
+
+// Error returns the first error in the list, and how many more there are.
+func (l List) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	case 2:
+		return fmt.Sprintf("%s (and 1 more error)", l[0])
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+	}
+}
+
+// Addf appends an error at the given position to the list.
+func (l *List) Addf(pos token.Position, format string, args ...interface{}) {
+	*l = append(*l, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// Sort sorts the list by file name and position, keeping the order of the
+// errors at the same position.
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		a, b := l[i].Pos, l[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+}
+
+// Err returns an error equivalent to the list, or nil if the list is empty.
+func (l List) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
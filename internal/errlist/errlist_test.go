@@ -0,0 +1,42 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errlist
+
+import (
+	"testing"
+
+	"github.com/campoy/groto/token"
+)
+
+func TestList(t *testing.T) {
+	var l List
+	if l.Err() != nil {
+		t.Fatalf("expected no error for an empty list")
+	}
+	l.Addf(token.Position{Filename: "b.proto", Line: 1, Column: 1}, "b")
+	l.Addf(token.Position{Filename: "a.proto", Line: 2, Column: 1}, "a %d", 2)
+	l.Addf(token.Position{Filename: "a.proto", Line: 1, Column: 5}, "a %d", 1)
+	l.Addf(token.Position{}, "no position")
+	l.Sort()
+
+	want := []string{"no position", "a.proto:1:5: a 1", "a.proto:2:1: a 2", "b.proto:1:1: b"}
+	for i, e := range l {
+		if e.Error() != want[i] {
+			t.Errorf("expected error %d to be %q, got %q", i, want[i], e)
+		}
+	}
+	if got := l.Err().Error(); got != "no position (and 3 more errors)" {
+		t.Errorf("unexpected list message %q", got)
+	}
+}
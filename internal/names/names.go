@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package names implements the scoping rules of protoc, used to resolve the
+// names of types from the scope where they are used.
+package names
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Kind is the kind of definition a full name refers to.
+type Kind int
+
+const (
+	Package Kind = iota
+	Message
+	Enum
+	EnumValue
+	Field
+	Oneof
+	Service
+	Method
+)
+
+// IsType returns true for the definitions that can be used as the type of a
+// field.
+func (k Kind) IsType() bool { return k == Message || k == Enum }
+
+// IsAggregate returns true for the definitions that can contain others.
+func (k Kind) IsAggregate() bool {
+	return k == Package || k == Message || k == Enum || k == Service
+}
+
+// Lookup returns the full name of the definition a name refers to from the
+// given scope, following the same rules as protoc. The find function
+// returns the kind of the definition with the given full name, if there is
+// one that can be referred to.
+//
+// Names starting with a dot are fully qualified. Otherwise, the first part of
+// the name is looked up in the scope, then in its parent, and so on. If the
+// name has more parts, the rest of them must be defined inside the first
+// definition found, even if a definition could be found in an outer scope.
+// If typesOnly is true, definitions that are not types are skipped.
+func Lookup(scope, name string, typesOnly bool, find func(full string) (Kind, bool)) (string, error) {
+	if strings.HasPrefix(name, ".") {
+		if _, ok := find(name[1:]); ok {
+			return name[1:], nil
+		}
+		return "", errors.New(name + " is not defined")
+	}
+
+	first := name
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		first = name[:i]
+	}
+	for {
+		kind, ok := find(Qualify(scope, first))
+		switch {
+		case !ok:
+		case first != name:
+			if kind.IsAggregate() {
+				full := Qualify(scope, name)
+				if _, ok := find(full); ok {
+					return full, nil
+				}
+				return "", errors.New(name + " resolved to " + full + ", which is not defined")
+			}
+		case !typesOnly || kind.IsType():
+			return Qualify(scope, name), nil
+		}
+		if scope == "" {
+			return "", errors.New(name + " is not defined")
+		}
+		scope = Parent(scope)
+	}
+}
+
+// Parent returns the scope containing the given one.
+func Parent(scope string) string {
+	if i := strings.LastIndexByte(scope, '.'); i >= 0 {
+		return scope[:i]
+	}
+	return ""
+}
+
+// Qualify returns the full name of a definition in the given scope.
+func Qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
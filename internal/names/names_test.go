@@ -0,0 +1,61 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package names
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	defs := map[string]Kind{
+		"foo":       Package,
+		"foo.M":     Message,
+		"foo.M.N":   Message,
+		"foo.M.f":   Field,
+		"foo.E":     Enum,
+		"foo.X":     EnumValue,
+		"foo.bar":   Package,
+		"foo.bar.M": Message,
+		"N":         Message,
+	}
+	find := func(full string) (Kind, bool) {
+		k, ok := defs[full]
+		return k, ok
+	}
+	tests := []struct {
+		scope, name string
+		typesOnly   bool
+		full, err   string
+	}{
+		{"foo.bar", "M", true, "foo.bar.M", ""},
+		{"foo.M", "N", true, "foo.M.N", ""},
+		{"foo.bar", "N", true, "N", ""},
+		{"foo.bar", ".foo.M", true, "foo.M", ""},
+		{"foo.bar", "foo.M.N", true, "foo.M.N", ""},
+		{"foo.M", "f", false, "foo.M.f", ""},
+		{"foo.M", "f", true, "", "f is not defined"},
+		{"foo.bar", "M.N", true, "", "M.N resolved to foo.bar.M.N, which is not defined"},
+		{"foo", ".bar.M", true, "", ".bar.M is not defined"},
+	}
+	for _, tt := range tests {
+		full, err := Lookup(tt.scope, tt.name, tt.typesOnly, find)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Lookup(%q, %q) expected error %q, got %v", tt.scope, tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || full != tt.full {
+			t.Errorf("Lookup(%q, %q) = %q, %v; want %q", tt.scope, tt.name, full, err, tt.full)
+		}
+	}
+}
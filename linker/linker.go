@@ -0,0 +1,317 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package linker provides the function Link, which resolves the names of the
+// messages and enums used as types in a set of parsed files, following the
+// same rules as protoc.
+//
+// A name starting with a dot is fully qualified. Otherwise, its first part is
+// looked up in the innermost scope where the name is used, then in the scope
+// containing it, and so on until the package of the file, its parent packages
+// and the root scope. If the name has more parts, they must be defined in the
+// definition found for the first one.
+//
+// A file can use the definitions in the files it imports, and in the files
+// they import publicly, but not the ones in other files.
+package linker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/campoy/groto/internal/errlist"
+	"github.com/campoy/groto/internal/names"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// An Error describes a name that could not be resolved, or defined twice.
+type Error = errlist.Error
+
+// An ErrorList is a list of errors, sorted by position.
+type ErrorList = errlist.List
+
+// Link resolves the references to messages and enums in the given files,
+// indexed by the path used to import them, setting the Target of every
+// user defined proto.Type and proto.RPCParam. All the files imported by
+// the given ones must be in the map.
+//
+// If some names can't be resolved, because they're not defined, defined
+// more than once, or defined in files that are not imported, or if some
+// imports are missing, Link returns an ErrorList describing all of them.
+// The Target of the names that couldn't be resolved is nil.
+func Link(files map[string]*proto.File) error {
+	l := &linker{files: files, syms: map[string]*symbol{}, visibility: map[string]func(*symbol) bool{}}
+	var paths []string
+	for name := range files {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	for _, name := range paths {
+		l.file(name, files[name])
+	}
+	for _, r := range l.refs {
+		l.resolve(r)
+	}
+
+	l.errs.Sort()
+	return l.errs.Err()
+}
+
+type linker struct {
+	files      map[string]*proto.File
+	syms       map[string]*symbol
+	refs       []ref
+	visibility map[string]func(*symbol) bool // indexed by file name.
+	errs       ErrorList
+}
+
+func (l *linker) errorf(pos token.Position, format string, args ...interface{}) {
+	l.errs.Addf(pos, format, args...)
+}
+
+// A symbol is a definition with a full name. Packages can be defined by
+// many files, other definitions by only one.
+type symbol struct {
+	kind   names.Kind
+	files  []string
+	pos    token.Position
+	target *proto.Target // set for messages and enums.
+}
+
+// define adds the definition of a symbol in the given file, reporting
+// symbols that were already defined.
+func (l *linker) define(file, full string, kind names.Kind, pos token.Position, target *proto.Target) {
+	prev, ok := l.syms[full]
+	switch {
+	case !ok:
+		l.syms[full] = &symbol{kind: kind, files: []string{file}, pos: pos, target: target}
+	case kind == names.Package && prev.kind == names.Package:
+		if prev.files[len(prev.files)-1] != file {
+			prev.files = append(prev.files, file)
+		}
+	case prev.files[0] == file:
+		l.errorf(pos, "%s is already defined", full)
+	default:
+		l.errorf(pos, "%s is already defined in %s", full, prev.files[0])
+	}
+}
+
+// A ref is a name used as a type, which can only be resolved once all the
+// definitions are known. If message is true, it must be a message.
+type ref struct {
+	file    string
+	scope   string
+	name    string
+	pos     token.Position
+	message bool
+	target  **proto.Target
+}
+
+func (l *linker) file(name string, f *proto.File) {
+	pkg := join(f.Package.Identifier)
+	for scope := pkg; scope != ""; scope = names.Parent(scope) {
+		l.define(name, scope, names.Package, f.Package.Pos, nil)
+	}
+	for _, imp := range f.Imports {
+		if _, ok := l.files[imp.Path]; !ok {
+			l.errorf(imp.Pos, "file not found: %s", imp.Path)
+		}
+	}
+	for i := range f.Messages {
+		l.message(name, pkg, &f.Messages[i])
+	}
+	for i := range f.Enums {
+		l.enum(name, pkg, &f.Enums[i])
+	}
+	for i := range f.Extends {
+		l.extend(name, pkg, &f.Extends[i])
+	}
+	for i := range f.Services {
+		s := &f.Services[i]
+		full := names.Qualify(pkg, string(s.Name))
+		l.define(name, full, names.Service, s.Pos, nil)
+		for j := range s.RPCs {
+			rpc := &s.RPCs[j]
+			l.define(name, names.Qualify(full, string(rpc.Name)), names.Method, rpc.Pos, nil)
+			for _, p := range []*proto.RPCParam{&rpc.In, &rpc.Out} {
+				p.Target = nil
+				typ := join(p.Type)
+				if p.FullyQualified {
+					typ = "." + typ
+				}
+				l.refs = append(l.refs, ref{name, full, typ, p.Pos, true, &p.Target})
+			}
+		}
+	}
+}
+
+func (l *linker) message(file, scope string, m *proto.Message) {
+	full := names.Qualify(scope, string(m.Name))
+	l.define(file, full, names.Message, m.Pos, &proto.Target{File: file, FullName: full, Message: m})
+	for i := range m.Fields {
+		l.field(file, full, &m.Fields[i])
+	}
+	for i := range m.Maps {
+		f := &m.Maps[i]
+		l.define(file, names.Qualify(full, string(f.Name)), names.Field, f.Pos, nil)
+		l.typeRef(file, full, &f.KeyType, false)
+		l.typeRef(file, full, &f.ValueType, false)
+	}
+	for i := range m.OneOfs {
+		o := &m.OneOfs[i]
+		l.define(file, names.Qualify(full, string(o.Name)), names.Oneof, o.Pos, nil)
+		for j := range o.Fields {
+			f := &o.Fields[j]
+			l.define(file, names.Qualify(full, string(f.Name)), names.Field, f.Pos, nil)
+			if f.Group != nil {
+				l.message(file, full, f.Group)
+			}
+			l.typeRef(file, full, &f.Type, false)
+		}
+	}
+	for i := range m.Messages {
+		l.message(file, full, &m.Messages[i])
+	}
+	for i := range m.Enums {
+		l.enum(file, full, &m.Enums[i])
+	}
+	for i := range m.Extends {
+		l.extend(file, full, &m.Extends[i])
+	}
+}
+
+// field defines a field of a message, or an extension, in the given scope.
+// Groups also define their message in the same scope.
+func (l *linker) field(file, scope string, f *proto.Field) {
+	l.define(file, names.Qualify(scope, string(f.Name)), names.Field, f.Pos, nil)
+	if f.Group != nil {
+		l.message(file, scope, f.Group)
+	}
+	l.typeRef(file, scope, &f.Type, false)
+}
+
+func (l *linker) extend(file, scope string, e *proto.Extend) {
+	l.typeRef(file, scope, &e.Type, true)
+	for i := range e.Fields {
+		l.field(file, scope, &e.Fields[i])
+	}
+}
+
+// enum defines an enum and its values, which are defined in the same scope
+// as the enum itself, and not inside of it.
+func (l *linker) enum(file, scope string, e *proto.Enum) {
+	full := names.Qualify(scope, string(e.Name))
+	l.define(file, full, names.Enum, e.Pos, &proto.Target{File: file, FullName: full, Enum: e})
+	for _, v := range e.Fields {
+		l.define(file, names.Qualify(scope, string(v.Name)), names.EnumValue, v.Pos, nil)
+	}
+}
+
+// typeRef adds a reference to the type t, if it is user defined.
+func (l *linker) typeRef(file, scope string, t *proto.Type, message bool) {
+	t.Target = nil
+	if t.Predefined != proto.TypeInvalid {
+		return
+	}
+	name := join(t.UserDefined)
+	if t.FullyQualified {
+		name = "." + name
+	}
+	l.refs = append(l.refs, ref{file, scope, name, t.Pos, message, &t.Target})
+}
+
+// resolve finds the definition a reference refers to, and sets its target.
+func (l *linker) resolve(r ref) {
+	visible, ok := l.visibility[r.file]
+	if !ok {
+		visible = l.visible(r.file)
+		l.visibility[r.file] = visible
+	}
+	_, sym, err := l.lookup(r.scope, r.name, !r.message, visible)
+	if err != nil {
+		// Give a hint if the name would be found with the right imports.
+		all := func(*symbol) bool { return true }
+		if full, sym, e := l.lookup(r.scope, r.name, !r.message, all); e == nil && sym.kind != names.Package {
+			err = fmt.Errorf("%s is defined in %s, which is not imported by %s", full, sym.files[0], r.file)
+		}
+		l.errorf(r.pos, "%v", err)
+		return
+	}
+	switch {
+	case r.message && sym.kind != names.Message:
+		l.errorf(r.pos, "%s is not a message type", r.name)
+	case !sym.kind.IsType():
+		l.errorf(r.pos, "%s is not a type", r.name)
+	default:
+		*r.target = sym.target
+	}
+}
+
+// visible returns a function telling whether the definition of a symbol is
+// visible from the given file: if it's defined in the file itself, in one
+// of the files it imports, or in the files they import publicly.
+func (l *linker) visible(file string) func(*symbol) bool {
+	files := map[string]bool{file: true}
+	var public func(name string)
+	public = func(name string) {
+		f, ok := l.files[name]
+		if !ok {
+			return
+		}
+		for _, imp := range f.Imports {
+			if imp.Modifier == proto.PublicImport && !files[imp.Path] {
+				files[imp.Path] = true
+				public(imp.Path)
+			}
+		}
+	}
+	if f, ok := l.files[file]; ok {
+		for _, imp := range f.Imports {
+			files[imp.Path] = true
+			public(imp.Path)
+		}
+	}
+	return func(s *symbol) bool {
+		for _, f := range s.files {
+			if files[f] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// lookup returns the full name and symbol of the definition a name refers to
+// from the given scope, only considering the visible symbols.
+func (l *linker) lookup(scope, name string, typesOnly bool, visible func(*symbol) bool) (string, *symbol, error) {
+	full, err := names.Lookup(scope, name, typesOnly, func(full string) (names.Kind, bool) {
+		if s, ok := l.syms[full]; ok && visible(s) {
+			return s.kind, true
+		}
+		return 0, false
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return full, l.syms[full], nil
+}
+
+func join(ids []proto.Identifier) string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, string(id))
+	}
+	return strings.Join(s, ".")
+}
@@ -0,0 +1,339 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linker
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+)
+
+func parse(t *testing.T, srcs map[string]string) map[string]*proto.File {
+	t.Helper()
+	files := map[string]*proto.File{}
+	for name, src := range srcs {
+		f, err := parser.ParseFile(name, strings.NewReader(src), 0)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", name, err)
+		}
+		files[name] = f
+	}
+	return files
+}
+
+// targets returns the full names and files of the targets of all the
+// types in the file, in order, as "name (file)", or "nil".
+func targets(f *proto.File) []string {
+	var res []string
+	add := func(t *proto.Target) {
+		if t == nil {
+			res = append(res, "nil")
+			return
+		}
+		res = append(res, t.FullName+" ("+t.File+")")
+	}
+	var message func(m *proto.Message)
+	field := func(f *proto.Field) {
+		if f.Type.Predefined == proto.TypeInvalid {
+			add(f.Type.Target)
+		}
+		if f.Group != nil {
+			message(f.Group)
+		}
+	}
+	extend := func(e *proto.Extend) {
+		add(e.Type.Target)
+		for i := range e.Fields {
+			field(&e.Fields[i])
+		}
+	}
+	message = func(m *proto.Message) {
+		for i := range m.Fields {
+			field(&m.Fields[i])
+		}
+		for _, f := range m.Maps {
+			if f.ValueType.Predefined == proto.TypeInvalid {
+				add(f.ValueType.Target)
+			}
+		}
+		for _, o := range m.OneOfs {
+			for _, f := range o.Fields {
+				if f.Type.Predefined == proto.TypeInvalid {
+					add(f.Type.Target)
+				}
+				if f.Group != nil {
+					message(f.Group)
+				}
+			}
+		}
+		for i := range m.Messages {
+			message(&m.Messages[i])
+		}
+		for i := range m.Extends {
+			extend(&m.Extends[i])
+		}
+	}
+	for i := range f.Messages {
+		message(&f.Messages[i])
+	}
+	for i := range f.Extends {
+		extend(&f.Extends[i])
+	}
+	for _, s := range f.Services {
+		for _, rpc := range s.RPCs {
+			add(rpc.In.Target)
+			add(rpc.Out.Target)
+		}
+	}
+	return res
+}
+
+func TestLink(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // targets in main.proto.
+	}{
+		{"same file", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo.bar;
+			message A { B b = 1; .foo.bar.B c = 2; map<string, E> m = 3; oneof o { A a = 4; } }
+			message B {}
+			enum E { X = 0; }
+			service S { rpc Get(A) returns (stream foo.bar.B); }`},
+			[]string{"foo.bar.B (main.proto)", "foo.bar.B (main.proto)", "foo.bar.E (main.proto)",
+				"foo.bar.A (main.proto)", "foo.bar.A (main.proto)", "foo.bar.B (main.proto)"},
+		},
+		{"fully qualified methods", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo;
+			message foo {}
+			message Req {}
+			service S { rpc Get(.foo.Req) returns (stream .foo.Req); }`},
+			[]string{"foo.Req (main.proto)", "foo.Req (main.proto)"},
+		},
+		{"innermost scope first", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo;
+			message B {}
+			message A {
+				message B {}
+				B inner = 1;
+				foo.B outer = 2;
+				message C { B b = 1; A.B ab = 2; }
+			}`},
+			[]string{"foo.A.B (main.proto)", "foo.B (main.proto)", "foo.A.B (main.proto)", "foo.A.B (main.proto)"},
+		},
+		{"parent packages", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo.bar.baz;
+			import "other.proto";
+			message A { B b = 1; bar.C c = 2; }`,
+			"other.proto": `
+			syntax = "proto3";
+			package foo;
+			import public "bar.proto";
+			message B {}`,
+			"bar.proto": `syntax = "proto3"; package foo.bar; message C {}`},
+			[]string{"foo.B (other.proto)", "foo.bar.C (bar.proto)"},
+		},
+		{"skip non types", map[string]string{"main.proto": `
+			syntax = "proto3";
+			message T {}
+			message A { T T = 1; }`},
+			[]string{"T (main.proto)"},
+		},
+		{"groups and extensions", map[string]string{"main.proto": `
+			syntax = "proto2";
+			package foo;
+			message A {
+				extensions 100 to max;
+				optional group G = 1 { optional G g = 1; }
+				extend A { optional G ext = 100; }
+			}
+			extend A { optional A.G ext = 101; }`},
+			[]string{"foo.A.G (main.proto)", "foo.A.G (main.proto)", "foo.A (main.proto)",
+				"foo.A.G (main.proto)", "foo.A (main.proto)", "foo.A.G (main.proto)"},
+		},
+		{"groups in oneofs", map[string]string{"main.proto": `
+			syntax = "proto2";
+			package foo;
+			message A {
+				oneof o { group G = 1 { optional G g = 2; } }
+			}`},
+			[]string{"foo.A.G (main.proto)", "foo.A.G (main.proto)"},
+		},
+		{"imports", map[string]string{
+			"main.proto": `
+			syntax = "proto3";
+			import "a.proto";
+			message M { a.A a = 1; b.B b = 2; c.C c = 3; }`,
+			"a.proto": `syntax = "proto3"; package a; import public "b.proto"; message A {}`,
+			"b.proto": `syntax = "proto3"; package b; import public "c.proto"; message B {}`,
+			"c.proto": `syntax = "proto3"; package c; message C {}`},
+			[]string{"a.A (a.proto)", "b.B (b.proto)", "c.C (c.proto)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := parse(t, tt.files)
+			if err := Link(files); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := targets(files["main.proto"]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected targets %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLinkTargets(t *testing.T) {
+	files := parse(t, map[string]string{"main.proto": `
+		syntax = "proto3";
+		message A { B b = 1; E e = 2; }
+		message B {}
+		enum E { X = 0; }`})
+	if err := Link(files); err != nil {
+		t.Fatal(err)
+	}
+	f := files["main.proto"]
+	a := f.Messages[0]
+	if got := a.Fields[0].Type.Target.Message; got != &f.Messages[1] {
+		t.Errorf("expected B to refer to the message B, got %# v", pretty.Formatter(got))
+	}
+	if got := a.Fields[1].Type.Target.Enum; got != &f.Enums[0] {
+		t.Errorf("expected E to refer to the enum E, got %# v", pretty.Formatter(got))
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		errs  []string
+	}{
+		{"not defined", map[string]string{"main.proto": `
+			syntax = "proto3";
+			message A {
+				B b = 1;
+				.A.C c = 2;
+			}`},
+			[]string{"main.proto:4:5: B is not defined", "main.proto:5:5: .A.C is not defined"},
+		},
+		{"resolved to undefined", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo;
+			message B { message C {} }
+			message A {
+				message B {}
+				B.C c = 1;
+			}`},
+			[]string{"main.proto:7:5: B.C resolved to foo.A.B.C, which is not defined"},
+		},
+		{"not a type", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo;
+			message A { foo x = 1; A.x y = 2; }
+			service S { rpc Get(foo.S) returns (A); }`},
+			[]string{
+				"main.proto:4:16: foo is not defined",
+				"main.proto:4:27: A.x is not a type",
+				"main.proto:5:23: foo.S is not a message type",
+			},
+		},
+		{"fully qualified methods", map[string]string{"main.proto": `
+			syntax = "proto3";
+			package foo;
+			message Req {}
+			service S { rpc Get(.Req) returns (foo.Req); }`},
+			[]string{"main.proto:5:23: .Req is not defined"},
+		},
+		{"not a message type", map[string]string{"main.proto": `
+			syntax = "proto2";
+			enum E { X = 0; }
+			extend E { optional int32 x = 1; }
+			service S { rpc Get(E) returns (E); }`},
+			[]string{
+				"main.proto:4:11: E is not a message type",
+				"main.proto:5:23: E is not a message type",
+				"main.proto:5:35: E is not a message type",
+			},
+		},
+		{"already defined", map[string]string{
+			"main.proto": `
+			syntax = "proto3";
+			package foo;
+			import "other.proto";
+			message A { int32 x = 1; int32 x = 2; }
+			enum E { A = 0; }
+			message B {}`,
+			"other.proto": `syntax = "proto3"; package foo; message B {}`},
+			[]string{
+				"main.proto:5:29: foo.A.x is already defined",
+				"main.proto:6:13: foo.A is already defined",
+				"other.proto:1:33: foo.B is already defined in main.proto",
+			},
+		},
+		{"not imported", map[string]string{
+			"main.proto": `
+			syntax = "proto3";
+			import "a.proto";
+			message M { b.B b = 1; c.C c = 2; }`,
+			"a.proto": `syntax = "proto3"; package a; import "b.proto"; import public "c.proto";`,
+			"b.proto": `syntax = "proto3"; package b; message B {}`,
+			"c.proto": `syntax = "proto3"; package c; import "b.proto"; message C {}`},
+			[]string{"main.proto:4:16: b.B is defined in b.proto, which is not imported by main.proto"},
+		},
+		{"file not found", map[string]string{"main.proto": `
+			syntax = "proto3";
+			import "missing.proto";`},
+			[]string{"main.proto:3:4: file not found: missing.proto"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Link(parse(t, tt.files))
+			var errs ErrorList
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected an ErrorList, got %v", err)
+			}
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+			if !reflect.DeepEqual(got, tt.errs) {
+				t.Errorf("expected errors:\n%s\ngot:\n%s", strings.Join(tt.errs, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLinkUnresolvedTarget(t *testing.T) {
+	files := parse(t, map[string]string{"main.proto": `syntax = "proto3"; message A { B b = 1; }`})
+	files["main.proto"].Messages[0].Fields[0].Type.Target = &proto.Target{FullName: "stale"}
+	if err := Link(files); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := files["main.proto"].Messages[0].Fields[0].Type.Target; got != nil {
+		t.Errorf("expected no target, got %v", got)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// An Edit replaces the bytes of a source between the offsets Pos and End,
+// End excluded, with New. Edits with equal offsets insert New at Pos.
+type Edit struct {
+	Pos, End int
+	New      string
+}
+
+// Apply returns the result of applying the given edits to src, which is not
+// modified. The edits can be in any order, but must not overlap.
+func Apply(src []byte, edits []Edit) ([]byte, error) {
+	sorted := append([]Edit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Pos < sorted[j].Pos })
+
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range sorted {
+		if e.Pos < last || e.End < e.Pos || e.End > len(src) {
+			return nil, fmt.Errorf("invalid or overlapping edit of bytes %d to %d", e.Pos, e.End)
+		}
+		buf.Write(src[last:e.Pos])
+		buf.WriteString(e.New)
+		last = e.End
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// maxPasses is the number of times Fix lints and edits a source at most.
+const maxPasses = 10
+
+// Fix is like Lint, but also applies the fixes of the problems found. It
+// returns the fixed source and the problems found in it, which are the ones
+// that could not be fixed automatically.
+//
+// The fixes of different problems can't always be applied at once, when
+// their edits overlap. In that case, the source is linted again after the
+// first fix is applied, so the remaining problems are reported with up to
+// date edits.
+func Fix(filename string, src []byte, rules []*Rule) ([]byte, []Problem, error) {
+	for pass := 1; ; pass++ {
+		problems, err := Lint(filename, src, rules)
+		if err != nil {
+			return nil, nil, err
+		}
+		var edits []Edit
+		for _, p := range problems {
+			if p.Fix != nil && !overlaps(edits, p.Fix) {
+				edits = append(edits, p.Fix...)
+			}
+		}
+		if len(edits) == 0 || pass > maxPasses {
+			return src, problems, nil
+		}
+		if src, err = Apply(src, edits); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// overlaps returns true if any of the edits in a overlaps with any of the
+// edits in b, or inserts text at the same offset.
+func overlaps(a, b []Edit) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Pos == y.Pos || x.Pos < y.End && y.Pos < x.End {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The methods below find the parts of the source that are not kept in the
+// nodes, such as names, to build the edits of fixes.
+
+// token returns the index of the first token starting at the given position
+// or after it.
+func (c *Context) token(pos token.Position) int {
+	return sort.Search(len(c.toks), func(i int) bool { return c.toks[i].Pos.Offset >= pos.Offset })
+}
+
+// name returns the offsets of the name of a field, map field, or enum value
+// with the given span, which is the identifier right before its '='.
+func (c *Context) name(s proto.Span) (pos, end int, ok bool) {
+	for i := c.token(s.Pos); i < len(c.toks) && c.toks[i].Pos.Offset < s.End.Offset; i++ {
+		if c.toks[i].Is(token.Equals) {
+			if i == 0 || !c.toks[i-1].Is(token.Identifier) {
+				return 0, 0, false
+			}
+			return c.toks[i-1].Pos.Offset, c.toks[i-1].End.Offset, true
+		}
+	}
+	return 0, 0, false
+}
+
+// lineStart returns the offset of the start of the line with the given
+// offset, and whether there is only whitespace between both.
+func (c *Context) lineStart(off int) (int, bool) {
+	start := bytes.LastIndexByte(c.src[:off], '\n') + 1
+	return start, len(bytes.TrimSpace(c.src[start:off])) == 0
+}
+
+// lineEnd returns the offset of the end of the line with the given offset,
+// not including the newline, and whether there is only whitespace between
+// both.
+func (c *Context) lineEnd(off int) (int, bool) {
+	end := bytes.IndexByte(c.src[off:], '\n')
+	if end < 0 {
+		end = len(c.src) - off
+	}
+	return off + end, len(bytes.TrimSpace(c.src[off:off+end])) == 0
+}
+
+// lines returns the offsets of the lines holding the node with the given
+// span, including its leading comments and the comment following it on its
+// last line, if any. It returns false if the lines hold other tokens.
+func (c *Context) lines(s proto.Span) (start, end int, ok bool) {
+	i := c.token(s.Pos)
+	for i > 0 && c.toks[i-1].Is(token.Comment) && c.toks[i-1].End.Line >= c.toks[i].Pos.Line-1 &&
+		(i == 1 || c.toks[i-2].End.Line < c.toks[i-1].Pos.Line) {
+		i--
+	}
+	last := c.token(s.End)
+	if last < len(c.toks) && c.toks[last].Is(token.Comment) && c.toks[last].Pos.Line == s.End.Line {
+		last++
+	}
+	if i >= len(c.toks) || last == 0 {
+		return 0, 0, false
+	}
+	start, onlySpace := c.lineStart(c.toks[i].Pos.Offset)
+	if !onlySpace {
+		return 0, 0, false
+	}
+	end, onlySpace = c.lineEnd(c.toks[last-1].End.Offset)
+	return start, end, onlySpace
+}
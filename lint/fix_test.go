@@ -0,0 +1,242 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/campoy/groto/proto"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []Edit
+		out   string
+		err   string
+	}{
+		{"none", nil, "abcdef", ""},
+		{"unordered", []Edit{{4, 5, "E"}, {0, 1, ""}, {2, 2, "-"}}, "b-cdEf", ""},
+		{"insertions", []Edit{{6, 6, "g"}, {6, 6, "h"}}, "abcdefgh", ""},
+		{"overlapping", []Edit{{0, 3, "x"}, {2, 4, "y"}}, "", "invalid or overlapping edit of bytes 2 to 4"},
+		{"out of range", []Edit{{5, 7, "x"}}, "", "invalid or overlapping edit of bytes 5 to 7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := []byte("abcdef")
+			out, err := Apply(src, tt.edits)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.out || string(src) != "abcdef" {
+				t.Errorf("expected %q, got %q; the source is now %q", tt.out, out, src)
+			}
+		})
+	}
+}
+
+func TestFix(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		in, out  string
+		problems []string
+	}{
+		{"field names",
+			[]string{"FIELD_NAMES_LOWER_SNAKE_CASE"}, `syntax = "proto2";
+message M {
+  // The first field.
+  optional int32 fooBar   =  1 [json_name = "fooBar"]; // trailing
+  map<string, int32> HTTPHeaders = 2;
+  oneof o { string Name = 3; }
+  optional int32 taken = 4;
+  optional int32 Taken = 5;
+  reserved "reserved_name";
+  optional int32 ReservedName = 6;
+  extensions 10 to 20;
+}
+extend M { optional int32 Ext = 10; }
+`, `syntax = "proto2";
+message M {
+  // The first field.
+  optional int32 foo_bar   =  1 [json_name = "fooBar"]; // trailing
+  map<string, int32> http_headers = 2;
+  oneof o { string name = 3; }
+  optional int32 taken = 4;
+  optional int32 Taken = 5;
+  reserved "reserved_name";
+  optional int32 ReservedName = 6;
+  extensions 10 to 20;
+}
+extend M { optional int32 Ext = 10; }
+`, []string{
+				"8:3: field name Taken must be lower_snake_case, such as taken",
+				"10:3: field name ReservedName must be lower_snake_case, such as reserved_name",
+				"13:12: field name Ext must be lower_snake_case, such as ext",
+			},
+		},
+		{"colliding field names",
+			[]string{"FIELD_NAMES_LOWER_SNAKE_CASE"}, `syntax = "proto3";
+message M { int32 fooBar = 1; int32 FooBar = 2; }
+`, `syntax = "proto3";
+message M { int32 foo_bar = 1; int32 FooBar = 2; }
+`, []string{"2:32: field name FooBar must be lower_snake_case, such as foo_bar"},
+		},
+		{"zero values",
+			[]string{"ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH"}, `syntax = "proto3";
+enum Color {
+  // Red is the default.
+  COLOR_RED = 1;
+}
+enum HTTPStatus { // The status of a response.
+  option allow_alias = true;
+  HTTP_STATUS_OK = 200;
+}
+message M { enum Kind { KIND_A = 1; KIND_B = 2; } }
+enum R { reserved 0; R_A = 1; }
+enum S { reserved "S_UNSPECIFIED"; S_A = 1; }
+`, `syntax = "proto3";
+enum Color {
+  COLOR_UNSPECIFIED = 0;
+  // Red is the default.
+  COLOR_RED = 1;
+}
+enum HTTPStatus { // The status of a response.
+  HTTP_STATUS_UNSPECIFIED = 0;
+  option allow_alias = true;
+  HTTP_STATUS_OK = 200;
+}
+message M { enum Kind { KIND_UNSPECIFIED = 0; KIND_A = 1; KIND_B = 2; } }
+enum R { reserved 0; R_A = 1; }
+enum S { reserved "S_UNSPECIFIED"; S_A = 1; }
+`, []string{
+				"13:1: enum R must have a zero value",
+				"14:1: enum S must have a zero value",
+			},
+		},
+		{"closed enums",
+			[]string{"ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH"}, `syntax = "proto2";
+enum Color { COLOR_RED = 1; }
+`, `syntax = "proto2";
+enum Color { COLOR_RED = 1; }
+`, []string{"2:1: enum Color must have a zero value"},
+		},
+		{"editions",
+			[]string{"ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH"}, `edition = "2023";
+enum Open { OPEN_A = 1; }
+enum Closed { option features.enum_type = CLOSED; CLOSED_A = 1; }
+`, `edition = "2023";
+enum Open { OPEN_UNSPECIFIED = 0; OPEN_A = 1; }
+enum Closed { option features.enum_type = CLOSED; CLOSED_A = 1; }
+`, []string{"3:1: enum Closed must have a zero value"},
+		},
+		{"imports",
+			[]string{"IMPORTS_SORTED"}, `syntax = "proto3";
+
+// Imports are sorted.
+
+import "d.proto"; // last
+import public "b.proto";
+
+/* About a. */
+import "a.proto";
+import "c.proto";
+
+message M {}
+`, `syntax = "proto3";
+
+// Imports are sorted.
+
+/* About a. */
+import "a.proto";
+import public "b.proto";
+
+import "c.proto";
+import "d.proto"; // last
+
+message M {}
+`, nil,
+		},
+		{"imports sharing lines",
+			[]string{"IMPORTS_SORTED"}, `syntax = "proto3";
+import "b.proto"; import "a.proto";
+`, `syntax = "proto3";
+import "b.proto"; import "a.proto";
+`, []string{`2:19: import "a.proto" must come before "b.proto"`},
+		},
+		{"several rules",
+			[]string{"FIELD_NAMES_LOWER_SNAKE_CASE", "IMPORTS_SORTED"}, `syntax = "proto3";
+import "b.proto";
+import "a.proto";
+message M { int32 fooBar = 1; int32 BazQux = 2; }
+`, `syntax = "proto3";
+import "a.proto";
+import "b.proto";
+message M { int32 foo_bar = 1; int32 baz_qux = 2; }
+`, nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []*Rule
+			for _, name := range tt.rules {
+				rules = append(rules, Lookup(name))
+			}
+			out, problems, err := Fix("", []byte(tt.in), rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.out {
+				t.Errorf("expected output:\n%s\ngot:\n%s", tt.out, out)
+			}
+			var got []string
+			for _, p := range problems {
+				got = append(got, p.Pos.String()+": "+p.Msg)
+			}
+			if !reflect.DeepEqual(got, tt.problems) {
+				t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(tt.problems, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestFixOverlapping(t *testing.T) {
+	// suffix reports twice that message names must end with Msg, with the
+	// same fix, so the second one must be discarded once the first is applied.
+	suffix := &Rule{Name: "SUFFIX", Check: func(c *Context) {
+		c.messages(func(m *proto.Message) {
+			if !strings.HasSuffix(string(m.Name), "Msg") {
+				end := c.toks[c.token(m.Pos)+1].End.Offset
+				for i := 0; i < 2; i++ {
+					c.ReportFix(m.Pos, []Edit{{end, end, "Msg"}}, "bad name")
+				}
+			}
+		})
+	}}
+	out, problems, err := Fix("", []byte("message Foo {}\nmessage BarMsg {}\n"), []*Rule{suffix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "message FooMsg {}\nmessage BarMsg {}\n"; string(out) != want || len(problems) > 0 {
+		t.Errorf("expected %q and no problems, got %q and %v", want, out, problems)
+	}
+}
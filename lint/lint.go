@@ -0,0 +1,269 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint checks that .proto files follow style conventions, such as
+// the ones of the Protocol Buffers style guide.
+//
+// Each convention is checked by a Rule, identified by its name. The rules
+// provided by this package are registered when it is initialized, and
+// more can be added with Register.
+//
+// Problems can be suppressed with comments in the linted file:
+//
+//	// protolint:disable RULE...       disables the rules until enabled again
+//	// protolint:enable RULE...        enables the rules again
+//	// protolint:disable:next RULE...  disables the rules on the next line
+//	// protolint:disable:this RULE...  disables the rules on the same line
+//
+// Without rule names, the comments apply to all the rules.
+//
+// Rules can also provide fixes for the problems they find, as edits of the
+// source of the file, which are applied by Fix. The edits only touch the
+// bytes they fix, keeping the comments and formatting of the rest of the file.
+package lint
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/scanner"
+	"github.com/campoy/groto/token"
+)
+
+// A Problem is a violation of a rule.
+type Problem struct {
+	Pos  token.Position
+	Rule string
+	Msg  string
+	Fix  []Edit // edits fixing the problem, if it can be fixed automatically.
+}
+
+// String returns the message of the problem, prefixed by its position and
+// followed by the name of the rule.
+func (p Problem) String() string {
+	return fmt.Sprintf("%s: %s (%s)", p.Pos, p.Msg, p.Rule)
+}
+
+// A Rule checks a convention on a file, and reports the places where it
+// is not followed.
+type Rule struct {
+	Name  string // name of the rule, in UPPER_SNAKE_CASE.
+	Doc   string // one line description of the convention.
+	Check func(c *Context)
+}
+
+// A Context gives a rule access to the file being linted, and collects the
+// problems it reports.
+type Context struct {
+	Filename string
+	File     *proto.File
+
+	rule     *Rule
+	problems []Problem
+	src      []byte
+	toks     []scanner.Token // all the tokens, including comments.
+}
+
+// Reportf reports a problem at the given position.
+func (c *Context) Reportf(pos token.Position, format string, args ...interface{}) {
+	c.ReportFix(pos, nil, format, args...)
+}
+
+// ReportFix reports a problem at the given position, which is fixed by
+// applying the given edits to the source of the file.
+func (c *Context) ReportFix(pos token.Position, fix []Edit, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Pos: pos, Rule: c.rule.Name, Msg: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+var registry = map[string]*Rule{}
+
+// Register adds a rule to the registry. It panics if a rule with the same
+// name was already registered.
+func Register(r *Rule) {
+	if r.Name == "" || r.Check == nil {
+		panic("lint: rules must have a name and a Check function")
+	}
+	if _, ok := registry[r.Name]; ok {
+		panic("lint: rule " + r.Name + " registered twice")
+	}
+	registry[r.Name] = r
+}
+
+// Rules returns all the registered rules, sorted by name.
+func Rules() []*Rule {
+	var rules []*Rule
+	for _, r := range registry {
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+// Lookup returns the registered rule with the given name, or nil.
+func Lookup(name string) *Rule { return registry[name] }
+
+// Select returns the registered rules with the names in enable, or all of
+// them if enable is empty, except the ones in disable. It fails if any of
+// the names is unknown.
+func Select(enable, disable []string) ([]*Rule, error) {
+	for _, name := range append(enable, disable...) {
+		if Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown rule %s", name)
+		}
+	}
+	in := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	var rules []*Rule
+	for _, r := range Rules() {
+		if (len(enable) == 0 || in(enable, r.Name)) && !in(disable, r.Name) {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+// Lint parses the given source and checks it with the given rules. It
+// returns the problems found, sorted by position, except the ones
+// suppressed by comments, or the error found while parsing.
+func Lint(filename string, src []byte, rules []*Rule) ([]Problem, error) {
+	f, err := parser.ParseFile(filename, bytes.NewReader(src), 0)
+	if err != nil {
+		return nil, err
+	}
+	toks := tokens(filename, src)
+	sup := suppressions(toks)
+
+	var problems []Problem
+	for _, r := range rules {
+		c := &Context{Filename: filename, File: f, rule: r, src: src, toks: toks}
+		r.Check(c)
+		for _, p := range c.problems {
+			if !sup.suppressed(p) {
+				problems = append(problems, p)
+			}
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Pos, problems[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return problems, nil
+}
+
+// A suppression disables some rules, or all of them if rules is nil,
+// between two lines, both included.
+type suppression struct {
+	rules    []string
+	from, to int
+}
+
+type suppressionList []suppression
+
+func (l suppressionList) suppressed(p Problem) bool {
+	for _, s := range l {
+		if p.Pos.Line < s.from || p.Pos.Line > s.to {
+			continue
+		}
+		if s.rules == nil {
+			return true
+		}
+		for _, r := range s.rules {
+			if r == p.Rule {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// suppressions returns the suppressions defined by the comments in the
+// given tokens.
+func suppressions(toks []scanner.Token) suppressionList {
+	const prefix = "protolint:"
+	var list suppressionList
+	open := map[string]int{} // line where each disabled rule was disabled.
+	lines := 0
+	for _, tok := range toks {
+		lines = tok.End.Line
+		if !tok.Is(token.Comment) {
+			continue
+		}
+		text := strings.TrimPrefix(tok.Text, "//")
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+		fields := strings.Fields(text)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], prefix) {
+			continue
+		}
+		rules := fields[1:]
+		keys := rules
+		if len(keys) == 0 {
+			rules, keys = nil, []string{""}
+		}
+		switch fields[0][len(prefix):] {
+		case "disable":
+			for _, k := range keys {
+				if _, ok := open[k]; !ok {
+					open[k] = tok.Pos.Line
+				}
+			}
+		case "enable":
+			for _, k := range keys {
+				if from, ok := open[k]; ok {
+					list = append(list, suppression{ruleList(k), from, tok.Pos.Line})
+					delete(open, k)
+				}
+			}
+		case "disable:next":
+			list = append(list, suppression{rules, tok.End.Line + 1, tok.End.Line + 1})
+		case "disable:this":
+			list = append(list, suppression{rules, tok.Pos.Line, tok.Pos.Line})
+		}
+	}
+	for k, from := range open {
+		list = append(list, suppression{ruleList(k), from, lines})
+	}
+	return list
+}
+
+// ruleList returns the rules suppressed by the given key of the open
+// suppressions: all of them for the empty key, or the named one.
+func ruleList(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return []string{key}
+}
+
+// tokens returns all the tokens in the given source, including comments
+// but not the final EOF.
+func tokens(filename string, src []byte) []scanner.Token {
+	var toks []scanner.Token
+	sc := scanner.NewFile(filename, bytes.NewReader(src))
+	for {
+		tok := sc.Scan()
+		if tok.Is(token.EOF) {
+			return toks
+		}
+		toks = append(toks, tok)
+	}
+}
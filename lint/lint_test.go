@@ -0,0 +1,164 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/campoy/groto/parser"
+)
+
+// problems lints the given source with the given rules, and returns the
+// problems found formatted as strings.
+func problems(t *testing.T, filename, src string, rules ...*Rule) []string {
+	t.Helper()
+	ps, err := Lint(filename, []byte(src), rules)
+	if err != nil {
+		t.Fatalf("could not lint: %v\n%s", err, src)
+	}
+	var res []string
+	for _, p := range ps {
+		res = append(res, p.String())
+	}
+	return res
+}
+
+func names(rules []*Rule) []string {
+	var res []string
+	for _, r := range rules {
+		res = append(res, r.Name)
+	}
+	return res
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		name            string
+		enable, disable []string
+		want            []string
+		err             string
+	}{
+		{"enable", []string{"RPCS_HAVE_COMMENT", "ENUMS_HAVE_COMMENT"}, nil,
+			[]string{"ENUMS_HAVE_COMMENT", "RPCS_HAVE_COMMENT"}, ""},
+		{"enable and disable", []string{"RPCS_HAVE_COMMENT", "ENUMS_HAVE_COMMENT"}, []string{"RPCS_HAVE_COMMENT"},
+			[]string{"ENUMS_HAVE_COMMENT"}, ""},
+		{"unknown", []string{"RPCS_HAVE_COMMENT"}, []string{"FOO"}, nil, "unknown rule FOO"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Select(tt.enable, tt.disable)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected rules %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	all, err := Select(nil, []string{"RPCS_HAVE_COMMENT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(Rules())-1 || Lookup("RPCS_HAVE_COMMENT") == nil {
+		t.Errorf("expected all rules but RPCS_HAVE_COMMENT, got %v", names(all))
+	}
+}
+
+func TestRegister(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic registering a rule twice")
+		}
+	}()
+	Register(&Rule{Name: "MESSAGE_NAMES_UPPER_CAMEL_CASE", Check: func(*Context) {}})
+}
+
+func TestSuppressions(t *testing.T) {
+	rules := []*Rule{Lookup("MESSAGE_NAMES_UPPER_CAMEL_CASE"), Lookup("MESSAGES_HAVE_COMMENT")}
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"none", `
+			syntax = "proto3";
+			message foo {}`,
+			[]string{
+				"3:4: message name foo must be UpperCamelCase (MESSAGE_NAMES_UPPER_CAMEL_CASE)",
+				"3:4: message foo must have a leading comment (MESSAGES_HAVE_COMMENT)",
+			},
+		},
+		{"this line", `
+			syntax = "proto3";
+			message foo {} // protolint:disable:this MESSAGES_HAVE_COMMENT
+			message bar {} /* protolint:disable:this */`,
+			[]string{"3:4: message name foo must be UpperCamelCase (MESSAGE_NAMES_UPPER_CAMEL_CASE)"},
+		},
+		{"next line", `
+			syntax = "proto3";
+			// protolint:disable:next MESSAGE_NAMES_UPPER_CAMEL_CASE
+			message foo {}
+			message bar {}`,
+			[]string{
+				"4:4: message foo must have a leading comment (MESSAGES_HAVE_COMMENT)",
+				"5:4: message name bar must be UpperCamelCase (MESSAGE_NAMES_UPPER_CAMEL_CASE)",
+				"5:4: message bar must have a leading comment (MESSAGES_HAVE_COMMENT)",
+			},
+		},
+		{"region", `
+			syntax = "proto3";
+			// protolint:disable MESSAGES_HAVE_COMMENT MESSAGE_NAMES_UPPER_CAMEL_CASE
+			message foo {}
+			// protolint:enable MESSAGES_HAVE_COMMENT
+			message bar {}`,
+			[]string{"6:4: message bar must have a leading comment (MESSAGES_HAVE_COMMENT)"},
+		},
+		{"whole file", `
+			// protolint:disable
+			syntax = "proto3";
+			message foo {}`,
+			nil,
+		},
+		{"other comments", `
+			syntax = "proto3";
+			// The foo message, see protolint:disable.
+			message foo {}`,
+			[]string{"4:4: message name foo must be UpperCamelCase (MESSAGE_NAMES_UPPER_CAMEL_CASE)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := problems(t, "", tt.in, rules...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(tt.want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestLintParseError(t *testing.T) {
+	_, err := Lint("a.proto", []byte("syntax = \"proto3\";\nmessage {}"), Rules())
+	if _, ok := err.(parser.ErrorList); !ok {
+		t.Fatalf("expected a parser.ErrorList, got %v", err)
+	}
+}
@@ -0,0 +1,515 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"bytes"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// The rules below follow the Protocol Buffers style guide, and are named
+// after the equivalent rules of other linters.
+
+func init() {
+	for _, r := range []*Rule{
+		{"MESSAGE_NAMES_UPPER_CAMEL_CASE", "message names are UpperCamelCase", messageNames},
+		{"ENUM_NAMES_UPPER_CAMEL_CASE", "enum names are UpperCamelCase", enumNames},
+		{"FIELD_NAMES_LOWER_SNAKE_CASE", "field names are lower_snake_case", fieldNames},
+		{"ENUM_FIELD_NAMES_UPPER_SNAKE_CASE", "enum value names are UPPER_SNAKE_CASE", enumValueNames},
+		{"ENUM_FIELD_NAMES_PREFIX", "enum value names are prefixed with the name of their enum in UPPER_SNAKE_CASE", enumValuePrefix},
+		{"ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH", "enums have a zero value, which ends with _UNSPECIFIED", enumZeroValue},
+		{"IMPORTS_SORTED", "imports are sorted by path", importsSorted},
+		{"PACKAGE_DIRECTORY_MATCH", "the package name matches the directory of the file", packageDirectory},
+		{"RPC_REQUEST_STANDARD_NAME", "the request of method Foo is named FooRequest", rpcRequest},
+		{"RPC_RESPONSE_STANDARD_NAME", "the response of method Foo is named FooResponse", rpcResponse},
+		{"MESSAGES_HAVE_COMMENT", "messages have a leading comment", messageComments},
+		{"ENUMS_HAVE_COMMENT", "enums have a leading comment", enumComments},
+		{"SERVICES_HAVE_COMMENT", "services have a leading comment", serviceComments},
+		{"RPCS_HAVE_COMMENT", "methods have a leading comment", rpcComments},
+	} {
+		Register(r)
+	}
+}
+
+var (
+	upperCamelCase = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+	lowerSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	upperSnakeCase = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+)
+
+func messageNames(c *Context) {
+	c.messages(func(m *proto.Message) {
+		if !upperCamelCase.MatchString(string(m.Name)) {
+			c.Reportf(m.Pos, "message name %s must be UpperCamelCase", m.Name)
+		}
+	})
+}
+
+func enumNames(c *Context) {
+	c.enums(func(e *proto.Enum) {
+		if !upperCamelCase.MatchString(string(e.Name)) {
+			c.Reportf(e.Pos, "enum name %s must be UpperCamelCase", e.Name)
+		}
+	})
+}
+
+// fieldNames checks the names of fields, and renames them to fix them,
+// unless the new name is already used or reserved in the same message, or
+// is the new name of another field.
+func fieldNames(c *Context) {
+	check := func(s proto.Span, name proto.Identifier, taken map[string]bool) {
+		if lowerSnakeCase.MatchString(string(name)) {
+			return
+		}
+		want := lowerSnake(string(name))
+		var fix []Edit
+		if pos, end, ok := c.name(s); ok && taken != nil && !taken[want] {
+			fix = []Edit{{pos, end, want}}
+			taken[want] = true
+		}
+		c.ReportFix(s.Pos, fix, "field name %s must be lower_snake_case, such as %s", name, want)
+	}
+	fields := func(fields []proto.Field, taken map[string]bool) {
+		for _, f := range fields {
+			// The name of a group field is the lowercase name of its
+			// message, which is already checked as a message name.
+			if f.Group == nil {
+				check(f.Span, f.Name, taken)
+			}
+		}
+	}
+	c.messages(func(m *proto.Message) {
+		taken := map[string]bool{}
+		for _, f := range m.Fields {
+			taken[string(f.Name)] = true
+		}
+		for _, f := range m.Maps {
+			taken[string(f.Name)] = true
+		}
+		for _, o := range m.OneOfs {
+			taken[string(o.Name)] = true
+			for _, f := range o.Fields {
+				taken[string(f.Name)] = true
+			}
+		}
+		for _, r := range m.Reserveds {
+			for _, name := range r.Names {
+				taken[name] = true
+			}
+		}
+
+		fields(m.Fields, taken)
+		for _, f := range m.Maps {
+			check(f.Span, f.Name, taken)
+		}
+		for _, o := range m.OneOfs {
+			for _, f := range o.Fields {
+				if f.Group == nil {
+					check(f.Span, f.Name, taken)
+				}
+			}
+		}
+	})
+	// Extensions are not renamed, as their names must be unique within
+	// their package, and they might be used in other files.
+	c.extends(func(e *proto.Extend) { fields(e.Fields, nil) })
+}
+
+func enumValueNames(c *Context) {
+	c.enums(func(e *proto.Enum) {
+		for _, v := range e.Fields {
+			if !upperSnakeCase.MatchString(string(v.Name)) {
+				c.Reportf(v.Pos, "enum value name %s must be UPPER_SNAKE_CASE, such as %s", v.Name, upperSnake(string(v.Name)))
+			}
+		}
+	})
+}
+
+func enumValuePrefix(c *Context) {
+	c.enums(func(e *proto.Enum) {
+		prefix := upperSnake(string(e.Name)) + "_"
+		for _, v := range e.Fields {
+			if !strings.HasPrefix(string(v.Name), prefix) {
+				c.Reportf(v.Pos, "enum value name %s must be prefixed with %s", v.Name, prefix)
+			}
+		}
+	})
+}
+
+// enumZeroValue checks the name of the zero value of enums. Open enums
+// without one are fixed by adding it before their first value, unless its
+// name or zero are reserved. Closed enums, such as the ones of proto2, are
+// not fixed, as their first value is the default of the fields of their
+// type, which would change.
+func enumZeroValue(c *Context) {
+	const suffix = "_UNSPECIFIED"
+	c.enumFeatures(func(e *proto.Enum, fs proto.Features) {
+		if len(e.Fields) == 0 {
+			return
+		}
+		for _, v := range e.Fields {
+			if v.Number == 0 {
+				if !strings.HasSuffix(string(v.Name), suffix) {
+					c.Reportf(v.Pos, "the zero value of enum %s must end with %s, found %s", e.Name, suffix, v.Name)
+				}
+				return
+			}
+		}
+		want := upperSnake(string(e.Name)) + suffix
+		if fs.EnumType != proto.OpenEnum || reserved(e, want) {
+			c.Reportf(e.Pos, "enum %s must have a zero value", e.Name)
+			return
+		}
+		c.ReportFix(e.Pos, c.insertValue(e, want+" = 0;"), "enum %s must have a zero value, such as %s", e.Name, want)
+	})
+}
+
+// reserved returns true if the given name, or the number zero, is used or
+// reserved in the given enum.
+func reserved(e *proto.Enum, name string) bool {
+	for _, v := range e.Fields {
+		if string(v.Name) == name {
+			return true
+		}
+	}
+	for _, r := range e.Reserveds {
+		for _, n := range r.Names {
+			if n == name {
+				return true
+			}
+		}
+		for _, rg := range r.Ranges {
+			if rg.From <= 0 && 0 <= rg.To {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insertValue returns the edits inserting the given text at the start of the
+// body of an enum, on its own line if the body is on several lines.
+func (c *Context) insertValue(e *proto.Enum, text string) []Edit {
+	i := c.token(e.Pos)
+	for i < len(c.toks) && !c.toks[i].Is(token.OpenBrace) {
+		i++
+	}
+	if i >= len(c.toks) {
+		return nil
+	}
+	brace := c.toks[i]
+	// Skip the comment following the brace, which describes the enum.
+	for i++; i < len(c.toks) && c.toks[i].Is(token.Comment) && c.toks[i].Pos.Line == brace.Pos.Line; i++ {
+	}
+	if i >= len(c.toks) {
+		return nil
+	}
+	next := c.toks[i].Pos.Offset
+	if c.toks[i].Pos.Line == brace.Pos.Line {
+		return []Edit{{next, next, text + " "}}
+	}
+	start, _ := c.lineStart(next)
+	indent := c.src[start:next]
+	if len(bytes.TrimSpace(indent)) > 0 {
+		indent = nil
+	}
+	return []Edit{{start, start, string(indent) + text + "\n"}}
+}
+
+// importsSorted checks that imports are sorted by path, and sorts them by
+// moving the lines of each import, with its comments, to the lines of the
+// import in its sorted position. They are not sorted if any of them shares
+// its lines with other declarations.
+func importsSorted(c *Context) {
+	imports := c.File.Imports
+	order := make([]int, len(imports))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return imports[order[i]].Path < imports[order[j]].Path })
+
+	first := -1
+	for i := 1; i < len(imports) && first < 0; i++ {
+		if imports[i].Path < imports[i-1].Path {
+			first = i
+		}
+	}
+	if first < 0 {
+		return
+	}
+
+	type lines struct{ start, end int }
+	var ls []lines
+	for _, imp := range imports {
+		start, end, ok := c.lines(imp.Span)
+		if !ok {
+			ls = nil
+			break
+		}
+		ls = append(ls, lines{start, end})
+	}
+	var fix []Edit
+	for i, j := range order {
+		if ls != nil && i != j {
+			fix = append(fix, Edit{ls[i].start, ls[i].end, string(c.src[ls[j].start:ls[j].end])})
+		}
+	}
+	c.ReportFix(imports[first].Pos, fix, "import %q must come before %q", imports[first].Path, imports[first-1].Path)
+}
+
+// packageDirectory checks that the file is in a directory whose path ends
+// with the package name, with dots replaced by slashes. Files that were not
+// read from a .proto file, such as the standard input, are ignored.
+func packageDirectory(c *Context) {
+	pkg := c.File.Package
+	if len(pkg.Identifier) == 0 || !strings.HasSuffix(c.Filename, ".proto") {
+		return
+	}
+	var parts []string
+	for _, id := range pkg.Identifier {
+		parts = append(parts, string(id))
+	}
+	want := strings.Join(parts, "/")
+	dir := path.Clean(filepath.ToSlash(filepath.Dir(c.Filename)))
+	if dir != want && !strings.HasSuffix(dir, "/"+want) {
+		c.Reportf(pkg.Pos, "package %s must be in a directory named %s, found in %s", strings.Join(parts, "."), want, dir)
+	}
+}
+
+func rpcRequest(c *Context) {
+	c.rpcs(func(r *proto.RPC) { rpcParam(c, r.In, string(r.Name)+"Request", "request") })
+}
+
+func rpcResponse(c *Context) {
+	c.rpcs(func(r *proto.RPC) { rpcParam(c, r.Out, string(r.Name)+"Response", "response") })
+}
+
+// rpcParam checks that the message used as a request or response is named
+// as expected, regardless of the package it is in.
+func rpcParam(c *Context, p proto.RPCParam, want, kind string) {
+	if len(p.Type) == 0 {
+		return
+	}
+	if got := p.Type[len(p.Type)-1]; string(got) != want {
+		c.Reportf(p.Pos, "%s message %s must be named %s", kind, got, want)
+	}
+}
+
+func messageComments(c *Context) {
+	// The comments of groups are attached to their fields, which don't
+	// require them.
+	c.walkMessages(func(m *proto.Message, group bool) {
+		if !documented(m.Comments) && !group {
+			c.Reportf(m.Pos, "message %s must have a leading comment", m.Name)
+		}
+	})
+}
+
+func enumComments(c *Context) {
+	c.enums(func(e *proto.Enum) {
+		if !documented(e.Comments) {
+			c.Reportf(e.Pos, "enum %s must have a leading comment", e.Name)
+		}
+	})
+}
+
+func serviceComments(c *Context) {
+	for i := range c.File.Services {
+		s := &c.File.Services[i]
+		if !documented(s.Comments) {
+			c.Reportf(s.Pos, "service %s must have a leading comment", s.Name)
+		}
+	}
+}
+
+func rpcComments(c *Context) {
+	c.rpcs(func(r *proto.RPC) {
+		if !documented(r.Comments) {
+			c.Reportf(r.Pos, "method %s must have a leading comment", r.Name)
+		}
+	})
+}
+
+// documented returns true if the given comments have a leading comment,
+// ignoring the lines of the comments that suppress problems.
+func documented(c proto.Comments) bool {
+	for _, line := range strings.Split(c.LeadingComments, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "protolint:") {
+			return true
+		}
+	}
+	return false
+}
+
+// messages calls f for each message in the file, including nested messages
+// and the messages of groups, in the order they are defined.
+func (c *Context) messages(f func(m *proto.Message)) {
+	c.walkMessages(func(m *proto.Message, group bool) { f(m) })
+}
+
+// walkMessages is like messages, but also tells f whether the message is the
+// body of a group.
+func (c *Context) walkMessages(f func(m *proto.Message, group bool)) {
+	var walk func(m *proto.Message, group bool)
+	groups := func(fields []proto.Field) {
+		for i := range fields {
+			if g := fields[i].Group; g != nil {
+				walk(g, true)
+			}
+		}
+	}
+	walk = func(m *proto.Message, group bool) {
+		f(m, group)
+		groups(m.Fields)
+		for _, o := range m.OneOfs {
+			for _, fl := range o.Fields {
+				if fl.Group != nil {
+					walk(fl.Group, true)
+				}
+			}
+		}
+		for i := range m.Messages {
+			walk(&m.Messages[i], false)
+		}
+		for i := range m.Extends {
+			groups(m.Extends[i].Fields)
+		}
+	}
+	for i := range c.File.Messages {
+		walk(&c.File.Messages[i], false)
+	}
+	for i := range c.File.Extends {
+		groups(c.File.Extends[i].Fields)
+	}
+}
+
+// enums calls f for each enum in the file, including nested enums.
+func (c *Context) enums(f func(e *proto.Enum)) {
+	for i := range c.File.Enums {
+		f(&c.File.Enums[i])
+	}
+	c.messages(func(m *proto.Message) {
+		for i := range m.Enums {
+			f(&m.Enums[i])
+		}
+	})
+}
+
+// enumFeatures is like enums, but also gives f the features of each enum,
+// resolved from the options of the file and of the messages it is nested in.
+func (c *Context) enumFeatures(f func(e *proto.Enum, fs proto.Features)) {
+	var walk func(m *proto.Message, fs proto.Features)
+	groups := func(fields []proto.Field, fs proto.Features) {
+		for _, fl := range fields {
+			if fl.Group != nil {
+				walk(fl.Group, fs)
+			}
+		}
+	}
+	walk = func(m *proto.Message, fs proto.Features) {
+		fs = fs.Message(*m)
+		for i := range m.Enums {
+			f(&m.Enums[i], fs.Enum(m.Enums[i]))
+		}
+		groups(m.Fields, fs)
+		for _, o := range m.OneOfs {
+			for _, fl := range o.Fields {
+				if fl.Group != nil {
+					walk(fl.Group, fs)
+				}
+			}
+		}
+		for i := range m.Messages {
+			walk(&m.Messages[i], fs)
+		}
+		for _, e := range m.Extends {
+			groups(e.Fields, fs)
+		}
+	}
+	fs := c.File.Features()
+	for i := range c.File.Enums {
+		f(&c.File.Enums[i], fs.Enum(c.File.Enums[i]))
+	}
+	for i := range c.File.Messages {
+		walk(&c.File.Messages[i], fs)
+	}
+	for _, e := range c.File.Extends {
+		groups(e.Fields, fs)
+	}
+}
+
+// extends calls f for each extend block in the file, including the ones
+// nested in messages.
+func (c *Context) extends(f func(e *proto.Extend)) {
+	for i := range c.File.Extends {
+		f(&c.File.Extends[i])
+	}
+	c.messages(func(m *proto.Message) {
+		for i := range m.Extends {
+			f(&m.Extends[i])
+		}
+	})
+}
+
+// rpcs calls f for each method of each service in the file.
+func (c *Context) rpcs(f func(r *proto.RPC)) {
+	for i := range c.File.Services {
+		for j := range c.File.Services[i].RPCs {
+			f(&c.File.Services[i].RPCs[j])
+		}
+	}
+}
+
+// words splits a name in words, at underscores and at changes of case, so
+// that both FooBar and HTTPServer, or foo_bar, have two words.
+func words(name string) []string {
+	var res []string
+	rs := []rune(name)
+	start := 0
+	for i, r := range rs {
+		switch {
+		case r == '_':
+			if i > start {
+				res = append(res, string(rs[start:i]))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			prev := rs[i-1]
+			next := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && next {
+				res = append(res, string(rs[start:i]))
+				start = i
+			}
+		}
+	}
+	if start < len(rs) {
+		res = append(res, string(rs[start:]))
+	}
+	return res
+}
+
+// lowerSnake returns the given name in lower_snake_case.
+func lowerSnake(name string) string { return strings.ToLower(strings.Join(words(name), "_")) }
+
+// upperSnake returns the given name in UPPER_SNAKE_CASE.
+func upperSnake(name string) string { return strings.ToUpper(strings.Join(words(name), "_")) }
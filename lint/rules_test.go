@@ -0,0 +1,243 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		filename string
+		in       string
+		want     []string
+	}{
+		{"MESSAGE_NAMES_UPPER_CAMEL_CASE", "", `
+			syntax = "proto2";
+			message FooBar {
+				message foo_bar {}
+				optional group Baz = 1 {}
+			}
+			message HTTPRequest2 {}
+			message fooBar {}`,
+			[]string{
+				"4:5: message name foo_bar must be UpperCamelCase",
+				"8:4: message name fooBar must be UpperCamelCase",
+			},
+		},
+		{"ENUM_NAMES_UPPER_CAMEL_CASE", "", `
+			syntax = "proto3";
+			enum FooBar { A = 0; }
+			message M { enum foo_bar { A = 0; } }`,
+			[]string{"4:16: enum name foo_bar must be UpperCamelCase"},
+		},
+		{"FIELD_NAMES_LOWER_SNAKE_CASE", "", `
+			syntax = "proto2";
+			message M {
+				optional int32 foo_bar2 = 1;
+				optional int32 fooBar = 2;
+				map<string, int32> HTTPHeaders = 3;
+				oneof o { string Name = 4; group Choice = 6 { optional int32 Y = 1; } }
+				optional group Group = 5 { optional int32 X = 1; }
+				extensions 10 to 20;
+				extend M { optional int32 ext_A = 10; }
+			}
+			extend M { optional int32 Ext = 11; }`,
+			[]string{
+				"5:5: field name fooBar must be lower_snake_case, such as foo_bar",
+				"6:5: field name HTTPHeaders must be lower_snake_case, such as http_headers",
+				"7:15: field name Name must be lower_snake_case, such as name",
+				"7:51: field name Y must be lower_snake_case, such as y",
+				"8:32: field name X must be lower_snake_case, such as x",
+				"10:16: field name ext_A must be lower_snake_case, such as ext_a",
+				"12:15: field name Ext must be lower_snake_case, such as ext",
+			},
+		},
+		{"ENUM_FIELD_NAMES_UPPER_SNAKE_CASE", "", `
+			syntax = "proto3";
+			enum E {
+				E_UNSPECIFIED = 0;
+				E_V2 = 1;
+				e_lower = 2;
+				MixedCase = 3;
+			}`,
+			[]string{
+				"6:5: enum value name e_lower must be UPPER_SNAKE_CASE, such as E_LOWER",
+				"7:5: enum value name MixedCase must be UPPER_SNAKE_CASE, such as MIXED_CASE",
+			},
+		},
+		{"ENUM_FIELD_NAMES_PREFIX", "", `
+			syntax = "proto3";
+			enum HTTPStatus { HTTP_STATUS_OK = 0; OK = 1; }
+			message M { enum Kind { KIND_A = 0; KINDB = 1; } }`,
+			[]string{
+				"3:42: enum value name OK must be prefixed with HTTP_STATUS_",
+				"4:40: enum value name KINDB must be prefixed with KIND_",
+			},
+		},
+		{"ENUM_FIELD_NAMES_ZERO_VALUE_END_WITH", "", `
+			syntax = "proto2";
+			enum A { A_UNSPECIFIED = 0; }
+			enum B { B_UNKNOWN = 0; }
+			enum C { C_ONE = 1; C_ZERO = 0; }
+			enum D { D_ONE = 1; }
+			enum E { E_UNSPECIFIED = 1; }
+			enum F {}`,
+			[]string{
+				"4:13: the zero value of enum B must end with _UNSPECIFIED, found B_UNKNOWN",
+				"5:24: the zero value of enum C must end with _UNSPECIFIED, found C_ZERO",
+				"6:4: enum D must have a zero value",
+				"7:4: enum E must have a zero value",
+			},
+		},
+		{"PACKAGE_DIRECTORY_MATCH", "proto/foo/bar/a.proto", `
+			syntax = "proto3";
+			package foo.bar;`,
+			nil,
+		},
+		{"PACKAGE_DIRECTORY_MATCH", "foo/bar/a.proto", `
+			syntax = "proto3";
+			package foo.bar;`,
+			nil,
+		},
+		{"PACKAGE_DIRECTORY_MATCH", "afoo/bar/a.proto", `
+			syntax = "proto3";
+			package foo.bar;`,
+			[]string{"3:4: package foo.bar must be in a directory named foo/bar, found in afoo/bar"},
+		},
+		{"PACKAGE_DIRECTORY_MATCH", "a.proto", `
+			syntax = "proto3";
+			package foo;`,
+			[]string{"3:4: package foo must be in a directory named foo, found in ."},
+		},
+		{"PACKAGE_DIRECTORY_MATCH", "", `
+			syntax = "proto3";
+			package foo;`,
+			nil,
+		},
+		{"IMPORTS_SORTED", "", `
+			syntax = "proto3";
+			import "a.proto";
+			import public "c.proto";
+			import "b.proto";
+			import "d.proto";`,
+			[]string{`5:4: import "b.proto" must come before "c.proto"`},
+		},
+		{"RPC_REQUEST_STANDARD_NAME", "", `
+			syntax = "proto3";
+			service S {
+				rpc Get(GetRequest) returns (GetResponse);
+				rpc List(foo.ListRequest) returns (stream Other);
+				rpc Delete(stream Other) returns (Other);
+			}`,
+			[]string{"6:15: request message Other must be named DeleteRequest"},
+		},
+		{"RPC_RESPONSE_STANDARD_NAME", "", `
+			syntax = "proto3";
+			service S {
+				rpc Get(GetRequest) returns (GetResponse);
+				rpc List(ListRequest) returns (stream foo.Other);
+			}`,
+			[]string{"5:35: response message Other must be named ListResponse"},
+		},
+		{"MESSAGES_HAVE_COMMENT", "", `
+			syntax = "proto2";
+			// A is documented.
+			message A {
+				/* B is documented. */
+				message B {}
+				message C {}
+				optional group G = 1 {}
+			}
+
+			// D is not, since this comment is detached.
+
+			message D {}`,
+			[]string{
+				"7:5: message C must have a leading comment",
+				"13:4: message D must have a leading comment",
+			},
+		},
+		{"ENUMS_HAVE_COMMENT", "", `
+			syntax = "proto3";
+			// A is documented.
+			enum A { X = 0; }
+			message M { enum B { Y = 0; } }`,
+			[]string{"5:16: enum B must have a leading comment"},
+		},
+		{"SERVICES_HAVE_COMMENT", "", `
+			syntax = "proto3";
+			// A is documented.
+			service A {}
+			service B {} // trailing comments are not enough.`,
+			[]string{"5:4: service B must have a leading comment"},
+		},
+		{"RPCS_HAVE_COMMENT", "", `
+			syntax = "proto3";
+			service S {
+				// Get is documented.
+				rpc Get(GetRequest) returns (GetResponse);
+				rpc List(ListRequest) returns (ListResponse);
+			}`,
+			[]string{"6:5: method List must have a leading comment"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r := Lookup(tt.rule)
+			if r == nil {
+				t.Fatalf("unknown rule %s", tt.rule)
+			}
+			var want []string
+			for _, w := range tt.want {
+				want = append(want, w+" ("+tt.rule+")")
+			}
+			if tt.filename != "" {
+				for i := range want {
+					want[i] = tt.filename + ":" + want[i]
+				}
+			}
+			got := problems(t, tt.filename, tt.in, r)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		in, lower, upper string
+	}{
+		{"FooBar", "foo_bar", "FOO_BAR"},
+		{"fooBar", "foo_bar", "FOO_BAR"},
+		{"HTTPServer", "http_server", "HTTP_SERVER"},
+		{"HTTP2Server", "http2_server", "HTTP2_SERVER"},
+		{"Foo2Bar", "foo2_bar", "FOO2_BAR"},
+		{"foo__bar_", "foo_bar", "FOO_BAR"},
+		{"FOO_BAR", "foo_bar", "FOO_BAR"},
+		{"x", "x", "X"},
+	}
+	for _, tt := range tests {
+		if got := lowerSnake(tt.in); got != tt.lower {
+			t.Errorf("lowerSnake(%q) = %q; want %q", tt.in, got, tt.lower)
+		}
+		if got := upperSnake(tt.in); got != tt.upper {
+			t.Errorf("upperSnake(%q) = %q; want %q", tt.in, got, tt.upper)
+		}
+	}
+}
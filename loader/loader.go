@@ -0,0 +1,178 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package loader provides a Loader, which parses .proto files and all the
+// files they import, looking for them in a list of directories as protoc
+// does with its -I flag.
+//
+// Files are identified by the path used to import them, which is relative
+// to the directory where they were found and uses forward slashes, such as
+// "google/protobuf/empty.proto". The positions in the parsed files refer to
+// that path too, as in the errors reported by protoc, so the files can be
+// converted to descriptors with package desc.
+//
+// The files distributed with protoc, provided by package wellknown, are
+// always available, but files with the same names in the import paths take
+// precedence.
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/campoy/groto/internal/errlist"
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+	"github.com/campoy/groto/wellknown"
+)
+
+// An Error describes a file that could not be loaded, at the position of
+// the import statement, if any.
+type Error = errlist.Error
+
+// A Loader loads .proto files and, recursively, the files they import.
+type Loader struct {
+	// ImportPaths lists the directories where files are looked for, in
+	// order. If empty, files are looked for in the current directory.
+	ImportPaths []string
+
+	// Mode controls the behavior of the parser.
+	Mode parser.Mode
+}
+
+// A File is a parsed file, with the files it imports.
+type File struct {
+	Name     string      // path used to import the file.
+	Filename string      // path of the file in the file system, or Name if embedded.
+	Proto    *proto.File // parsed contents of the file.
+	Imports  []*File     // imported files, in the order of the import statements.
+}
+
+// Visible returns the files whose definitions can be used in f: f itself,
+// the files it imports, and the files they import publicly, recursively.
+func (f *File) Visible() []*File {
+	files := []*File{f}
+	seen := map[*File]bool{f: true}
+	var public func(f *File)
+	public = func(f *File) {
+		for i, imp := range f.Imports {
+			if f.Proto.Imports[i].Modifier == proto.PublicImport && !seen[imp] {
+				seen[imp] = true
+				files = append(files, imp)
+				public(imp)
+			}
+		}
+	}
+	for _, imp := range f.Imports {
+		if !seen[imp] {
+			seen[imp] = true
+			files = append(files, imp)
+			public(imp)
+		}
+	}
+	return files
+}
+
+// Load loads the files with the given names, and all the files they import.
+// It returns all the loaded files ordered so that every file comes after
+// the ones it imports, and the given files are in the given order when
+// possible.
+//
+// Load fails if a file can't be found or parsed, or if some files import
+// each other. Parsing errors are returned as a parser.ErrorList, and the
+// rest as an *Error.
+func (l *Loader) Load(names ...string) ([]*File, error) {
+	s := &state{loader: l, files: map[string]*File{}}
+	for _, name := range names {
+		if _, err := s.load(name, token.Position{}); err != nil {
+			return nil, err
+		}
+	}
+	return s.order, nil
+}
+
+// state holds the files loaded so far by a call to Load.
+type state struct {
+	loader *Loader
+	files  map[string]*File
+	order  []*File
+	stack  []string // names of the files being loaded.
+}
+
+// load loads the file with the given name, imported at the given position.
+func (s *state) load(name string, pos token.Position) (*File, error) {
+	if f, ok := s.files[name]; ok {
+		return f, nil
+	}
+	for i, prev := range s.stack {
+		if prev == name {
+			cycle := append(append([]string(nil), s.stack[i:]...), name)
+			return nil, &Error{Pos: pos, Msg: "import cycle not allowed: " + strings.Join(cycle, " -> ")}
+		}
+	}
+
+	filename, src, err := s.loader.find(name)
+	if err != nil {
+		return nil, &Error{Pos: pos, Msg: err.Error()}
+	}
+	p, err := parser.ParseFile(name, bytes.NewReader(src), s.loader.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Name: name, Filename: filename, Proto: p}
+	s.stack = append(s.stack, name)
+	for _, imp := range p.Imports {
+		dep, err := s.load(imp.Path, imp.Pos)
+		if err != nil {
+			return nil, err
+		}
+		f.Imports = append(f.Imports, dep)
+	}
+	s.stack = s.stack[:len(s.stack)-1]
+
+	s.files[name] = f
+	s.order = append(s.order, f)
+	return f, nil
+}
+
+// find returns the path and contents of the file with the given name,
+// from the first import path that contains it, or the well-known files.
+func (l *Loader) find(name string) (string, []byte, error) {
+	if !fs.ValidPath(name) || strings.Contains(name, `\`) {
+		return "", nil, fmt.Errorf("invalid import path %q", name)
+	}
+	dirs := l.ImportPaths
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	for _, dir := range dirs {
+		src, err := fs.ReadFile(os.DirFS(dir), name)
+		if err == nil {
+			return filepath.Join(dir, filepath.FromSlash(name)), src, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", nil, err
+		}
+	}
+	if src, err := fs.ReadFile(wellknown.FS, name); err == nil {
+		return name, src, nil
+	}
+	return "", nil, fmt.Errorf("file not found: %s", name)
+}
@@ -0,0 +1,205 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/campoy/groto/desc"
+	"github.com/campoy/groto/parser"
+)
+
+// write creates the given files, indexed by their slash separated paths
+// relative to dir.
+func write(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func names(files []*File) []string {
+	var res []string
+	for _, f := range files {
+		res = append(res, f.Name)
+	}
+	return res
+}
+
+func TestLoad(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	write(t, a, map[string]string{
+		"main.proto":    `import "foo/a.proto"; import "b.proto";`,
+		"foo/a.proto":   `import public "b.proto"; import "c.proto";`,
+		"b.proto":       `import public "foo/d.proto";`,
+		"c.proto":       ``,
+		"other.proto":   `import "c.proto";`,
+		"shadow.proto":  `// Found first.`,
+		"foo/d.proto":   ``,
+		"unused.proto":  `import "missing.proto";`,
+		"foo/bad.proto": `message {}`,
+	})
+	write(t, b, map[string]string{
+		"shadow.proto": `// Found last.`,
+		"extra.proto":  `import "shadow.proto";`,
+	})
+
+	l := &Loader{ImportPaths: []string{a, b}}
+	files, err := l.Load("main.proto", "extra.proto", "other.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"foo/d.proto", "b.proto", "c.proto", "foo/a.proto", "main.proto", "shadow.proto", "extra.proto", "other.proto"}
+	if got := names(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected files %v, got %v", want, got)
+	}
+
+	main, a1 := files[4], files[3]
+	if got := names(main.Imports); !reflect.DeepEqual(got, []string{"foo/a.proto", "b.proto"}) {
+		t.Errorf("unexpected imports of main.proto: %v", got)
+	}
+	if main.Imports[0] != a1 || a1.Imports[0] != files[1] {
+		t.Errorf("imported files should be shared")
+	}
+	if want := filepath.Join(a, "foo", "a.proto"); a1.Filename != want {
+		t.Errorf("expected filename %s, got %s", want, a1.Filename)
+	}
+	if want := filepath.Join(a, "shadow.proto"); files[5].Filename != want {
+		t.Errorf("expected shadow.proto to be found in the first import path, got %s", files[5].Filename)
+	}
+
+	visible := []string{"main.proto", "foo/a.proto", "b.proto", "foo/d.proto"}
+	if got := names(main.Visible()); !reflect.DeepEqual(got, visible) {
+		t.Errorf("expected visible files %v, got %v", visible, got)
+	}
+}
+
+func TestLoadWellKnown(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, map[string]string{
+		"main.proto":                  `import "google/protobuf/api.proto"; import "google/protobuf/empty.proto";`,
+		"google/protobuf/empty.proto": `// Replaced.`,
+	})
+	l := &Loader{ImportPaths: []string{dir}}
+	files, err := l.Load("main.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"google/protobuf/source_context.proto",
+		"google/protobuf/any.proto",
+		"google/protobuf/type.proto",
+		"google/protobuf/api.proto",
+		"google/protobuf/empty.proto",
+		"main.proto",
+	}
+	if got := names(files); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected files %v, got %v", want, got)
+	}
+	if f := files[3]; f.Filename != f.Name || len(f.Proto.Messages) == 0 {
+		t.Errorf("expected api.proto to be the embedded one, got %s", f.Filename)
+	}
+	if want := filepath.Join(dir, "google", "protobuf", "empty.proto"); files[4].Filename != want {
+		t.Errorf("expected empty.proto to be found in the import path, got %s", files[4].Filename)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, map[string]string{
+		"a.proto":       "syntax = \"proto3\";\nimport \"b.proto\";\n",
+		"b.proto":       "syntax = \"proto3\";\nimport \"c.proto\";\n",
+		"c.proto":       "syntax = \"proto3\";\nimport \"a.proto\";\n",
+		"self.proto":    `import "self.proto";`,
+		"missing.proto": "\n\nimport \"nope.proto\";",
+		"bad.proto":     "message {}",
+		"dot.proto":     `import "./c.proto";`,
+	})
+	pos := func(name string, line, column int) string {
+		return fmt.Sprintf("%s:%d:%d: ", name, line, column)
+	}
+
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"a.proto", pos("c.proto", 2, 1) + "import cycle not allowed: a.proto -> b.proto -> c.proto -> a.proto"},
+		{"self.proto", pos("self.proto", 1, 1) + "import cycle not allowed: self.proto -> self.proto"},
+		{"missing.proto", pos("missing.proto", 3, 1) + "file not found: nope.proto"},
+		{"dot.proto", pos("dot.proto", 1, 1) + `invalid import path "./c.proto"`},
+		{"nope.proto", "file not found: nope.proto"},
+		{"../a.proto", `invalid import path "../a.proto"`},
+	}
+	for _, tt := range tests {
+		l := &Loader{ImportPaths: []string{dir}}
+		_, err := l.Load(tt.name)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("%s: expected an *Error, got %v", tt.name, err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("%s: expected error %q, got %q", tt.name, tt.err, err)
+		}
+	}
+
+	l := &Loader{ImportPaths: []string{dir}}
+	_, err := l.Load("bad.proto")
+	var errs parser.ErrorList
+	if !errors.As(err, &errs) || !strings.HasPrefix(err.Error(), "bad.proto:1:9: ") {
+		t.Errorf("expected a parser error in bad.proto, got %v", err)
+	}
+}
+
+func TestLoadDescriptors(t *testing.T) {
+	dir := t.TempDir()
+	write(t, dir, map[string]string{
+		"foo/a.proto": "syntax = \"proto3\";\npackage foo;\nmessage A {}\n",
+		"foo/b.proto": "syntax = \"proto3\";\npackage foo;\nimport \"foo/a.proto\";\nmessage B { A a = 1; }\n",
+	})
+	l := &Loader{ImportPaths: []string{dir}}
+	files, err := l.Load("foo/b.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fds []*descriptorpb.FileDescriptorProto
+	for _, f := range files {
+		fd, err := desc.ToDescriptor(f.Proto, desc.Options{Imports: fds})
+		if err != nil {
+			t.Fatalf("could not convert %s: %v", f.Name, err)
+		}
+		if fd.GetName() != f.Name {
+			t.Errorf("expected descriptor named %s, got %s", f.Name, fd.GetName())
+		}
+		fds = append(fds, fd)
+	}
+	if got := fds[1].MessageType[0].Field[0].GetTypeName(); got != ".foo.A" {
+		t.Errorf("expected field of type .foo.A, got %s", got)
+	}
+}
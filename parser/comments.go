@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+
+	"github.com/campoy/groto/scanner"
+	"github.com/campoy/groto/token"
+)
+
+// splitComments classifies the comments found between the tokens prev and
+// next, in the same way protoc does when building SourceCodeInfo:
+//
+//   - the trailing comment of the declaration ending with prev,
+//   - the detached comments, separated by blank lines from both declarations,
+//   - the leading comment of the declaration starting with next.
+//
+// If prev is nil, next is the first token in the file.
+func splitComments(prev *scanner.Token, comments []scanner.Token, next scanner.Token) (trailing string, detached []string, leading string) {
+	c := &commentCollector{canAttach: prev != nil}
+
+	// line where the previous token ended, and first line not consumed yet.
+	prevLine, line := 1, 1
+	trailingEnd := -1
+	if prev != nil {
+		prevLine = prev.End.Line
+		line = prevLine + 1
+		if len(comments) > 0 && comments[0].Pos.Line == prevLine {
+			// A comment on the same line must be attached to the previous declaration.
+			tok := comments[0]
+			comments = comments[1:]
+			c.add(tok, lineAfter(comments, next))
+			trailingEnd = tok.End.Line
+			if isBlockComment(tok) && lineAfter(comments, next) == tok.End.Line {
+				// The next token is on the same line, we can't tell where
+				// the comment belongs, so it is dropped.
+				return "", nil, ""
+			}
+			c.flush()
+			line = tok.End.Line + 1
+		} else if next.Pos.Line == prevLine {
+			return "", nil, ""
+		}
+	}
+
+	for i, tok := range comments {
+		if tok.Pos.Line > line {
+			// Blank lines separate comments, and detach them from prev.
+			c.flush()
+			c.canAttach = false
+		}
+		after := lineAfter(comments[i+1:], next)
+		c.add(tok, after)
+		if line = tok.End.Line + 1; after == tok.End.Line {
+			line = tok.End.Line
+		}
+	}
+
+	if next.Pos.Line > line {
+		c.flush()
+		c.canAttach = false
+	}
+	switch next.Kind {
+	case token.EOF, token.CloseBrace, token.CloseBracket, token.CloseParen:
+		// At the end of a scope, there's nothing to attach a comment to.
+		c.flush()
+	}
+	if next.Pos.Line == prevLine || next.Pos.Line == trailingEnd {
+		// The comments could belong to either declaration, so we detach them.
+		c.maybeDetach()
+	}
+	if c.hasComment {
+		leading = c.buf
+	}
+	return c.trailing, c.detached, leading
+}
+
+// lineAfter returns the line where the first of the given comments starts,
+// or the line of the next token if there are no comments.
+func lineAfter(comments []scanner.Token, next scanner.Token) int {
+	if len(comments) > 0 {
+		return comments[0].Pos.Line
+	}
+	return next.Pos.Line
+}
+
+// A commentCollector groups consecutive comments, deciding whether they
+// trail the previous declaration or are detached from it.
+type commentCollector struct {
+	trailing string
+	detached []string
+
+	buf         string
+	hasComment  bool
+	isLine      bool
+	canAttach   bool
+	hasTrailing bool
+	count       int
+}
+
+// add appends the text of the given comment to the current group, unless
+// it can't be grouped with the previous comments. Only consecutive line
+// comments are grouped. nextLine is the line where whatever follows the
+// comment starts.
+func (c *commentCollector) add(tok scanner.Token, nextLine int) {
+	line := !isBlockComment(tok)
+	if c.hasComment && !(line && c.isLine) {
+		c.flush()
+	}
+	c.hasComment, c.isLine = true, line
+	if line {
+		c.buf += tok.Text[len("//"):]
+		if nextLine > tok.Pos.Line {
+			c.buf += "\n"
+		}
+	} else {
+		c.buf += blockCommentText(tok.Text)
+	}
+}
+
+// flush ends the current group of comments.
+func (c *commentCollector) flush() {
+	if !c.hasComment {
+		return
+	}
+	if c.canAttach {
+		c.trailing += c.buf
+		c.hasTrailing = true
+		c.canAttach = false
+	} else {
+		c.detached = append(c.detached, c.buf)
+	}
+	c.buf, c.hasComment = "", false
+	c.count++
+}
+
+// maybeDetach detaches the comments found if there's only one of them.
+func (c *commentCollector) maybeDetach() {
+	count := c.count
+	if c.hasComment {
+		count++
+	}
+	if count != 1 {
+		return
+	}
+	if c.hasTrailing {
+		c.detached = append([]string{c.trailing}, c.detached...)
+		c.trailing = ""
+	}
+	c.canAttach = false
+	c.flush()
+}
+
+func isBlockComment(tok scanner.Token) bool { return strings.HasPrefix(tok.Text, "/*") }
+
+// blockCommentText returns the text of a block comment without the comment
+// markers and without the whitespace and asterisk at the beginning of each line.
+func blockCommentText(text string) string {
+	var buf strings.Builder
+	i, from := len("/*"), len("/*")
+	for i < len(text) {
+		switch text[i] {
+		case '\n':
+			i++
+			buf.WriteString(text[from:i])
+			for i < len(text) && strings.IndexByte(" \t\r\v\f", text[i]) >= 0 {
+				i++
+			}
+			if strings.HasPrefix(text[i:], "*/") {
+				return buf.String()
+			}
+			if strings.HasPrefix(text[i:], "*") {
+				i++
+			}
+			from = i
+		case '*':
+			if strings.HasPrefix(text[i:], "*/") {
+				buf.WriteString(text[from:i])
+				return buf.String()
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	buf.WriteString(text[from:])
+	return buf.String()
+}
@@ -0,0 +1,140 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+
+	"github.com/campoy/groto/internal/errlist"
+	"github.com/campoy/groto/scanner"
+	"github.com/campoy/groto/token"
+)
+
+// A Category classifies the errors found while parsing.
+type Category int
+
+const (
+	// UnexpectedToken errors are reported when the token found is not one of
+	// the expected ones.
+	UnexpectedToken Category = iota
+	// IllegalToken errors are reported when the scanner can't make sense
+	// of the input.
+	IllegalToken
+	// BadNumber errors are reported for numeric literals that are out of
+	// range or not valid in their context.
+	BadNumber
+	// BadString errors are reported for string literals that can't be decoded.
+	BadString
+	// BadSyntax errors are reported for unsupported syntax statements.
+	BadSyntax
+	// Duplicate errors are reported for definitions that can appear only once.
+	Duplicate
+	// NotAllowed errors are reported for constructs that are not allowed in
+	// the syntax of the file, or in the position where they were found.
+	NotAllowed
+)
+
+func (c Category) String() string {
+	switch c {
+	case UnexpectedToken:
+		return "unexpected token"
+	case IllegalToken:
+		return "illegal token"
+	case BadNumber:
+		return "bad number"
+	case BadString:
+		return "bad string"
+	case BadSyntax:
+		return "bad syntax"
+	case Duplicate:
+		return "duplicate"
+	case NotAllowed:
+		return "not allowed"
+	default:
+		return fmt.Sprintf("unknown category %d", c)
+	}
+}
+
+// An Error describes a problem found while parsing a .proto file.
+type Error struct {
+	Pos      token.Position // position where the error was found.
+	Category Category
+	Found    scanner.Token // token that caused the error.
+	Expected []token.Kind  // kinds of tokens that would have been accepted, if known.
+	Msg      string        // human readable description of the error.
+}
+
+// Error returns the message of the error, prefixed by its position if known.
+func (e *Error) Error() string { return e.plain().Error() }
+
+// plain returns the error without the details only known to the parser,
+// which is formatted as the errors of the other packages.
+func (e *Error) plain() *errlist.Error { return &errlist.Error{Pos: e.Pos, Msg: e.Msg} }
+
+// An ErrorList is a list of errors, in the order they were found.
+type ErrorList []*Error
+
+// Error returns the first error in the list, and how many more there are.
+func (l ErrorList) Error() string {
+	var plain errlist.List
+	for _, e := range l {
+		plain = append(plain, e.plain())
+	}
+	return plain.Error()
+}
+
+// add appends the given error to the list, unless an error at the same
+// position was already found, as it's likely caused by the same problem.
+func (l *ErrorList) add(e *Error) {
+	for _, prev := range *l {
+		if prev.Pos == e.Pos {
+			return
+		}
+	}
+	*l = append(*l, e)
+}
+
+// Err returns an error equivalent to the list, or nil if the list is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+// errorf returns an error of the given category located at the given token.
+func errorf(tok scanner.Token, cat Category, format string, args ...interface{}) *Error {
+	return &Error{
+		Pos:      tok.Pos,
+		Category: cat,
+		Found:    tok,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// unexpected returns an error reporting that the given token is not one of
+// the expected kinds. Illegal tokens are reported as such.
+func unexpected(tok scanner.Token, expected []token.Kind, format string, args ...interface{}) *Error {
+	cat := UnexpectedToken
+	if tok.Is(token.Illegal) {
+		cat = IllegalToken
+	}
+	return &Error{
+		Pos:      tok.Pos,
+		Category: cat,
+		Found:    tok,
+		Expected: expected,
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
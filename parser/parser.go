@@ -13,78 +13,208 @@
 
 // Package parser provides the function Parse, which given an io.Reader parses
 // its content and generates a Proto which contains all the definitions found
-// in a Protocol Buffer Version 3 file descriptor (aka .proto file).
+// in a Protocol Buffer Version 2 or 3, or editions, file descriptor (aka .proto file).
 //
 // You can read more about the language here:
 // https://developers.google.com/protocol-buffers/docs/proto3#oneof
+// https://developers.google.com/protocol-buffers/docs/proto
+// https://protobuf.dev/editions/overview
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	. "github.com/campoy/groto/proto"
 	"github.com/campoy/groto/scanner"
 	"github.com/campoy/groto/token"
 )
 
+// A Mode is a set of flags controlling the behavior of the parser.
+type Mode uint
+
+const (
+	// Recover makes the parser continue after finding an error, skipping the
+	// rest of the statement where it was found, so all the errors in a file
+	// are reported at once. The returned File contains all the definitions
+	// that could be parsed.
+	Recover Mode = 1 << iota
+)
+
 // Parse reads from the given io.Reader and returns the parsed information in
 // a Proto value, or an error if the contents where not parseable.
+// Errors are returned as an ErrorList, whose elements describe where
+// and why the parsing failed.
 func Parse(r io.Reader) (*File, error) {
-	return parseProto(&peeker{s: scanner.New(r)})
+	return ParseFile("", r, 0)
 }
 
-// proto = syntax { import | package | option |  message | enum | service | emptyStatement }
-func parseProto(p *peeker) (file *File, err error) {
-	defer func() {
-		if rec := recover(); rec != nil {
-			err = fmt.Errorf("%v", rec)
-		}
-	}()
+// ParseFile is like Parse, but the positions of the parsed nodes refer to
+// the file with the given name, and the behavior of the parser can be
+// changed with the given mode.
+func ParseFile(filename string, r io.Reader, mode Mode) (*File, error) {
+	return parseProto(&peeker{s: scanner.NewFile(filename, r), mode: mode})
+}
 
-	file = &File{Syntax: parseSyntax(p)}
-	for {
-		switch next := p.peek(); next.Kind {
-		case token.Package:
-			if len(file.Package.Identifier) > 0 {
-				panicf("found second package definition")
+// proto = [ syntax | edition ] { import | package | option |  message | enum | service | extend | emptyStatement }
+func parseProto(p *peeker) (*File, error) {
+	start := p.pos()
+	_, p.detached, p.leading = splitComments(nil, p.comments, p.peek())
+	file := &File{Syntax: Syntax{Value: Proto2}}
+	var err *Error
+	switch p.peek().Kind {
+	case token.Syntax:
+		err = p.try(func() *Error {
+			syntax, err := parseSyntax(p)
+			if err == nil {
+				file.Syntax = syntax
 			}
-			file.Package = parsePackage(p)
-		case token.Import:
-			file.Imports = append(file.Imports, parseImport(p))
-		case token.Option:
-			file.Options = append(file.Options, parseOption(p))
-		case token.Message:
-			file.Messages = append(file.Messages, parseMessage(p))
-		case token.Enum:
-			file.Enums = append(file.Enums, parseEnum(p))
-		case token.Service:
-			file.Services = append(file.Services, parseService(p))
-		case token.EOF:
-			return file, nil
-		default:
-			panicf("unexpected %s at top level definition", next)
+			return err
+		})
+	case token.Edition:
+		file.Syntax.Value = Editions
+		err = p.try(func() *Error {
+			edition, err := parseEdition(p)
+			if err == nil {
+				file.Edition = edition
+			}
+			return err
+		})
+	}
+	p.syntax = file.Syntax.Value
+	for err == nil {
+		next := p.peek()
+		if next.Is(token.EOF) {
+			file.Span = p.span(start)
+			return file, p.errs.Err()
+		}
+		err = p.try(func() *Error { return parseTopLevel(p, file, next) })
+	}
+	p.errs.add(err)
+	return file, p.errs
+}
+
+// parseTopLevel parses a top level definition starting with the given token,
+// and adds it to the file.
+func parseTopLevel(p *peeker, file *File, next scanner.Token) *Error {
+	switch next.Kind {
+	case token.Package:
+		if len(file.Package.Identifier) > 0 {
+			return errorf(next, Duplicate, "found second package definition")
+		}
+		pkg, err := parsePackage(p)
+		if err != nil {
+			return err
+		}
+		file.Package = pkg
+	case token.Import:
+		imp, err := parseImport(p)
+		if err != nil {
+			return err
+		}
+		file.Imports = append(file.Imports, imp)
+	case token.Option:
+		opt, err := parseOption(p)
+		if err != nil {
+			return err
 		}
+		file.Options = append(file.Options, opt)
+	case token.Message:
+		msg, err := parseMessage(p)
+		if err != nil {
+			return err
+		}
+		file.Messages = append(file.Messages, msg)
+	case token.Enum:
+		enum, err := parseEnum(p)
+		if err != nil {
+			return err
+		}
+		file.Enums = append(file.Enums, enum)
+	case token.Service:
+		svc, err := parseService(p)
+		if err != nil {
+			return err
+		}
+		file.Services = append(file.Services, svc)
+	case token.Extend:
+		ext, err := parseExtend(p)
+		if err != nil {
+			return err
+		}
+		file.Extends = append(file.Extends, ext)
+	default:
+		return unexpected(next, topLevelKinds, "unexpected %s at top level definition", next)
+	}
+	return nil
+}
+
+// syntax = "syntax" "=" quote ( "proto2" | "proto3" ) quote ";"
+func parseSyntax(p *peeker) (Syntax, *Error) {
+	start := p.pos()
+	value, tok, err := parseAssignment(p, token.Syntax)
+	if err != nil {
+		return Syntax{}, err
+	}
+	if value != Proto2 && value != Proto3 {
+		return Syntax{}, errorf(tok, BadSyntax, "expected literal string proto2 or proto3, got %s instead", value)
 	}
+	syntax := Syntax{Value: value}
+	if err := p.endDecl(token.Semicolon, &syntax.Comments); err != nil {
+		return Syntax{}, err
+	}
+	syntax.Span = p.span(start)
+	return syntax, nil
 }
 
-// syntax = "syntax" "=" quote "proto3" quote ";"
-func parseSyntax(p *peeker) Syntax {
-	p.consume(token.Syntax)
-	p.consume(token.Equals)
-	value := unquote(p.consume(token.StringLiteral))
-	if value != "proto3" {
-		panicf("expected literal string proto3, got %s instead", value)
+// edition = "edition" "=" quote "2023" quote ";"
+func parseEdition(p *peeker) (Edition, *Error) {
+	start := p.pos()
+	value, tok, err := parseAssignment(p, token.Edition)
+	if err != nil {
+		return Edition{}, err
+	}
+	if value != Edition2023 {
+		return Edition{}, errorf(tok, BadSyntax, "unsupported edition %s, expected %s", value, Edition2023)
+	}
+	edition := Edition{Value: value}
+	if err := p.endDecl(token.Semicolon, &edition.Comments); err != nil {
+		return Edition{}, err
+	}
+	edition.Span = p.span(start)
+	return edition, nil
+}
+
+// parseAssignment parses the start of a syntax or edition statement, which
+// begins with the given keyword, and returns the value of its string literal
+// and the literal itself.
+func parseAssignment(p *peeker, keyword token.Kind) (string, scanner.Token, *Error) {
+	if _, err := p.consume(keyword); err != nil {
+		return "", scanner.Token{}, err
+	}
+	if _, err := p.consume(token.Equals); err != nil {
+		return "", scanner.Token{}, err
+	}
+	tok, err := p.consume(token.StringLiteral)
+	if err != nil {
+		return "", tok, err
 	}
-	p.consume(token.Semicolon)
-	return Syntax{Value: value}
+	value, err := unquote(tok)
+	return value, tok, err
 }
 
 // import = "import" [ "weak" | "public" ] strLit ";"
-func parseImport(p *peeker) Import {
-	p.consume(token.Import)
+func parseImport(p *peeker) (Import, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Import); err != nil {
+		return Import{}, err
+	}
 	var mod ImportModifier
 	if tok, ok := p.maybeConsume(token.Weak, token.Public); ok {
 		if tok.Is(token.Weak) {
@@ -93,371 +223,1085 @@ func parseImport(p *peeker) Import {
 			mod = PublicImport
 		}
 	}
-	path := unquote(p.consume(token.StringLiteral))
-	p.consume(token.Semicolon)
-	return Import{Modifier: mod, Path: path}
+	tok, err := p.consume(token.StringLiteral)
+	if err != nil {
+		return Import{}, err
+	}
+	imp := Import{Modifier: mod}
+	if imp.Path, err = unquote(tok); err != nil {
+		return Import{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &imp.Comments); err != nil {
+		return Import{}, err
+	}
+	imp.Span = p.span(start)
+	return imp, nil
 }
 
 // package = "package" fullIdent ";"
-func parsePackage(p *peeker) Package {
-	p.consume(token.Package)
-	ident := parseFullIdentifier(p)
-	p.consume(token.Semicolon)
-	return Package{Identifier: ident}
+func parsePackage(p *peeker) (Package, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Package); err != nil {
+		return Package{}, err
+	}
+	var pkg Package
+	var err *Error
+	if pkg.Identifier, err = parseFullIdentifier(p); err != nil {
+		return Package{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &pkg.Comments); err != nil {
+		return Package{}, err
+	}
+	pkg.Span = p.span(start)
+	return pkg, nil
 }
 
 // option = "option" optionName  "=" constant ";"
 // optionName = ( ident | "(" fullIdent ")" ) { "." ident }
-func parseOption(p *peeker) Option {
-	p.consume(token.Option)
-	opt := parseFieldOption(p)
-	p.consume(token.Semicolon)
-	return opt
+func parseOption(p *peeker) (Option, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Option); err != nil {
+		return Option{}, err
+	}
+	opt, err := parseFieldOption(p)
+	if err != nil {
+		return Option{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &opt.Comments); err != nil {
+		return Option{}, err
+	}
+	opt.Span = p.span(start)
+	return opt, nil
 }
 
-// fieldOption = optionName "=" constant
-func parseFieldOption(p *peeker) Option {
-	var opt Option
+// fieldOption = optionName "=" ( constant | aggregate )
+func parseFieldOption(p *peeker) (Option, *Error) {
+	opt := Option{Span: Span{Pos: p.pos()}}
+	var err *Error
 	if _, ok := p.maybeConsume(token.OpenParen); ok {
-		opt.Prefix = parseFullIdentifier(p)
-		p.consume(token.CloseParen)
+		if opt.Prefix, err = parseFullIdentifier(p); err != nil {
+			return Option{}, err
+		}
+		if _, err := p.consume(token.CloseParen); err != nil {
+			return Option{}, err
+		}
+		// Fields of a custom option of a message type follow a dot.
+		if _, ok := p.maybeConsume(token.Dot); ok {
+			if opt.Name, err = parseFullIdentifier(p); err != nil {
+				return Option{}, err
+			}
+		}
+	} else if p.peek().Is(token.Identifier) {
+		if opt.Name, err = parseFullIdentifier(p); err != nil {
+			return Option{}, err
+		}
 	}
 
-	if p.peek().Is(token.Identifier) {
-		opt.Name = parseFullIdentifier(p)
+	if opt.Prefix == nil && opt.Name == nil {
+		return Option{}, unexpected(p.peek(), []token.Kind{token.OpenParen, token.Identifier}, "missing name in option")
 	}
 
-	if opt.Prefix == nil && opt.Name == nil {
-		panicf("missing name in option")
+	if _, err := p.consume(token.Equals); err != nil {
+		return Option{}, err
+	}
+	if p.peek().Is(token.OpenBrace) {
+		opt.Value, err = parseAggregate(p)
+	} else {
+		opt.Value, err = parseValue(p, false)
+	}
+	if err != nil {
+		return Option{}, err
+	}
+	opt.End = p.last.End
+	return opt, nil
+}
+
+// aggregate = ( "{" { aggregateField [ "," | ";" ] } "}" ) | ( "<" { aggregateField [ "," | ";" ] } ">" )
+func parseAggregate(p *peeker) (Aggregate, *Error) {
+	start := p.pos()
+	open, err := p.consume(token.OpenBrace, token.OpenAngled)
+	if err != nil {
+		return Aggregate{}, err
+	}
+	end := token.CloseBrace
+	if open.Is(token.OpenAngled) {
+		end = token.CloseAngled
 	}
 
-	p.consume(token.Equals)
-	opt.Value = parseValue(p, false)
-	return opt
+	var agg Aggregate
+	for {
+		if _, ok := p.maybeConsume(end); ok {
+			break
+		}
+		f, err := parseAggregateField(p)
+		if err != nil {
+			return Aggregate{}, err
+		}
+		agg.Fields = append(agg.Fields, f)
+		p.maybeConsume(token.Comma, token.Semicolon)
+	}
+	agg.Span = p.span(start)
+	return agg, nil
+}
+
+// aggregateField = fieldName ( ( ":" aggregateValue ) | ( [ ":" ] ( aggregate | list ) ) )
+// fieldName = ident | "[" [ fullIdent "/" ] fullIdent "]"
+func parseAggregateField(p *peeker) (AggregateField, *Error) {
+	start := p.pos()
+	var f AggregateField
+	var err *Error
+	if _, ok := p.maybeConsume(token.OpenBracket); ok {
+		f.Extension = true
+		if f.Name, err = parseFullIdentifier(p); err != nil {
+			return AggregateField{}, err
+		}
+		if _, ok := p.maybeConsume(token.Slash); ok {
+			f.TypeURL = joinIdentifiers(f.Name)
+			if f.Name, err = parseFullIdentifier(p); err != nil {
+				return AggregateField{}, err
+			}
+		}
+		if _, err := p.consume(token.CloseBracket); err != nil {
+			return AggregateField{}, err
+		}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return AggregateField{}, err
+		}
+		f.Name = []Identifier{name}
+	}
+
+	if _, ok := p.maybeConsume(token.Colon); ok {
+		f.Value, err = parseAggregateValue(p)
+	} else {
+		// Without a colon, the value must be a message or a list of messages.
+		switch next := p.peek(); next.Kind {
+		case token.OpenBrace, token.OpenAngled:
+			f.Value, err = parseAggregate(p)
+		case token.OpenBracket:
+			f.Value, err = parseList(p, true)
+		default:
+			err = unexpected(next, []token.Kind{token.Colon, token.OpenBrace, token.OpenAngled},
+				"expected ':' or a message after field name %s, got %s", joinIdentifiers(f.Name), next)
+		}
+	}
+	if err != nil {
+		return AggregateField{}, err
+	}
+	f.Span = p.span(start)
+	return f, nil
+}
+
+// aggregateValue = constant | aggregate | list
+func parseAggregateValue(p *peeker) (interface{}, *Error) {
+	switch p.peek().Kind {
+	case token.OpenBrace, token.OpenAngled:
+		return parseAggregate(p)
+	case token.OpenBracket:
+		return parseList(p, false)
+	default:
+		return parseValue(p, false)
+	}
+}
+
+// list = "[" [ aggregateValue { "," aggregateValue } ] "]"
+//
+// Lists can't be nested, and if messages is true all the values must be messages.
+func parseList(p *peeker, messages bool) (List, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.OpenBracket); err != nil {
+		return List{}, err
+	}
+	var l List
+	if _, ok := p.maybeConsume(token.CloseBracket); !ok {
+		for {
+			switch next := p.peek(); {
+			case next.Is(token.OpenBracket):
+				return List{}, errorf(next, NotAllowed, "lists can't be nested")
+			case messages && !next.Is(token.OpenBrace) && !next.Is(token.OpenAngled):
+				return List{}, unexpected(next, []token.Kind{token.OpenBrace, token.OpenAngled},
+					"expected a message in list without ':', got %s", next)
+			}
+			v, err := parseAggregateValue(p)
+			if err != nil {
+				return List{}, err
+			}
+			l.Values = append(l.Values, v)
+			if _, ok := p.maybeConsume(token.Comma); !ok {
+				break
+			}
+		}
+		if _, err := p.consume(token.CloseBracket); err != nil {
+			return List{}, err
+		}
+	}
+	l.Span = p.span(start)
+	return l, nil
+}
+
+func joinIdentifiers(ids []Identifier) string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, string(id))
+	}
+	return strings.Join(s, ".")
 }
 
 // fieldOptions = [ "[" fieldOption { ","  fieldOption } "]" ]
-func parseFieldOptions(p *peeker) []Option {
+func parseFieldOptions(p *peeker) ([]Option, *Error) {
 	if _, ok := p.maybeConsume(token.OpenBracket); !ok {
-		return nil
+		return nil, nil
 	}
 
 	var opts []Option
 	for {
-		opts = append(opts, parseFieldOption(p))
+		opt, err := parseFieldOption(p)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
 		if _, ok := p.maybeConsume(token.CloseBracket); ok {
-			return opts
+			return opts, nil
+		}
+		if _, err := p.consume(token.Comma); err != nil {
+			return nil, err
 		}
-		p.consume(token.Comma)
 	}
 }
 
 // message = "message" messageName messageBody
-// messageBody = "{" { field | enum | message | option | oneof | mapField | reserved | emptyStatement } "}"
-func parseMessage(p *peeker) Message {
-	p.consume(token.Message)
-	msg := Message{Name: identifier(p.consume(token.Identifier))}
-	p.consume(token.OpenBrace)
+func parseMessage(p *peeker) (Message, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Message); err != nil {
+		return Message{}, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Name: name}
+	if err := parseMessageBody(p, "message", &msg); err != nil {
+		return Message{}, err
+	}
+	msg.Span = p.span(start)
+	return msg, nil
+}
 
-	for {
-		switch kind := p.peek().Kind; {
-		case kind.IsType() || kind == token.Identifier || kind == token.Repeated:
-			msg.Fields = append(msg.Fields, parseField(p))
+// messageBody = "{" { field | enum | message | option | oneof | mapField | reserved | extensions | extend | group | emptyStatement } "}"
+func parseMessageBody(p *peeker, name string, msg *Message) *Error {
+	return p.block(name, &msg.Comments, func(next scanner.Token) *Error {
+		switch kind := next.Kind; {
+		case kind.IsType() || kind == token.Identifier || kind == token.Dot || kind == token.Repeated ||
+			kind == token.Optional || kind == token.Required || kind == token.Group:
+			f, err := parseField(p)
+			if err != nil {
+				return err
+			}
+			msg.Fields = append(msg.Fields, f)
 		case kind == token.Enum:
-			msg.Enums = append(msg.Enums, parseEnum(p))
+			enum, err := parseEnum(p)
+			if err != nil {
+				return err
+			}
+			msg.Enums = append(msg.Enums, enum)
 		case kind == token.Message:
-			msg.Messages = append(msg.Messages, parseMessage(p))
+			m, err := parseMessage(p)
+			if err != nil {
+				return err
+			}
+			msg.Messages = append(msg.Messages, m)
 		case kind == token.Option:
-			msg.Options = append(msg.Options, parseOption(p))
+			opt, err := parseOption(p)
+			if err != nil {
+				return err
+			}
+			msg.Options = append(msg.Options, opt)
 		case kind == token.Oneof:
-			msg.OneOfs = append(msg.OneOfs, parseOneOf(p))
+			o, err := parseOneOf(p)
+			if err != nil {
+				return err
+			}
+			msg.OneOfs = append(msg.OneOfs, o)
 		case kind == token.Map:
-			msg.Maps = append(msg.Maps, parseMap(p))
+			m, err := parseMap(p)
+			if err != nil {
+				return err
+			}
+			msg.Maps = append(msg.Maps, m)
 		case kind == token.Reserved:
-			msg.Reserveds = append(msg.Reserveds, parseReserved(p))
+			res, err := parseReserved(p, false, MaxFieldNumber)
+			if err != nil {
+				return err
+			}
+			msg.Reserveds = append(msg.Reserveds, res)
+		case kind == token.Extensions:
+			ext, err := parseExtensions(p)
+			if err != nil {
+				return err
+			}
+			msg.Extensions = append(msg.Extensions, ext)
+		case kind == token.Extend:
+			ext, err := parseExtend(p)
+			if err != nil {
+				return err
+			}
+			msg.Extends = append(msg.Extends, ext)
 		case kind == token.Semicolon:
-			p.scan()
-		case kind == token.CloseBrace:
-			p.scan()
-			return msg
+			return p.endDecl(token.Semicolon, nil)
 		default:
-			panicf("expected '}' to end message definition, got %s", p.scan())
+			return unexpected(next, []token.Kind{token.CloseBrace}, "expected '}' to end %s definition, got %s", name, next)
 		}
+		return nil
+	})
+}
+
+// field = label type fieldName "=" fieldNumber [ "[" fieldOptions "]" ] ";"
+// label = [ "required" | "optional" | "repeated" ]
+func parseField(p *peeker) (Field, *Error) {
+	start := p.pos()
+	label, err := parseLabel(p)
+	if err != nil {
+		return Field{}, err
+	}
+	if p.peek().Is(token.Group) {
+		return parseGroup(p, start, label)
+	}
+	noMaps := "labels are not allowed on map fields"
+	if label == NoLabel {
+		// Fields without labels are parsed here only in extend blocks.
+		noMaps = "map fields are not allowed in extend blocks"
 	}
+	f, err := parseOneOfField(p, noMaps)
+	if err != nil {
+		return Field{}, err
+	}
+	return Field{
+		Span:     p.span(start),
+		Comments: f.Comments,
+		Label:    label,
+		Type:     f.Type,
+		Name:     f.Name,
+		Number:   f.Number,
+		Options:  f.Options,
+	}, nil
 }
 
-// field = [ "repeated" ] type fieldName "=" fieldNumber [ "[" fieldOptions "]" ] ";"
-func parseField(p *peeker) Field {
-	_, repeated := p.maybeConsume(token.Repeated)
-	f := parseOneOfField(p)
-	return Field{Repeated: repeated, Type: f.Type, Name: f.Name, Number: f.Number, Options: f.Options}
+// In proto2 all fields outside of oneofs must have a label, while in proto3
+// it is optional and required is not allowed. Editions only allow repeated.
+func parseLabel(p *peeker) (Label, *Error) {
+	tok, ok := p.maybeConsume(token.Optional, token.Required, token.Repeated)
+	if !ok {
+		if p.syntax == Proto2 {
+			return NoLabel, unexpected(tok, labelKinds, "expected 'required', 'optional', or 'repeated', got %s", tok)
+		}
+		return NoLabel, nil
+	}
+
+	switch tok.Kind {
+	case token.Optional:
+		if p.syntax == Editions {
+			return NoLabel, errorf(tok, NotAllowed, "optional fields are not allowed in %s", p.syntax)
+		}
+		return OptionalLabel, nil
+	case token.Required:
+		if p.syntax == Proto3 || p.syntax == Editions {
+			return NoLabel, errorf(tok, NotAllowed, "required fields are not allowed in %s", p.syntax)
+		}
+		return RequiredLabel, nil
+	default:
+		return RepeatedLabel, nil
+	}
 }
 
-// enum = "enum" enumName "{" { option | enumField | emptyStatement } "}"
-func parseEnum(p *peeker) Enum {
-	p.consume(token.Enum)
-	enum := Enum{Name: identifier(p.consume(token.Identifier))}
-	p.consume(token.OpenBrace)
+// group = label "group" groupName "=" fieldNumber [ "[" fieldOptions "]" ] messageBody
+func parseGroup(p *peeker, start token.Position, label Label) (Field, *Error) {
+	tok, err := p.consume(token.Group)
+	if err != nil {
+		return Field{}, err
+	}
+	if p.syntax == Proto3 || p.syntax == Editions {
+		return Field{}, errorf(tok, NotAllowed, "groups are not allowed in %s", p.syntax)
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return Field{}, err
+	}
+	if c := name[0]; c < 'A' || c > 'Z' {
+		return Field{}, errorf(p.last, NotAllowed, "group names must start with a capital letter")
+	}
+	typ := Type{Span: Span{Pos: p.last.Pos, End: p.last.End}, UserDefined: []Identifier{name}}
+	if _, err := p.consume(token.Equals); err != nil {
+		return Field{}, err
+	}
+	f := Field{
+		Label: label,
+		Type:  typ,
+		Name:  Identifier(strings.ToLower(string(name))),
+		Group: &Message{Name: name},
+	}
+	if f.Number, err = parseInt32(p, false); err != nil {
+		return Field{}, err
+	}
+	if f.Options, err = parseFieldOptions(p); err != nil {
+		return Field{}, err
+	}
+	if err := parseMessageBody(p, "group", f.Group); err != nil {
+		return Field{}, err
+	}
+	f.Span = p.span(start)
+	f.Group.Span = f.Span
+	return f, nil
+}
 
-	for {
-		switch kind := p.peek().Kind; {
-		case kind.IsType() || kind == token.Identifier || kind == token.Repeated:
-			enum.Fields = append(enum.Fields, parseEnumField(p))
+// enum = "enum" enumName "{" { option | enumField | reserved | emptyStatement } "}"
+func parseEnum(p *peeker) (Enum, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Enum); err != nil {
+		return Enum{}, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return Enum{}, err
+	}
+	enum := Enum{Name: name}
+
+	err = p.block("enum", &enum.Comments, func(next scanner.Token) *Error {
+		switch kind := next.Kind; {
 		case kind == token.Option:
-			enum.Options = append(enum.Options, parseOption(p))
-		case kind == token.CloseBrace:
-			p.scan()
-			return enum
+			opt, err := parseOption(p)
+			if err != nil {
+				return err
+			}
+			enum.Options = append(enum.Options, opt)
+		case kind == token.Reserved:
+			res, err := parseReserved(p, true, MaxEnumNumber)
+			if err != nil {
+				return err
+			}
+			enum.Reserveds = append(enum.Reserveds, res)
+		case kind == token.Semicolon:
+			return p.endDecl(token.Semicolon, nil)
+		case kind == token.Identifier || kind.IsKeyword() || kind.IsType():
+			f, err := parseEnumField(p)
+			if err != nil {
+				return err
+			}
+			enum.Fields = append(enum.Fields, f)
 		default:
-			panicf("expected '}' to end message definition, got %s", p.scan())
+			return unexpected(next, []token.Kind{token.CloseBrace}, "expected '}' to end enum definition, got %s", next)
 		}
+		return nil
+	})
+	if err != nil {
+		return Enum{}, err
 	}
+	enum.Span = p.span(start)
+	if err := checkAliases(p, enum); err != nil {
+		return Enum{}, err
+	}
+	return enum, nil
 }
 
-// enumField = ident "=" intLit fieldOptions ";"
-func parseEnumField(p *peeker) EnumField {
-	name := identifier(p.consume(token.Identifier))
-	p.consume(token.Equals)
-	number := atoi(p.consume(token.DecimalLiteral))
-	opts := parseFieldOptions(p)
-	p.consume(token.Semicolon)
+// checkAliases reports enum fields sharing a number, unless the enum allows
+// aliases.
+func checkAliases(p *peeker, enum Enum) *Error {
+	if enum.AllowAlias() {
+		return nil
+	}
+	seen := map[int]EnumField{}
+	for _, f := range enum.Fields {
+		if prev, ok := seen[f.Number]; ok {
+			err := p.report(f.Pos, Duplicate, "%s uses the same number %d as %s, set option allow_alias = true to allow aliases",
+				f.Name, f.Number, prev.Name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		seen[f.Number] = f
+	}
+	return nil
+}
 
-	return EnumField{Name: name, Number: number, Options: opts}
+// enumField = ident "=" [ "-" ] intLit [ "[" enumValueOption { ","  enumValueOption } "]" ] ";"
+func parseEnumField(p *peeker) (EnumField, *Error) {
+	start := p.pos()
+	name, err := p.name()
+	if err != nil {
+		return EnumField{}, err
+	}
+	if _, err := p.consume(token.Equals); err != nil {
+		return EnumField{}, err
+	}
+	f := EnumField{Name: name}
+	if f.Number, err = parseInt32(p, true); err != nil {
+		return EnumField{}, err
+	}
+	if f.Options, err = parseFieldOptions(p); err != nil {
+		return EnumField{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &f.Comments); err != nil {
+		return EnumField{}, err
+	}
+	f.Span = p.span(start)
+	return f, nil
 }
 
-// oneof = "oneof" oneofName "{" { oneofField | emptyStatement } "}"
-func parseOneOf(p *peeker) OneOf {
-	p.consume(token.Oneof)
-	o := OneOf{Name: identifier(p.consume(token.Identifier))}
-	p.consume(token.OpenBrace)
+// oneof = "oneof" oneofName "{" { oneofField | group | emptyStatement } "}"
+func parseOneOf(p *peeker) (OneOf, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Oneof); err != nil {
+		return OneOf{}, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return OneOf{}, err
+	}
+	o := OneOf{Name: name}
 
-	for {
-		if _, ok := p.maybeConsume(token.CloseBrace); ok {
-			return o
+	err = p.block("oneof", &o.Comments, func(next scanner.Token) *Error {
+		if next.Is(token.Group) {
+			f, err := parseGroup(p, p.pos(), NoLabel)
+			if err != nil {
+				return err
+			}
+			o.Fields = append(o.Fields, OneOfField{
+				Span:    f.Span,
+				Type:    f.Type,
+				Name:    f.Name,
+				Number:  f.Number,
+				Options: f.Options,
+				Group:   f.Group,
+			})
+			return nil
 		}
-		o.Fields = append(o.Fields, parseOneOfField(p))
+		f, err := parseOneOfField(p, "map fields are not allowed in oneofs")
+		if err != nil {
+			return err
+		}
+		o.Fields = append(o.Fields, f)
+		return nil
+	})
+	if err != nil {
+		return OneOf{}, err
 	}
+	o.Span = p.span(start)
+	return o, nil
 }
 
 // oneofField = type fieldName "=" fieldNumber [ "[" fieldOptions "]" ] ";"
-func parseOneOfField(p *peeker) OneOfField {
-	typ := parseType(p)
-	name := identifier(p.consume(token.Identifier))
-	p.consume(token.Equals)
-	number := atoi(p.consume(token.DecimalLiteral))
-	opts := parseFieldOptions(p)
-	p.consume(token.Semicolon)
-
-	return OneOfField{Type: typ, Name: name, Number: number, Options: opts}
+//
+// It is also used for other fields, after their label. As map fields are not
+// allowed where it's used, they are reported with the given message.
+func parseOneOfField(p *peeker, noMaps string) (OneOfField, *Error) {
+	start := p.pos()
+	typ, err := parseType(p)
+	if err != nil {
+		return OneOfField{}, err
+	}
+	if isMap(p, typ) {
+		return OneOfField{}, errorf(p.last, NotAllowed, "%s", noMaps)
+	}
+	name, err := p.name()
+	if err != nil {
+		return OneOfField{}, err
+	}
+	if _, err := p.consume(token.Equals); err != nil {
+		return OneOfField{}, err
+	}
+	f := OneOfField{Type: typ, Name: name}
+	if f.Number, err = parseInt32(p, false); err != nil {
+		return OneOfField{}, err
+	}
+	if f.Options, err = parseFieldOptions(p); err != nil {
+		return OneOfField{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &f.Comments); err != nil {
+		return OneOfField{}, err
+	}
+	f.Span = p.span(start)
+	return f, nil
 }
 
 // mapField = "map" "<" keyType "," type ">" mapName "=" fieldNumber [ "[" fieldOptions "]" ] ";"
-func parseMap(p *peeker) Map {
-	p.consume(token.Map)
-	p.consume(token.OpenAngled)
-	key := p.scan()
+func parseMap(p *peeker) (Map, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Map); err != nil {
+		return Map{}, err
+	}
+	if _, err := p.consume(token.OpenAngled); err != nil {
+		return Map{}, err
+	}
+	key := p.peek()
 	if !key.IsKeyType() {
-		panicf("expected key type, got %s", key)
+		return Map{}, unexpected(key, keyTypeKinds, "expected key type, got %s", key)
+	}
+	p.scan()
+	m := Map{KeyType: Type{Span: Span{Pos: key.Pos, End: key.End}, Predefined: kindToType(key.Kind)}}
+	if _, err := p.consume(token.Comma); err != nil {
+		return Map{}, err
+	}
+	var err *Error
+	if m.ValueType, err = parseType(p); err != nil {
+		return Map{}, err
+	}
+	if isMap(p, m.ValueType) {
+		return Map{}, errorf(p.last, NotAllowed, "map values can't be maps")
+	}
+	if _, err := p.consume(token.CloseAngled); err != nil {
+		return Map{}, err
+	}
+	if m.Name, err = p.name(); err != nil {
+		return Map{}, err
+	}
+	if _, err := p.consume(token.Equals); err != nil {
+		return Map{}, err
 	}
-	keyType := Type{Predefined: kindToType(key.Kind)}
-	p.consume(token.Comma)
-	valueType := parseType(p)
-	p.consume(token.CloseAngled)
-	name := identifier(p.consume(token.Identifier))
-	p.consume(token.Equals)
-	number := atoi(p.consume(token.DecimalLiteral))
-	opts := parseFieldOptions(p)
-	p.consume(token.Semicolon)
+	if m.Number, err = parseInt32(p, false); err != nil {
+		return Map{}, err
+	}
+	if m.Options, err = parseFieldOptions(p); err != nil {
+		return Map{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &m.Comments); err != nil {
+		return Map{}, err
+	}
+	m.Span = p.span(start)
+	return m, nil
+}
 
-	return Map{KeyType: keyType, ValueType: valueType, Name: name, Number: number, Options: opts}
+// isMap returns true if the type just parsed is the start of a map type,
+// rather than a type named map.
+func isMap(p *peeker, typ Type) bool {
+	return !typ.FullyQualified && len(typ.UserDefined) == 1 && typ.UserDefined[0] == "map" && p.peek().Is(token.OpenAngled)
 }
 
 // type = "double" | "float" | "int32" | "int64" | "uint32" | "uint64"
-//       | "sint32" | "sint64" | "fixed32" | "fixed64" | "sfixed32" | "sfixed64"
-//       | "bool" | "string" | "bytes" | messageType | enumType
-func parseType(p *peeker) Type {
+//
+//	| "sint32" | "sint64" | "fixed32" | "fixed64" | "sfixed32" | "sfixed64"
+//	| "bool" | "string" | "bytes" | messageType | enumType
+func parseType(p *peeker) (Type, *Error) {
+	start := p.pos()
 	if p.peek().IsType() {
-		return Type{Predefined: kindToType(p.scan().Kind)}
+		return Type{Predefined: kindToType(p.scan().Kind), Span: p.span(start)}, nil
+	}
+	_, dot := p.maybeConsume(token.Dot)
+	name, err := parseFullIdentifier(p)
+	if err != nil {
+		return Type{}, err
+	}
+	return Type{UserDefined: name, FullyQualified: dot, Span: p.span(start)}, nil
+}
+
+// extend = "extend" messageType "{" { field | group | emptyStatement } "}"
+func parseExtend(p *peeker) (Extend, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Extend); err != nil {
+		return Extend{}, err
+	}
+	typ, err := parseType(p)
+	if err != nil {
+		return Extend{}, err
+	}
+	if typ.Predefined != TypeInvalid {
+		return Extend{}, errorf(p.last, UnexpectedToken, "expected message type, got %s", p.last)
+	}
+	ext := Extend{Type: typ}
+
+	err = p.block("extend", &ext.Comments, func(next scanner.Token) *Error {
+		switch kind := next.Kind; {
+		case kind.IsType() || kind == token.Identifier || kind == token.Dot || kind == token.Repeated ||
+			kind == token.Optional || kind == token.Required || kind == token.Group || kind == token.Map:
+			f, err := parseField(p)
+			if err != nil {
+				return err
+			}
+			ext.Fields = append(ext.Fields, f)
+		case kind == token.Semicolon:
+			return p.endDecl(token.Semicolon, nil)
+		default:
+			return unexpected(next, []token.Kind{token.CloseBrace}, "expected '}' to end extend definition, got %s", next)
+		}
+		return nil
+	})
+	if err != nil {
+		return Extend{}, err
+	}
+	ext.Span = p.span(start)
+	return ext, nil
+}
+
+// extensions = "extensions" ranges [ "[" fieldOptions "]" ] ";"
+// ranges = range { "," range }
+// range =  intLit [ "to" ( intLit | "max" ) ]
+func parseExtensions(p *peeker) (ExtensionRange, *Error) {
+	start := p.pos()
+	tok, err := p.consume(token.Extensions)
+	if err != nil {
+		return ExtensionRange{}, err
+	}
+	if p.syntax == Proto3 {
+		return ExtensionRange{}, errorf(tok, NotAllowed, "extension ranges are not allowed in proto3")
 	}
-	return Type{UserDefined: parseFullIdentifier(p)}
+
+	var ext ExtensionRange
+	for {
+		from := p.pos()
+		var r Range
+		if r.From, err = parseInt32(p, false); err != nil {
+			return ExtensionRange{}, err
+		}
+		r.To = r.From
+		if _, ok := p.maybeConsume(token.To); ok {
+			if r.To, err = parseRangeEnd(p, false, MaxFieldNumber); err != nil {
+				return ExtensionRange{}, err
+			}
+		}
+		r.Span = p.span(from)
+		ext.Ranges = append(ext.Ranges, r)
+		if _, ok := p.maybeConsume(token.Comma); !ok {
+			break
+		}
+	}
+	if ext.Options, err = parseFieldOptions(p); err != nil {
+		return ExtensionRange{}, err
+	}
+	if err := p.endDecl(token.Semicolon, &ext.Comments); err != nil {
+		return ExtensionRange{}, err
+	}
+	ext.Span = p.span(start)
+	return ext, nil
+}
+
+// parseRangeEnd parses the end of a range, which is either a number, with a
+// sign if signed is true, or "max", corresponding to the given value.
+func parseRangeEnd(p *peeker, signed bool, max int) (int, *Error) {
+	if tok := p.peek(); tok.Is(token.Identifier) && tok.Text == "max" {
+		p.scan()
+		return max, nil
+	}
+	return parseInt32(p, signed)
 }
 
 // reserved = "reserved" ( ranges | fieldNames ) ";"
 // fieldNames = fieldName { "," fieldName }
-func parseReserved(p *peeker) Reserved {
-	p.consume(token.Reserved)
+//
+// In enums, the numbers of the ranges can be negative, as indicated by signed,
+// and max is the largest value of a range.
+func parseReserved(p *peeker, signed bool, max int) (Reserved, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Reserved); err != nil {
+		return Reserved{}, err
+	}
 
 	var res Reserved
 	for {
-		from, ok := p.maybeConsume(token.DecimalLiteral, token.StringLiteral)
-		if !ok {
-			panicf("expected decimal literal or string, got %s", from)
-		}
-		if _, ok := p.maybeConsume(token.To); ok {
-			to := p.consume(from.Kind)
-			if !from.Is(token.DecimalLiteral) {
-				panicf("ranges over strings are not supported %s to %s", from, to)
+		switch from := p.peek(); {
+		case from.Is(token.StringLiteral):
+			p.scan()
+			if _, ok := p.maybeConsume(token.To); ok {
+				return Reserved{}, errorf(from, UnexpectedToken, "ranges over strings are not supported %s to %s", from, p.peek())
 			}
-			res.Ranges = append(res.Ranges, Range{From: atoi(from), To: atoi(to)})
-		} else {
-			if from.Is(token.DecimalLiteral) {
-				res.IDs = append(res.IDs, atoi(from))
-			} else {
-				res.Names = append(res.Names, unquote(from))
+			name, err := unquote(from)
+			if err != nil {
+				return Reserved{}, err
 			}
+			res.Names = append(res.Names, name)
+		case isInteger(from) || signed && from.Is(token.Minus):
+			n, err := parseInt32(p, signed)
+			if err != nil {
+				return Reserved{}, err
+			}
+			to := n
+			if _, ok := p.maybeConsume(token.To); ok {
+				if to, err = parseRangeEnd(p, signed, max); err != nil {
+					return Reserved{}, err
+				}
+			}
+			res.Ranges = append(res.Ranges, Range{Span: p.span(from.Pos), From: n, To: to})
+		default:
+			return Reserved{}, unexpected(from, []token.Kind{token.DecimalLiteral, token.HexLiteral, token.OctalLiteral, token.StringLiteral}, "expected integer or string, got %s", from)
 		}
-		if _, ok := p.maybeConsume(token.Semicolon); ok {
-			return res
+		if p.peek().Is(token.Semicolon) {
+			if err := p.endDecl(token.Semicolon, &res.Comments); err != nil {
+				return Reserved{}, err
+			}
+			res.Span = p.span(start)
+			return res, nil
+		}
+		if _, err := p.consume(token.Comma); err != nil {
+			return Reserved{}, err
 		}
-		p.consume(token.Comma)
 	}
 }
 
 // service = "service" serviceName "{" { option | rpc | emptyStatement } "}"
-func parseService(p *peeker) Service {
-	p.consume(token.Service)
-	svc := Service{Name: identifier(p.consume(token.Identifier))}
+func parseService(p *peeker) (Service, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.Service); err != nil {
+		return Service{}, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return Service{}, err
+	}
+	svc := Service{Name: name}
 
-	p.consume(token.OpenBrace)
-	for {
-		switch p.peek().Kind {
+	err = p.block("service", &svc.Comments, func(next scanner.Token) *Error {
+		switch next.Kind {
 		case token.Option:
-			svc.Options = append(svc.Options, parseOption(p))
+			opt, err := parseOption(p)
+			if err != nil {
+				return err
+			}
+			svc.Options = append(svc.Options, opt)
 		case token.RPC:
-			svc.RPCs = append(svc.RPCs, parseRPC(p))
-		case token.CloseBrace:
-			p.scan()
-			return svc
+			rpc, err := parseRPC(p)
+			if err != nil {
+				return err
+			}
+			svc.RPCs = append(svc.RPCs, rpc)
 		default:
-			panicf("expected option or rpc in service, got %s", p.peek())
+			return unexpected(next, []token.Kind{token.Option, token.RPC, token.CloseBrace}, "expected option or rpc in service, got %s", next)
 		}
+		return nil
+	})
+	if err != nil {
+		return Service{}, err
 	}
+	svc.Span = p.span(start)
+	return svc, nil
 }
 
 // rpc = "rpc" rpcName rpcParam "returns" rpcParam (( "{" {option | emptyStatement } "}" ) | ";")
-func parseRPC(p *peeker) RPC {
-	p.consume(token.RPC)
-	rpc := RPC{Name: identifier(p.consume(token.Identifier))}
-	rpc.In = parseRPCParam(p)
-	p.consume(token.Returns)
-	rpc.Out = parseRPCParam(p)
+func parseRPC(p *peeker) (RPC, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.RPC); err != nil {
+		return RPC{}, err
+	}
+	var rpc RPC
+	var err *Error
+	if rpc.Name, err = p.name(); err != nil {
+		return RPC{}, err
+	}
+	if rpc.In, err = parseRPCParam(p); err != nil {
+		return RPC{}, err
+	}
+	if _, err := p.consume(token.Returns); err != nil {
+		return RPC{}, err
+	}
+	if rpc.Out, err = parseRPCParam(p); err != nil {
+		return RPC{}, err
+	}
 
-	if _, ok := p.maybeConsume(token.Semicolon); ok {
-		return rpc
+	if p.peek().Is(token.Semicolon) {
+		if err := p.endDecl(token.Semicolon, &rpc.Comments); err != nil {
+			return RPC{}, err
+		}
+		rpc.Span = p.span(start)
+		return rpc, nil
 	}
 
-	p.consume(token.OpenBrace)
-	for {
-		if _, ok := p.maybeConsume(token.CloseBrace); ok {
-			return rpc
+	rpc.Body = true
+	err = p.block("rpc", &rpc.Comments, func(next scanner.Token) *Error {
+		opt, err := parseOption(p)
+		if err != nil {
+			return err
 		}
-		rpc.Options = append(rpc.Options, parseOption(p))
+		rpc.Options = append(rpc.Options, opt)
+		return nil
+	})
+	if err != nil {
+		return RPC{}, err
 	}
+	rpc.Span = p.span(start)
+	return rpc, nil
 }
 
 // rpcParam = "(" [ "stream" ] messageType ")"
-func parseRPCParam(p *peeker) RPCParam {
-	p.consume(token.OpenParen)
+func parseRPCParam(p *peeker) (RPCParam, *Error) {
+	start := p.pos()
+	if _, err := p.consume(token.OpenParen); err != nil {
+		return RPCParam{}, err
+	}
 	_, stream := p.maybeConsume(token.Stream)
-	typ := parseFullIdentifier(p)
-	p.consume(token.CloseParen)
-	return RPCParam{Stream: stream, Type: typ}
-}
-
-func identifier(tok scanner.Token) Identifier {
-	if !tok.Is(token.Identifier) {
-		panicf("can't parse an identifier from %s", tok)
+	_, dot := p.maybeConsume(token.Dot)
+	typ, err := parseFullIdentifier(p)
+	if err != nil {
+		return RPCParam{}, err
+	}
+	if _, err := p.consume(token.CloseParen); err != nil {
+		return RPCParam{}, err
 	}
-	return Identifier(tok.Text)
+	return RPCParam{Span: p.span(start), Stream: stream, Type: typ, FullyQualified: dot}, nil
 }
 
-func parseFullIdentifier(p *peeker) []Identifier {
-	ident := []Identifier{identifier(p.consume(token.Identifier))}
+func parseFullIdentifier(p *peeker) ([]Identifier, *Error) {
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	ident := []Identifier{name}
 	for {
 		dot := p.peek()
 		if !dot.Is(token.Dot) {
-			return ident
+			return ident, nil
 		}
 		p.scan()
-		ident = append(ident, identifier(p.consume(token.Identifier)))
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+		ident = append(ident, name)
 	}
 }
 
-func parseInt(tok scanner.Token, base int, negative bool) int64 {
-	v, err := strconv.ParseInt(tok.Text, base, 64)
+// parseInt32 parses an integer literal in any base, preceded by a minus sign
+// if signed is true, whose value must fit in an int32.
+func parseInt32(p *peeker, signed bool) (int, *Error) {
+	negative := false
+	if signed {
+		_, negative = p.maybeConsume(token.Minus)
+	}
+	tok := p.peek()
+	if !isInteger(tok) {
+		return 0, unexpected(tok, intKinds, "expected integer, got %s", tok)
+	}
+	p.scan()
+	n, err := parseNumber(tok, negative)
 	if err != nil {
-		panicf("bad %s: %v", tok, err)
+		return 0, err
 	}
-	if negative {
-		return -v
+	if n.Kind != IntNumber || n.Int < math.MinInt32 || n.Int > math.MaxInt32 {
+		return 0, errorf(tok, BadNumber, "integer %s is out of range", n.Text)
 	}
-	return v
+	return int(n.Int), nil
 }
 
-func parseFloat(tok scanner.Token, negative bool) float64 {
-	v, err := strconv.ParseFloat(tok.Text, 64)
-	if err != nil {
-		panicf("bad %s: %v", tok, err)
-	}
+func isInteger(tok scanner.Token) bool {
+	return tok.Is(token.DecimalLiteral) || tok.Is(token.HexLiteral) || tok.Is(token.OctalLiteral)
+}
+
+// parseNumber returns the value of the given numeric literal, or of the
+// identifiers inf and nan, preceded by a minus sign if negative is true.
+func parseNumber(tok scanner.Token, negative bool) (Number, *Error) {
+	n := Number{Text: tok.Text}
+	sign := 1
 	if negative {
-		return -v
+		n.Text = "-" + n.Text
+		sign = -1
 	}
-	return v
+
+	switch tok.Kind {
+	case token.Identifier:
+		if tok.Text == "inf" {
+			n.Kind, n.Float = InfNumber, math.Inf(sign)
+		} else {
+			n.Kind, n.Float = NaNNumber, math.NaN()
+		}
+	case token.FloatLiteral:
+		v, err := strconv.ParseFloat(tok.Text, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return Number{}, errorf(tok, BadNumber, "bad %s: %v", tok, err)
+		}
+		n.Kind, n.Float = FloatNumber, float64(sign)*v
+	default:
+		text, base := tok.Text, 10
+		switch tok.Kind {
+		case token.HexLiteral:
+			text, base = text[2:], 16
+		case token.OctalLiteral:
+			base = 8
+		}
+		v, err := strconv.ParseUint(text, base, 64)
+		switch {
+		case err != nil, negative && v > 1<<63:
+			return Number{}, errorf(tok, BadNumber, "integer %s is out of range", n.Text)
+		case negative:
+			n.Int = int64(-v)
+		case v > math.MaxInt64:
+			n.Kind, n.Uint = UintNumber, v
+		default:
+			n.Int = int64(v)
+		}
+	}
+	return n, nil
+}
+
+// The identifiers inf and nan are numbers when used as values.
+func isInfOrNaN(tok scanner.Token) bool {
+	return tok.Is(token.Identifier) && (tok.Text == "inf" || tok.Text == "nan")
 }
 
-func parseValue(p *peeker, negative bool) interface{} {
+func parseValue(p *peeker, negative bool) (interface{}, *Error) {
 	next := p.peek()
+	if isInfOrNaN(next) {
+		return parseNumber(p.scan(), negative)
+	}
 	if next.Is(token.Identifier) {
+		if negative {
+			return nil, errorf(next, UnexpectedToken, "found minus sign before %s, only inf and nan can be negative", next)
+		}
 		return parseFullIdentifier(p)
 	}
+	if !next.IsConstant() && !next.Is(token.Minus) && !next.Is(token.Plus) {
+		return nil, unexpected(next, nil, "expected a valid constant value, but got %s", next)
+	}
 	p.scan()
 	switch next.Kind {
-	case token.DecimalLiteral:
-		return parseInt(next, 10, negative)
-	case token.HexLiteral:
-		return parseInt(next, 16, negative)
-	case token.OctalLiteral:
-		return parseInt(next, 8, negative)
-	case token.FloatLiteral:
-		return parseFloat(next, negative)
-	default:
-		if negative {
-			panicf("found minus sign before %s", next)
+	case token.DecimalLiteral, token.HexLiteral, token.OctalLiteral, token.FloatLiteral:
+		return parseNumber(next, negative)
+	}
+	if negative {
+		return nil, unexpected(next, numberKinds, "found minus sign before %s", next)
+	}
+	switch next.Kind {
+	case token.StringLiteral:
+		// Adjacent string literals are concatenated.
+		s, err := unquote(next)
+		if err != nil {
+			return nil, err
 		}
-		switch next.Kind {
-		case token.StringLiteral:
-			return unquote(next)
-		case token.False:
-			return false
-		case token.True:
-			return true
-		case token.Minus:
-			return parseValue(p, true)
-		case token.Plus:
-			return parseValue(p, false)
-		default:
-			panicf("expected a valid constant value, but got %s", next)
+		for p.peek().Is(token.StringLiteral) {
+			more, err := unquote(p.scan())
+			if err != nil {
+				return nil, err
+			}
+			s += more
 		}
+		return s, nil
+	case token.False:
+		return false, nil
+	case token.True:
+		return true, nil
+	case token.Minus:
+		return parseValue(p, true)
+	case token.Plus:
+		return parseValue(p, false)
+	default:
+		return nil, unexpected(next, nil, "expected a valid constant value, but got %s", next)
 	}
-	panic("unreachable")
 }
 
-func panicf(format string, args ...interface{}) { panic(fmt.Sprintf(format, args...)) }
-
 type peeker struct {
-	s      *scanner.Scanner
-	peeked *scanner.Token
+	s        *scanner.Scanner
+	peeked   *scanner.Token
+	comments []scanner.Token // comments found right before the peeked token.
+	last     scanner.Token   // the last token returned by scan.
+	mode     Mode
+	errs     ErrorList // errors recorded in Recover mode.
+	syntax   string    // syntax of the file, used to check what's allowed.
+
+	// comments to be attached to the next declaration.
+	leading  string
+	detached []string
 }
 
 func (p *peeker) scan() (res scanner.Token) {
-	if tok := p.peeked; tok != nil {
-		p.peeked = nil
-		return *tok
-	}
-	tok := p.s.Scan()
-	for tok.Is(token.Comment) {
-		tok = p.s.Scan()
-	}
+	tok := p.peek()
+	p.peeked = nil
+	p.last = tok
 	return tok
 }
 
@@ -465,28 +1309,62 @@ func (p *peeker) peek() (res scanner.Token) {
 	if tok := p.peeked; tok != nil {
 		return *tok
 	}
+	p.comments = nil
 	tok := p.s.Scan()
 	for tok.Is(token.Comment) {
+		p.comments = append(p.comments, tok)
 		tok = p.s.Scan()
 	}
 	p.peeked = &tok
 	return tok
 }
 
-// consumes and returns a token of one of the given kinds or panics
-func (p *peeker) consume(toks ...token.Kind) scanner.Token {
-	got := p.scan()
-	for _, tok := range toks {
-		if got.Kind == tok {
-			return got
-		}
+// name consumes an identifier and returns it. Keywords and type names are
+// also accepted, since they're only reserved where they are expected.
+func (p *peeker) name() (Identifier, *Error) {
+	switch tok := p.peek(); {
+	case tok.Is(token.Identifier):
+		p.scan()
+		return Identifier(tok.Text), nil
+	case tok.IsKeyword() || tok.IsType():
+		p.scan()
+		return Identifier(tok.Kind.String()), nil
+	default:
+		return "", unexpected(tok, []token.Kind{token.Identifier}, "expected identifier, got %s", tok)
+	}
+}
+
+// report records an error found once a definition has been completely
+// parsed, so there's no need to skip the rest of the statement. Unless in
+// Recover mode, the error is returned instead, to end the parsing.
+func (p *peeker) report(pos token.Position, cat Category, format string, args ...interface{}) *Error {
+	e := &Error{Pos: pos, Category: cat, Msg: fmt.Sprintf(format, args...)}
+	if p.mode&Recover == 0 {
+		return e
+	}
+	p.errs.add(e)
+	return nil
+}
+
+// pos returns the position of the next token.
+func (p *peeker) pos() token.Position { return p.peek().Pos }
+
+// span returns the Span going from the given position to the end of the last
+// scanned token.
+func (p *peeker) span(start token.Position) Span { return Span{Pos: start, End: p.last.End} }
+
+// consumes and returns a token of one of the given kinds or returns what it
+// found and an error, without consuming anything.
+func (p *peeker) consume(toks ...token.Kind) (scanner.Token, *Error) {
+	got, ok := p.maybeConsume(toks...)
+	if ok {
+		return got, nil
 	}
 	var types []string
 	for _, tok := range toks {
 		types = append(types, fmt.Sprint(tok))
 	}
-	panicf("expected %v, got %s", strings.Join(types, ", "), got)
-	panic("unreachable")
+	return got, unexpected(got, toks, "expected %v, got %s", strings.Join(types, ", "), got)
 }
 
 // consumes and returns a token of one of the given kinds or returns what it found and false.
@@ -501,36 +1379,243 @@ func (p *peeker) maybeConsume(toks ...token.Kind) (scanner.Token, bool) {
 	return got, false
 }
 
-func atoi(tok scanner.Token) int {
-	if !tok.IsNumber() {
-		panicf("can't parse a number from %s", tok)
-	}
-	v, err := strconv.Atoi(tok.Text)
+// endDecl consumes the token of the given kind ending a declaration, and
+// attaches to c the comments collected before the declaration and the one
+// trailing it. If c is nil, the comments are discarded, and only the ones
+// after the token are kept for the next declaration.
+func (p *peeker) endDecl(kind token.Kind, c *Comments) *Error {
+	tok, err := p.consume(kind)
 	if err != nil {
-		panicf("bad number %s", tok.Text)
+		return err
+	}
+	trailing, detached, leading := splitComments(&tok, p.comments, p.peek())
+
+	leading, p.leading = p.leading, leading
+	switch {
+	case c != nil:
+		detached, p.detached = p.detached, detached
+		c.LeadingComments, c.TrailingComment, c.LeadingDetachedComments = leading, trailing, detached
+	case kind == token.CloseBrace:
+		p.detached = detached
+	default:
+		p.detached = append(p.detached, detached...)
 	}
-	return v
+	return nil
 }
 
-func unquote(tok scanner.Token) string {
+// block parses a block of statements enclosed in braces, calling stmt with the
+// first token of each statement. The given name describes the block in errors,
+// and the comments around the opening brace are attached to c.
+func (p *peeker) block(name string, c *Comments, stmt func(next scanner.Token) *Error) *Error {
+	if err := p.endDecl(token.OpenBrace, c); err != nil {
+		return err
+	}
+	for {
+		switch next := p.peek(); next.Kind {
+		case token.CloseBrace:
+			return p.endDecl(token.CloseBrace, nil)
+		case token.EOF:
+			// In Recover mode consider the block closed, so its contents are kept.
+			return p.try(func() *Error {
+				return unexpected(next, []token.Kind{token.CloseBrace}, "expected '}' to end %s definition, got %s", name, next)
+			})
+		default:
+			if err := p.try(func() *Error { return stmt(next) }); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// try calls f, which parses a single statement, and returns its error. In
+// Recover mode the error is recorded instead, and the rest of the statement
+// is skipped, so the parsing can go on.
+func (p *peeker) try(f func() *Error) *Error {
+	if p.mode&Recover == 0 {
+		return f()
+	}
+
+	start := p.pos()
+	err := f()
+	if err == nil {
+		return nil
+	}
+	p.errs.add(err)
+	p.sync()
+	p.leading, p.detached = "", nil
+	// make sure we always make progress, even if f failed on its first token.
+	if next := p.peek(); next.Pos == start && !next.Is(token.EOF) {
+		p.scan()
+	}
+	return nil
+}
+
+// sync skips tokens until the end of the current statement, which is either
+// a ';' or the '}' closing a block opened in the statement, both consumed.
+// It also stops before a '}' closing the enclosing block, a keyword starting
+// a new statement, or the end of file.
+func (p *peeker) sync() {
+	depth := 0
+	for {
+		switch p.peek().Kind {
+		case token.EOF:
+			return
+		case token.Syntax, token.Edition, token.Import, token.Package, token.Option, token.Message,
+			token.Enum, token.Service, token.RPC, token.Oneof, token.Map, token.Reserved,
+			token.Repeated, token.Optional, token.Required, token.Extensions, token.Extend:
+			if depth == 0 {
+				return
+			}
+			p.scan()
+		case token.Semicolon:
+			p.scan()
+			if depth == 0 {
+				return
+			}
+		case token.OpenBrace:
+			p.scan()
+			depth++
+		case token.CloseBrace:
+			if depth == 0 {
+				return
+			}
+			p.scan()
+			if depth--; depth == 0 {
+				return
+			}
+		default:
+			p.scan()
+		}
+	}
+}
+
+// unquote decodes the given string literal, following the escape sequences
+// defined in the protobuf language. Octal and hex escapes produce single
+// bytes, so the result is not necessarily valid UTF-8.
+func unquote(tok scanner.Token) (string, *Error) {
 	if !tok.Is(token.StringLiteral) {
-		panicf("can't unquote %s", tok)
+		return "", unexpected(tok, []token.Kind{token.StringLiteral}, "can't unquote %s", tok)
 	}
-	v, err := strconv.Unquote(tok.Text)
-	if err != nil {
-		panicf("bad quoting on %s: %v", tok, err)
+
+	text := tok.Text[1 : len(tok.Text)-1]
+	var buf []byte
+	for i := 0; i < len(text); {
+		if text[i] != '\\' {
+			buf = append(buf, text[i])
+			i++
+			continue
+		}
+
+		start := i
+		i++
+		c := text[i]
+		i++
+		switch {
+		case simpleEscapes[c] != 0:
+			buf = append(buf, simpleEscapes[c])
+		case isOctalDigit(c):
+			v := int(c - '0')
+			for n := 1; n < 3 && i < len(text) && isOctalDigit(text[i]); n++ {
+				v = v*8 + int(text[i]-'0')
+				i++
+			}
+			if v > 0xff {
+				return "", escapeError(tok, start, "octal escape %s is out of range", text[start:i])
+			}
+			buf = append(buf, byte(v))
+		case c == 'x' || c == 'X':
+			n := hexDigits(text[i:], 2)
+			if n == 0 {
+				return "", escapeError(tok, start, "\\%c used with no following hex digits", c)
+			}
+			v, _ := strconv.ParseUint(text[i:i+n], 16, 8)
+			buf = append(buf, byte(v))
+			i += n
+		case c == 'u' || c == 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			if hexDigits(text[i:], size) != size {
+				return "", escapeError(tok, start, "\\%c must be followed by %d hex digits", c, size)
+			}
+			v, _ := strconv.ParseUint(text[i:i+size], 16, 32)
+			i += size
+			r := rune(v)
+			if utf16.IsSurrogate(r) && strings.HasPrefix(text[i:], `\u`) && hexDigits(text[i+2:], 4) == 4 {
+				low, _ := strconv.ParseUint(text[i+2:i+6], 16, 32)
+				if pair := utf16.DecodeRune(r, rune(low)); pair != utf8.RuneError {
+					r = pair
+					i += 6
+				}
+			}
+			if utf16.IsSurrogate(r) || !utf8.ValidRune(r) {
+				return "", escapeError(tok, start, "invalid unicode code point in escape %s", text[start:i])
+			}
+			var enc [utf8.UTFMax]byte
+			buf = append(buf, enc[:utf8.EncodeRune(enc[:], r)]...)
+		default:
+			return "", escapeError(tok, start, "invalid escape sequence \\%c", c)
+		}
+	}
+	return string(buf), nil
+}
+
+var simpleEscapes = map[byte]byte{
+	'a': '\a', 'b': '\b', 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v',
+	'\\': '\\', '\'': '\'', '"': '"', '?': '?',
+}
+
+func isOctalDigit(c byte) bool { return '0' <= c && c <= '7' }
+
+// hexDigits returns how many of the first max bytes of s are hex digits.
+func hexDigits(s string, max int) int {
+	n := 0
+	for n < max && n < len(s) && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	return n
+}
+
+// escapeError returns an error located at the escape sequence starting at
+// the given offset in the contents of the literal.
+func escapeError(tok scanner.Token, offset int, format string, args ...interface{}) *Error {
+	prefix := tok.Text[:1+offset]
+	pos := tok.Pos
+	pos.Offset += len(prefix)
+	pos.Column += utf8.RuneCountInString(prefix)
+	return &Error{
+		Pos:      pos,
+		Category: BadString,
+		Found:    tok,
+		Msg:      fmt.Sprintf(format, args...),
 	}
-	return v
 }
 
 func kindToType(k token.Kind) PredefinedType {
 	t, ok := kindToTypeMap[k]
 	if !ok {
-		panicf("could not find predefined type for %s", k)
+		panic(fmt.Sprintf("could not find predefined type for %s", k))
 	}
 	return t
 }
 
+var (
+	topLevelKinds = []token.Kind{
+		token.Package, token.Import, token.Option, token.Message, token.Enum, token.Service,
+		token.Extend,
+	}
+	numberKinds = []token.Kind{
+		token.DecimalLiteral, token.FloatLiteral, token.HexLiteral, token.OctalLiteral,
+	}
+	intKinds     = []token.Kind{token.DecimalLiteral, token.HexLiteral, token.OctalLiteral}
+	labelKinds   = []token.Kind{token.Required, token.Optional, token.Repeated}
+	keyTypeKinds = []token.Kind{
+		token.Bool, token.Fixed32, token.Fixed64, token.Int32, token.Int64, token.Sfixed32,
+		token.Sfixed64, token.Sint32, token.Sint64, token.String, token.Uint32, token.Uint64,
+	}
+)
+
 var kindToTypeMap = map[token.Kind]PredefinedType{
 	token.Bytes:    TypeBytes,
 	token.Double:   TypeDouble,
@@ -16,9 +16,10 @@ package parser
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -40,6 +41,15 @@ func fullIdentifier(names ...string) []Identifier {
 	return ids
 }
 
+// intNumber returns the Number for the given decimal literal.
+func intNumber(text string) Number {
+	v, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return Number{Text: text, Int: v}
+}
+
 func TestParse(t *testing.T) {
 	tests := []struct {
 		name string
@@ -106,20 +116,23 @@ func TestParse(t *testing.T) {
 				}},
 				Messages: []Message{
 					{
-						Name: "SearchRequest",
+						Comments: Comments{LeadingDetachedComments: []string{" this is a comment\n"}},
+						Name:     "SearchRequest",
 						Fields: []Field{
 							{
 								Type:   Type{Predefined: TypeString},
 								Name:   "query",
 								Number: 1,
 							}, {
-								Type:   Type{Predefined: TypeInt32},
-								Name:   "page_number",
-								Number: 2,
+								Comments: Comments{TrailingComment: " Which page number do we want?\n"},
+								Type:     Type{Predefined: TypeInt32},
+								Name:     "page_number",
+								Number:   2,
 							}, {
-								Type:   Type{Predefined: TypeInt32},
-								Name:   "result_per_page",
-								Number: 3,
+								Comments: Comments{TrailingComment: " Number of results to return per page.\n"},
+								Type:     Type{Predefined: TypeInt32},
+								Name:     "result_per_page",
+								Number:   3,
 							}, {
 								Type:   Type{UserDefined: fullIdentifier("Corpus")},
 								Name:   "corpus",
@@ -144,8 +157,7 @@ func TestParse(t *testing.T) {
 						Name: "Foo",
 						Reserveds: []Reserved{
 							{
-								IDs:    []int{2, 15},
-								Ranges: []Range{{From: 9, To: 11}},
+								Ranges: []Range{{From: 2, To: 2}, {From: 15, To: 15}, {From: 9, To: 11}},
 							}, {
 								Names: []string{"foo", "bar"},
 							},
@@ -181,6 +193,136 @@ func TestParse(t *testing.T) {
 	}
 }
 
+func TestPositions(t *testing.T) {
+	in := `syntax = "proto3";
+
+message Foo {
+	repeated int32 ids = 1 [packed=true];
+	map<string, Bar> bars = 2;
+}
+
+service Search {
+	rpc Find (Foo) returns (stream Bar);
+}
+`
+	f, err := ParseFile("foo.proto", strings.NewReader(in), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		span       Span
+		start, end string
+	}{
+		{"file", f.Span, "foo.proto:1:1", "foo.proto:10:2"},
+		{"syntax", f.Syntax.Span, "foo.proto:1:1", "foo.proto:1:19"},
+		{"message", f.Messages[0].Span, "foo.proto:3:1", "foo.proto:6:2"},
+		{"field", f.Messages[0].Fields[0].Span, "foo.proto:4:2", "foo.proto:4:39"},
+		{"field type", f.Messages[0].Fields[0].Type.Span, "foo.proto:4:11", "foo.proto:4:16"},
+		{"field option", f.Messages[0].Fields[0].Options[0].Span, "foo.proto:4:26", "foo.proto:4:37"},
+		{"map", f.Messages[0].Maps[0].Span, "foo.proto:5:2", "foo.proto:5:28"},
+		{"map key", f.Messages[0].Maps[0].KeyType.Span, "foo.proto:5:6", "foo.proto:5:12"},
+		{"map value", f.Messages[0].Maps[0].ValueType.Span, "foo.proto:5:14", "foo.proto:5:17"},
+		{"service", f.Services[0].Span, "foo.proto:8:1", "foo.proto:10:2"},
+		{"rpc", f.Services[0].RPCs[0].Span, "foo.proto:9:2", "foo.proto:9:38"},
+		{"rpc output", f.Services[0].RPCs[0].Out.Span, "foo.proto:9:25", "foo.proto:9:37"},
+	}
+	for _, tt := range tests {
+		if start := tt.span.Pos.String(); start != tt.start {
+			t.Errorf("%s: expected to start at %s, got %s", tt.name, tt.start, start)
+		}
+		if end := tt.span.End.String(); end != tt.end {
+			t.Errorf("%s: expected to end at %s, got %s", tt.name, tt.end, end)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	// This is the example given in the documentation of SourceCodeInfo
+	// in google/protobuf/descriptor.proto.
+	in := `// Detached comment for syntax.
+
+// Comment attached to syntax.
+syntax = "proto3";
+message Foo {
+  int32 foo = 1;  // Comment attached to foo.
+  // Comment attached to bar.
+  int32 bar = 2;
+
+  string baz = 3;
+  // Comment attached to baz.
+  // Another line attached to baz.
+
+  // Comment attached to moo.
+  //
+  // Another line attached to moo.
+  double moo = 4;
+
+  // Detached comment for corge. This is not leading or trailing comments
+  // to moo or corge because there are blank lines separating it from
+  // both.
+
+  // Detached comment for corge paragraph 2.
+
+  string corge = 5;
+  /* Block comment attached
+   * to corge.  Leading asterisks
+   * will be removed. */
+  /* Block comment attached to
+   * grault. */
+  int32 grault = 6;
+
+  // ignored detached comments.
+}
+`
+	f, err := ParseFile("foo.proto", strings.NewReader(in), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  Comments
+		want Comments
+	}{
+		{"syntax", f.Syntax.Comments, Comments{
+			LeadingDetachedComments: []string{" Detached comment for syntax.\n"},
+			LeadingComments:         " Comment attached to syntax.\n",
+		}},
+		{"Foo", f.Messages[0].Comments, Comments{}},
+		{"foo", f.Messages[0].Fields[0].Comments, Comments{
+			TrailingComment: " Comment attached to foo.\n",
+		}},
+		{"bar", f.Messages[0].Fields[1].Comments, Comments{
+			LeadingComments: " Comment attached to bar.\n",
+		}},
+		{"baz", f.Messages[0].Fields[2].Comments, Comments{
+			TrailingComment: " Comment attached to baz.\n Another line attached to baz.\n",
+		}},
+		{"moo", f.Messages[0].Fields[3].Comments, Comments{
+			LeadingComments: " Comment attached to moo.\n\n Another line attached to moo.\n",
+		}},
+		{"corge", f.Messages[0].Fields[4].Comments, Comments{
+			LeadingDetachedComments: []string{
+				" Detached comment for corge. This is not leading or trailing comments\n" +
+					" to moo or corge because there are blank lines separating it from\n" +
+					" both.\n",
+				" Detached comment for corge paragraph 2.\n",
+			},
+			TrailingComment: " Block comment attached\n to corge.  Leading asterisks\n will be removed. ",
+		}},
+		{"grault", f.Messages[0].Fields[5].Comments, Comments{
+			LeadingComments: " Block comment attached to\n grault. ",
+		}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.want, tt.got) {
+			t.Errorf("%s: %v", tt.name, pretty.Diff(tt.want, tt.got))
+		}
+	}
+}
+
 func TestParseSyntax(t *testing.T) {
 	tests := []struct {
 		name string
@@ -192,24 +334,24 @@ func TestParseSyntax(t *testing.T) {
 			out: Syntax{Value: "proto3"},
 		},
 		{name: "missing equal", in: `syntax "proto3";`,
-			err: errors.New(`expected '=', got string literal ("proto3")`),
+			err: errors.New(`1:8: expected '=', got string literal ("proto3")`),
 		},
-		{name: "bad text", in: `syntax = "proto2";`,
-			err: errors.New(`expected literal string proto3, got proto2 instead`),
+		{name: "bad text", in: `syntax = "proto4";`,
+			err: errors.New(`1:10: expected literal string proto2 or proto3, got proto4 instead`),
 		},
 		{name: "missing semicolon", in: `syntax = "proto3"`,
-			err: errors.New(`expected ';', got end of file`),
+			err: errors.New(`1:18: expected ';', got end of file`),
 		},
 		{name: "missing quotes", in: `syntax = proto3;`,
-			err: errors.New(`expected string literal, got identifier (proto3)`),
+			err: errors.New(`1:10: expected string literal, got identifier (proto3)`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var syntax Syntax
-			err := panicToErr(func() { syntax = parseSyntax(p) })
+			syntax, e := parseSyntax(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -235,21 +377,21 @@ func TestParseImport(t *testing.T) {
 			out: Import{Path: "path", Modifier: WeakImport},
 		},
 		{name: "bad modifier", in: `import bytes "path";`,
-			err: errors.New(`expected string literal, got bytes`),
+			err: errors.New(`1:8: expected string literal, got bytes`),
 		},
 		{name: "bad modifier keyword", in: `import enum "path";`,
-			err: errors.New(`expected string literal, got enum`),
+			err: errors.New(`1:8: expected string literal, got enum`),
 		},
 		{name: "bad import path", in: `import public path;`,
-			err: errors.New(`expected string literal, got identifier (path)`),
+			err: errors.New(`1:15: expected string literal, got identifier (path)`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var imp Import
-			err := panicToErr(func() { imp = parseImport(p) })
+			imp, e := parseImport(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -272,15 +414,15 @@ func TestParsePackage(t *testing.T) {
 			out: Package{Identifier: fullIdentifier("com", "example", "foo")},
 		},
 		{name: "bad identifier", in: `package "foo";`,
-			err: errors.New(`expected identifier, got string literal ("foo")`),
+			err: errors.New(`1:9: expected identifier, got string literal ("foo")`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var pkg Package
-			err := panicToErr(func() { pkg = parsePackage(p) })
+			pkg, e := parsePackage(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -311,25 +453,105 @@ func TestParseOption(t *testing.T) {
 		{name: "good syntax integer", in: `option options.number = 42;`,
 			out: Option{
 				Name:  fullIdentifier("options", "number"),
-				Value: int64(42),
+				Value: intNumber("42"),
 			},
 		},
 		{name: "good syntax signed float", in: `option java_package = -10.5;`,
 			out: Option{
 				Name:  fullIdentifier("java_package"),
-				Value: -10.5,
+				Value: Number{Kind: FloatNumber, Text: "-10.5", Float: -10.5},
+			},
+		},
+		{name: "adjacent strings", in: `option java_package = "com." 'example'
+				".foo";`,
+			out: Option{
+				Name:  fullIdentifier("java_package"),
+				Value: "com.example.foo",
 			},
 		},
 		{name: "bad syntax", in: `option java_package = syntax;`,
-			err: errors.New(`expected a valid constant value, but got syntax`),
+			err: errors.New(`1:23: expected a valid constant value, but got syntax`),
+		},
+		{name: "aggregate", in: `option (google.api.http) = { get: "/v1/{name=*}" body: "*" };`,
+			out: Option{
+				Prefix: fullIdentifier("google", "api", "http"),
+				Value: Aggregate{Fields: []AggregateField{
+					{Name: fullIdentifier("get"), Value: "/v1/{name=*}"},
+					{Name: fullIdentifier("body"), Value: "*"},
+				}},
+			},
+		},
+		{name: "nested aggregate",
+			in: `option (foo) = {
+				name: "a", count: -3; kind: BAR
+				inner { enabled: true }
+				other: < ratio: 0.5 >
+				[ext.value]: 1
+				[type.googleapis.com/foo.Bar] { id: 2 }
+			};`,
+			out: Option{
+				Prefix: fullIdentifier("foo"),
+				Value: Aggregate{Fields: []AggregateField{
+					{Name: fullIdentifier("name"), Value: "a"},
+					{Name: fullIdentifier("count"), Value: intNumber("-3")},
+					{Name: fullIdentifier("kind"), Value: fullIdentifier("BAR")},
+					{Name: fullIdentifier("inner"), Value: Aggregate{Fields: []AggregateField{
+						{Name: fullIdentifier("enabled"), Value: true},
+					}}},
+					{Name: fullIdentifier("other"), Value: Aggregate{Fields: []AggregateField{
+						{Name: fullIdentifier("ratio"), Value: Number{Kind: FloatNumber, Text: "0.5", Float: 0.5}},
+					}}},
+					{Name: fullIdentifier("ext", "value"), Extension: true, Value: intNumber("1")},
+					{
+						Name:      fullIdentifier("foo", "Bar"),
+						Extension: true,
+						TypeURL:   "type.googleapis.com",
+						Value: Aggregate{Fields: []AggregateField{
+							{Name: fullIdentifier("id"), Value: intNumber("2")},
+						}},
+					},
+				}},
+			},
+		},
+		{name: "custom option field", in: `option (foo.bar).baz.qux = 1;`,
+			out: Option{
+				Prefix: fullIdentifier("foo", "bar"),
+				Name:   fullIdentifier("baz", "qux"),
+				Value:  intNumber("1"),
+			},
+		},
+		{name: "lists", in: `option (foo) = { ids: [1, 2] items [{ id: 1 }, < id: 2 >] empty: [] };`,
+			out: Option{
+				Prefix: fullIdentifier("foo"),
+				Value: Aggregate{Fields: []AggregateField{
+					{Name: fullIdentifier("ids"), Value: List{Values: []interface{}{intNumber("1"), intNumber("2")}}},
+					{Name: fullIdentifier("items"), Value: List{Values: []interface{}{
+						Aggregate{Fields: []AggregateField{{Name: fullIdentifier("id"), Value: intNumber("1")}}},
+						Aggregate{Fields: []AggregateField{{Name: fullIdentifier("id"), Value: intNumber("2")}}},
+					}}},
+					{Name: fullIdentifier("empty"), Value: List{}},
+				}},
+			},
+		},
+		{name: "scalar without colon", in: `option (foo) = { id 1 };`,
+			err: errors.New(`1:21: expected ':' or a message after field name id, got decimal literal (1)`),
+		},
+		{name: "scalar list without colon", in: `option (foo) = { ids [1] };`,
+			err: errors.New(`1:23: expected a message in list without ':', got decimal literal (1)`),
+		},
+		{name: "nested lists", in: `option (foo) = { ids: [[1]] };`,
+			err: errors.New(`1:24: lists can't be nested`),
+		},
+		{name: "unterminated aggregate", in: `option (foo) = { id: 1;`,
+			err: errors.New(`1:24: expected identifier, got end of file`),
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var opt Option
-			err := panicToErr(func() { opt = parseOption(p) })
+			opt, e := parseOption(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -338,6 +560,178 @@ func TestParseOption(t *testing.T) {
 	}
 }
 
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+		err  error
+	}{
+		{name: "plain", in: `"hello"`, out: "hello"},
+		{name: "single quotes", in: `'say "hi"'`, out: `say "hi"`},
+		{name: "simple escapes", in: `"\a\b\f\n\r\t\v\\\'\"\?"`, out: "\a\b\f\n\r\t\v\\'\"?"},
+		{name: "octal", in: `"\0\12\101\3770"`, out: "\x00\nA\xff0"},
+		{name: "hex", in: `"\x4\x41\X411"`, out: "\x04AA1"},
+		{name: "unicode", in: `"\u00e9\U0001F600"`, out: "é😀"},
+		{name: "surrogate pair", in: `"\ud83d\ude00"`, out: "😀"},
+		{name: "utf8", in: `"héllo"`, out: "héllo"},
+		{name: "bad escape", in: `"ab\qc"`,
+			err: errors.New(`1:4: invalid escape sequence \q`)},
+		{name: "octal out of range", in: `"é\400"`,
+			err: errors.New(`1:3: octal escape \400 is out of range`)},
+		{name: "hex without digits", in: `"\xg"`,
+			err: errors.New(`1:2: \x used with no following hex digits`)},
+		{name: "short unicode", in: `"\u12"`,
+			err: errors.New(`1:2: \u must be followed by 4 hex digits`)},
+		{name: "lone surrogate", in: `"\ud83d"`,
+			err: errors.New(`1:2: invalid unicode code point in escape \ud83d`)},
+		{name: "out of range code point", in: `"\U00110000"`,
+			err: errors.New(`1:2: invalid unicode code point in escape \U00110000`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tok := scanner.Token{
+				Kind: token.StringLiteral,
+				Text: tt.in,
+				Pos:  token.Position{Line: 1, Column: 1},
+			}
+			s, e := unquote(tok)
+			err := asError(e)
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			if s != tt.out {
+				t.Errorf("expected %q, got %q", tt.out, s)
+			}
+		})
+	}
+}
+
+func TestParseNumbers(t *testing.T) {
+	tests := []struct {
+		in  string
+		out Number
+		err error
+	}{
+		{in: `42`, out: Number{Kind: IntNumber, Text: "42", Int: 42}},
+		{in: `-0x1F`, out: Number{Kind: IntNumber, Text: "-0x1F", Int: -31}},
+		{in: `017`, out: Number{Kind: IntNumber, Text: "017", Int: 15}},
+		{in: `18446744073709551615`, out: Number{Kind: UintNumber, Text: "18446744073709551615", Uint: 1<<64 - 1}},
+		{in: `-9223372036854775808`, out: Number{Kind: IntNumber, Text: "-9223372036854775808", Int: math.MinInt64}},
+		{in: `+1.5e3`, out: Number{Kind: FloatNumber, Text: "1.5e3", Float: 1500}},
+		{in: `inf`, out: Number{Kind: InfNumber, Text: "inf", Float: math.Inf(1)}},
+		{in: `-inf`, out: Number{Kind: InfNumber, Text: "-inf", Float: math.Inf(-1)}},
+		{in: `nan`, out: Number{Kind: NaNNumber, Text: "nan", Float: math.NaN()}},
+		{in: `18446744073709551616`, err: errors.New(`1:1: integer 18446744073709551616 is out of range`)},
+		{in: `-9223372036854775809`, err: errors.New(`1:2: integer -9223372036854775809 is out of range`)},
+		{in: `-foo`, err: errors.New(`1:2: found minus sign before identifier (foo), only inf and nan can be negative`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
+			v, e := parseValue(p, false)
+			err := asError(e)
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			n, ok := v.(Number)
+			if !ok {
+				t.Fatalf("expected a Number, got %T", v)
+			}
+			same := n.Float == tt.out.Float || math.IsNaN(n.Float) && math.IsNaN(tt.out.Float)
+			n.Float, tt.out.Float = 0, 0
+			if !same || n != tt.out {
+				t.Errorf("expected %#v, got %#v", tt.out, v)
+			}
+		})
+	}
+}
+
+func TestParseEnum(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  Enum
+		err  error
+	}{
+		{name: "negative and hex values",
+			in: `enum Foo {
+					NEGATIVE = -1;
+					HEX = 0x10;
+					OCTAL = 010 [deprecated = true];
+				}`,
+			out: Enum{
+				Name: "Foo",
+				Fields: []EnumField{
+					{Name: "NEGATIVE", Number: -1},
+					{Name: "HEX", Number: 16},
+					{
+						Name:    "OCTAL",
+						Number:  8,
+						Options: []Option{{Name: fullIdentifier("deprecated"), Value: true}},
+					},
+				},
+			},
+		},
+		{name: "reserved and empty statements",
+			in: `enum Foo {
+					;
+					reserved -10 to -5, 2, 100 to max;
+					reserved "BAR";
+					FOO = 0;;
+				}`,
+			out: Enum{
+				Name:   "Foo",
+				Fields: []EnumField{{Name: "FOO", Number: 0}},
+				Reserveds: []Reserved{{
+					Ranges: []Range{{From: -10, To: -5}, {From: 2, To: 2}, {From: 100, To: MaxEnumNumber}},
+				}, {
+					Names: []string{"BAR"},
+				}},
+			},
+		},
+		{name: "aliases",
+			in: `enum Foo {
+					option allow_alias = true;
+					STARTED = 1;
+					RUNNING = 1;
+				}`,
+			out: Enum{
+				Name:    "Foo",
+				Options: []Option{{Name: fullIdentifier("allow_alias"), Value: true}},
+				Fields:  []EnumField{{Name: "STARTED", Number: 1}, {Name: "RUNNING", Number: 1}},
+			},
+		},
+		{name: "aliases not allowed",
+			in: `enum Foo {
+	STARTED = 1;
+	RUNNING = 1;
+}`,
+			err: errors.New(`3:2: RUNNING uses the same number 1 as STARTED, set option allow_alias = true to allow aliases`),
+		},
+		{name: "out of range", in: `enum Foo { BIG = 2147483648; }`,
+			err: errors.New(`1:18: integer 2147483648 is out of range`),
+		},
+		{name: "float value", in: `enum Foo { BAD = 1.5; }`,
+			err: errors.New(`1:18: expected integer, got float literal (1.5)`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
+			enum, e := parseEnum(p)
+			err := asError(e)
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			checkResults(t, tt.out, enum)
+		})
+	}
+}
+
 func TestParseMessage(t *testing.T) {
 	tests := []struct {
 		name string
@@ -355,10 +749,10 @@ func TestParseMessage(t *testing.T) {
 			out: Message{
 				Name: "Foo",
 				Fields: []Field{{
-					Repeated: true,
-					Type:     Type{Predefined: TypeInt32},
-					Name:     "ids",
-					Number:   1,
+					Label:  RepeatedLabel,
+					Type:   Type{Predefined: TypeInt32},
+					Name:   "ids",
+					Number: 1,
 				}},
 			},
 		},
@@ -374,10 +768,10 @@ func TestParseMessage(t *testing.T) {
 					Name:   "foo",
 					Number: 1,
 				}, {
-					Repeated: true,
-					Type:     Type{Predefined: TypeInt64},
-					Name:     "ids",
-					Number:   2,
+					Label:  RepeatedLabel,
+					Type:   Type{Predefined: TypeInt64},
+					Name:   "ids",
+					Number: 2,
 				}},
 			},
 		},
@@ -388,10 +782,10 @@ func TestParseMessage(t *testing.T) {
 			out: Message{
 				Name: "Foo",
 				Fields: []Field{{
-					Repeated: true,
-					Type:     Type{Predefined: TypeInt32},
-					Name:     "ids",
-					Number:   1,
+					Label:  RepeatedLabel,
+					Type:   Type{Predefined: TypeInt32},
+					Name:   "ids",
+					Number: 1,
 					Options: []Option{{
 						Name:  fullIdentifier("packed"),
 						Value: true,
@@ -406,10 +800,10 @@ func TestParseMessage(t *testing.T) {
 			out: Message{
 				Name: "Foo",
 				Fields: []Field{{
-					Repeated: true,
-					Type:     Type{Predefined: TypeInt32},
-					Name:     "ids",
-					Number:   1,
+					Label:  RepeatedLabel,
+					Type:   Type{Predefined: TypeInt32},
+					Name:   "ids",
+					Number: 1,
 					Options: []Option{{
 						Name:  fullIdentifier("packed"),
 						Value: true,
@@ -454,6 +848,30 @@ func TestParseMessage(t *testing.T) {
 				}},
 			},
 		},
+		{name: "a message with block comments",
+			in: `message Foo {
+					/* a block comment
+					 * spanning lines */
+					bool foo = 1; /* trailing */
+					int64 /* inline */ bar = 2;
+				}`,
+			out: Message{
+				Name: "Foo",
+				Fields: []Field{{
+					Comments: Comments{
+						LeadingComments: " a block comment\n spanning lines ",
+						TrailingComment: " trailing ",
+					},
+					Type:   Type{Predefined: TypeBool},
+					Name:   "foo",
+					Number: 1,
+				}, {
+					Type:   Type{Predefined: TypeInt64},
+					Name:   "bar",
+					Number: 2,
+				}},
+			},
+		},
 		{name: "a message inside of a message",
 			in: `message Foo {
 					message Bar {
@@ -517,8 +935,7 @@ func TestParseMessage(t *testing.T) {
 			out: Message{
 				Name: "Foo",
 				Reserveds: []Reserved{{
-					IDs:    []int{2, 15},
-					Ranges: []Range{{From: 9, To: 11}},
+					Ranges: []Range{{From: 2, To: 2}, {From: 15, To: 15}, {From: 9, To: 11}},
 				}, {
 					Names: []string{"foo", "bar"},
 				}},
@@ -529,8 +946,8 @@ func TestParseMessage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var msg Message
-			err := panicToErr(func() { msg = parseMessage(p) })
+			msg, e := parseMessage(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -539,6 +956,364 @@ func TestParseMessage(t *testing.T) {
 	}
 }
 
+func TestParseProto2(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  *File
+		err  error
+	}{
+		{name: "no syntax defaults to proto2",
+			in: `message Foo { optional int32 id = 1; }`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "Foo",
+					Fields: []Field{{
+						Label:  OptionalLabel,
+						Type:   Type{Predefined: TypeInt32},
+						Name:   "id",
+						Number: 1,
+					}},
+				}},
+			},
+		},
+		{name: "labels and defaults",
+			in: `syntax = "proto2";
+				message Foo {
+					required string name = 1;
+					optional int32 count = 2 [default = 10];
+					repeated bytes data = 3;
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "Foo",
+					Fields: []Field{{
+						Label:  RequiredLabel,
+						Type:   Type{Predefined: TypeString},
+						Name:   "name",
+						Number: 1,
+					}, {
+						Label:   OptionalLabel,
+						Type:    Type{Predefined: TypeInt32},
+						Name:    "count",
+						Number:  2,
+						Options: []Option{{Name: fullIdentifier("default"), Value: intNumber("10")}},
+					}, {
+						Label:  RepeatedLabel,
+						Type:   Type{Predefined: TypeBytes},
+						Name:   "data",
+						Number: 3,
+					}},
+				}},
+			},
+		},
+		{name: "groups",
+			in: `syntax = "proto2";
+				message Foo {
+					repeated group Result = 1 {
+						required string url = 2;
+					}
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "Foo",
+					Fields: []Field{{
+						Label:  RepeatedLabel,
+						Type:   Type{UserDefined: fullIdentifier("Result")},
+						Name:   "result",
+						Number: 1,
+						Group: &Message{
+							Name: "Result",
+							Fields: []Field{{
+								Label:  RequiredLabel,
+								Type:   Type{Predefined: TypeString},
+								Name:   "url",
+								Number: 2,
+							}},
+						},
+					}},
+				}},
+			},
+		},
+		{name: "groups in oneofs",
+			in: `syntax = "proto2";
+				message M {
+					oneof o {
+						group G = 1 { optional int32 a = 2; }
+					}
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "M",
+					OneOfs: []OneOf{{
+						Name: "o",
+						Fields: []OneOfField{{
+							Type:   Type{UserDefined: fullIdentifier("G")},
+							Name:   "g",
+							Number: 1,
+							Group: &Message{
+								Name: "G",
+								Fields: []Field{{
+									Label:  OptionalLabel,
+									Type:   Type{Predefined: TypeInt32},
+									Name:   "a",
+									Number: 2,
+								}},
+							},
+						}},
+					}},
+				}},
+			},
+		},
+		{name: "extension ranges",
+			in: `syntax = "proto2";
+				message Foo {
+					extensions 100 to 199, 1000 to max [verification = UNVERIFIED];
+					extensions 5;
+					reserved 20 to max;
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "Foo",
+					Extensions: []ExtensionRange{{
+						Ranges: []Range{{From: 100, To: 199}, {From: 1000, To: MaxFieldNumber}},
+						Options: []Option{{
+							Name:  fullIdentifier("verification"),
+							Value: fullIdentifier("UNVERIFIED"),
+						}},
+					}, {
+						Ranges: []Range{{From: 5, To: 5}},
+					}},
+					Reserveds: []Reserved{{
+						Ranges: []Range{{From: 20, To: MaxFieldNumber}},
+					}},
+				}},
+			},
+		},
+		{name: "missing label",
+			in:  `syntax = "proto2"; message Foo { int32 id = 1; }`,
+			err: errors.New(`1:34: expected 'required', 'optional', or 'repeated', got int32`),
+		},
+		{name: "lowercase group name",
+			in:  `message Foo { optional group result = 1 {} }`,
+			err: errors.New(`1:30: group names must start with a capital letter`),
+		},
+		{name: "optional in proto3",
+			in: `syntax = "proto3"; message Foo { optional int32 id = 1; string name = 2; }`,
+			out: &File{
+				Syntax: Syntax{Value: Proto3},
+				Messages: []Message{{
+					Name: "Foo",
+					Fields: []Field{{
+						Label:  OptionalLabel,
+						Type:   Type{Predefined: TypeInt32},
+						Name:   "id",
+						Number: 1,
+					}, {
+						Type:   Type{Predefined: TypeString},
+						Name:   "name",
+						Number: 2,
+					}},
+				}},
+			},
+		},
+		{name: "required in proto3",
+			in:  `syntax = "proto3"; message Foo { required int32 id = 1; }`,
+			err: errors.New(`1:34: required fields are not allowed in proto3`),
+		},
+		{name: "groups in proto3",
+			in:  `syntax = "proto3"; message Foo { group Bar = 1 {} }`,
+			err: errors.New(`1:34: groups are not allowed in proto3`),
+		},
+		{name: "extensions in proto3",
+			in:  `syntax = "proto3"; message Foo { extensions 1 to 10; }`,
+			err: errors.New(`1:34: extension ranges are not allowed in proto3`),
+		},
+		{name: "map in oneof",
+			in:  `syntax = "proto3"; message Foo { oneof o { map<string, int32> m = 1; } }`,
+			err: errors.New(`1:44: map fields are not allowed in oneofs`),
+		},
+		{name: "repeated map",
+			in:  `syntax = "proto3"; message Foo { repeated map<string, int32> m = 1; }`,
+			err: errors.New(`1:43: labels are not allowed on map fields`),
+		},
+		{name: "map of maps",
+			in:  `syntax = "proto3"; message Foo { map<string, map<string, int32>> m = 1; }`,
+			err: errors.New(`1:46: map values can't be maps`),
+		},
+		{name: "map extension",
+			in:  `syntax = "proto3"; extend Foo { map<string, int32> m = 1; }`,
+			err: errors.New(`1:33: map fields are not allowed in extend blocks`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.in))
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			checkResults(t, tt.out, f)
+		})
+	}
+}
+
+func TestParseEditions(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  *File
+		err  error
+	}{
+		{name: "edition 2023",
+			in: `edition = "2023";
+				option features.field_presence = IMPLICIT;
+				message Foo {
+					int32 id = 1 [features.field_presence = EXPLICIT];
+					repeated string tags = 2;
+				}`,
+			out: &File{
+				Syntax:  Syntax{Value: Editions},
+				Edition: Edition{Value: Edition2023},
+				Options: []Option{{
+					Name:  fullIdentifier("features", "field_presence"),
+					Value: fullIdentifier("IMPLICIT"),
+				}},
+				Messages: []Message{{
+					Name: "Foo",
+					Fields: []Field{{
+						Type:   Type{Predefined: TypeInt32},
+						Name:   "id",
+						Number: 1,
+						Options: []Option{{
+							Name:  fullIdentifier("features", "field_presence"),
+							Value: fullIdentifier("EXPLICIT"),
+						}},
+					}, {
+						Label:  RepeatedLabel,
+						Type:   Type{Predefined: TypeString},
+						Name:   "tags",
+						Number: 2,
+					}},
+				}},
+			},
+		},
+		{name: "unsupported edition",
+			in:  `edition = "2077";`,
+			err: errors.New(`1:11: unsupported edition 2077, expected 2023`),
+		},
+		{name: "required in editions",
+			in:  `edition = "2023"; message Foo { required int32 id = 1; }`,
+			err: errors.New(`1:33: required fields are not allowed in editions`),
+		},
+		{name: "optional in editions",
+			in:  `edition = "2023"; message Foo { optional int32 id = 1; }`,
+			err: errors.New(`1:33: optional fields are not allowed in editions`),
+		},
+		{name: "groups in editions",
+			in:  `edition = "2023"; message Foo { repeated group Bar = 1 {} }`,
+			err: errors.New(`1:42: groups are not allowed in editions`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.in))
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			checkResults(t, tt.out, f)
+		})
+	}
+}
+
+func TestParseExtend(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  *File
+		err  error
+	}{
+		{name: "custom options",
+			in: `syntax = "proto3";
+				extend .google.protobuf.FieldOptions {
+					string my_option = 51234;
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto3},
+				Extends: []Extend{{
+					Type: Type{
+						UserDefined:    fullIdentifier("google", "protobuf", "FieldOptions"),
+						FullyQualified: true,
+					},
+					Fields: []Field{{
+						Type:   Type{Predefined: TypeString},
+						Name:   "my_option",
+						Number: 51234,
+					}},
+				}},
+			},
+		},
+		{name: "nested extend",
+			in: `syntax = "proto2";
+				message Foo {
+					extensions 100 to max;
+					extend Foo {
+						optional int32 bar = 100;
+						repeated group Baz = 101 {};
+					}
+				}`,
+			out: &File{
+				Syntax: Syntax{Value: Proto2},
+				Messages: []Message{{
+					Name: "Foo",
+					Extensions: []ExtensionRange{{
+						Ranges: []Range{{From: 100, To: MaxFieldNumber}},
+					}},
+					Extends: []Extend{{
+						Type: Type{UserDefined: fullIdentifier("Foo")},
+						Fields: []Field{{
+							Label:  OptionalLabel,
+							Type:   Type{Predefined: TypeInt32},
+							Name:   "bar",
+							Number: 100,
+						}, {
+							Label:  RepeatedLabel,
+							Type:   Type{UserDefined: fullIdentifier("Baz")},
+							Name:   "baz",
+							Number: 101,
+							Group:  &Message{Name: "Baz"},
+						}},
+					}},
+				}},
+			},
+		},
+		{name: "extending a scalar",
+			in:  `extend int32 {}`,
+			err: errors.New(`1:8: expected message type, got int32`),
+		},
+		{name: "bad statement",
+			in:  `extend Foo { option deprecated = true; }`,
+			err: errors.New(`1:14: expected '}' to end extend definition, got option`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.in))
+			if !checkErrors(t, tt.err, err) {
+				return
+			}
+			checkResults(t, tt.out, f)
+		})
+	}
+}
+
 func TestParseService(t *testing.T) {
 	tests := []struct {
 		name string
@@ -575,6 +1350,20 @@ func TestParseService(t *testing.T) {
 						Name:  fullIdentifier("secured"),
 						Value: false,
 					}},
+					Body: true,
+				}},
+			},
+		},
+		{name: "fully qualified types", in: `
+				service SearchService {
+					rpc Search (.foo.SearchRequest) returns (stream .foo.SearchResponse);
+				}`,
+			out: Service{
+				Name: "SearchService",
+				RPCs: []RPC{{
+					Name: "Search",
+					In:   RPCParam{Type: fullIdentifier("foo", "SearchRequest"), FullyQualified: true},
+					Out:  RPCParam{Type: fullIdentifier("foo", "SearchResponse"), Stream: true, FullyQualified: true},
 				}},
 			},
 		},
@@ -583,8 +1372,8 @@ func TestParseService(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &peeker{s: scanner.New(strings.NewReader(tt.in))}
-			var svc Service
-			err := panicToErr(func() { svc = parseService(p) })
+			svc, e := parseService(p)
+			err := asError(e)
 			if !checkErrors(t, tt.err, err) {
 				return
 			}
@@ -593,6 +1382,188 @@ func TestParseService(t *testing.T) {
 	}
 }
 
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  *Error
+	}{
+		{name: "unexpected token",
+			in: "syntax = \"proto3\";\nmessage Foo {\n\tint32 id 1;\n}",
+			err: &Error{
+				Pos:      token.Position{Filename: "foo.proto", Offset: 43, Line: 3, Column: 11},
+				Category: UnexpectedToken,
+				Found:    make(token.DecimalLiteral, "1"),
+				Expected: []token.Kind{token.Equals},
+				Msg:      "expected '=', got decimal literal (1)",
+			},
+		},
+		{name: "illegal token",
+			in: "syntax = \"proto3\";\n#",
+			err: &Error{
+				Pos:      token.Position{Filename: "foo.proto", Offset: 19, Line: 2, Column: 1},
+				Category: IllegalToken,
+				Found:    make(token.Illegal, "#"),
+				Expected: topLevelKinds,
+				Msg:      "unexpected illegal (#) at top level definition",
+			},
+		},
+		{name: "bad syntax",
+			in: `syntax = "proto4";`,
+			err: &Error{
+				Pos:      token.Position{Filename: "foo.proto", Offset: 9, Line: 1, Column: 10},
+				Category: BadSyntax,
+				Found:    make(token.StringLiteral, `"proto4"`),
+				Msg:      "expected literal string proto2 or proto3, got proto4 instead",
+			},
+		},
+		{name: "duplicate package",
+			in: "syntax = \"proto3\";\npackage a;\npackage b;",
+			err: &Error{
+				Pos:      token.Position{Filename: "foo.proto", Offset: 30, Line: 3, Column: 1},
+				Category: Duplicate,
+				Found:    make(token.Package, ""),
+				Msg:      "found second package definition",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseFile("foo.proto", strings.NewReader(tt.in), 0)
+			list, ok := err.(ErrorList)
+			if !ok || len(list) != 1 {
+				t.Fatalf("expected a list with one error, got %v", err)
+			}
+			got := list[0]
+			got.Found.Pos, got.Found.End = token.Position{}, token.Position{}
+			if !reflect.DeepEqual(tt.err, got) {
+				t.Fatal(pretty.Diff(tt.err, got))
+			}
+			if want := tt.err.Pos.String() + ": " + tt.err.Msg; err.Error() != want {
+				t.Errorf("expected error message %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	in := `syntax = "proto3";
+
+package foo bar;
+
+message Foo {
+	int32 a = 1;
+	int32 b 2;
+	message Inner {
+		string c = ;
+		string d = 4;
+	}
+	int32 e = 5;
+	oneof f {
+		int32 g = 6
+	}
+}
+
+# illegal
+
+enum Bar {
+	A = 0;
+	B = "one";
+	C = 2;
+}
+
+service Search {
+	rpc Find (Foo) returns (Bar) {
+		option a = ;
+	}
+	rpc List (Foo) returns (stream Bar);
+}
+
+message Unclosed {
+	int32 h = 7;
+`
+	f, err := ParseFile("foo.proto", strings.NewReader(in), Recover)
+	var got []string
+	for _, e := range err.(ErrorList) {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`foo.proto:3:13: expected ';', got identifier (bar)`,
+		`foo.proto:7:10: expected '=', got decimal literal (2)`,
+		`foo.proto:9:14: expected integer, got ';'`,
+		`foo.proto:15:2: expected ';', got '}'`,
+		`foo.proto:18:1: unexpected illegal (#) at top level definition`,
+		`foo.proto:22:6: expected integer, got string literal ("one")`,
+		`foo.proto:28:14: expected a valid constant value, but got ';'`,
+		`foo.proto:35:1: expected '}' to end message definition, got end of file`,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	var names []string
+	var walk func(prefix string, msgs []Message)
+	walk = func(prefix string, msgs []Message) {
+		for _, m := range msgs {
+			for _, f := range m.Fields {
+				names = append(names, prefix+string(m.Name)+"."+string(f.Name))
+			}
+			for _, o := range m.OneOfs {
+				names = append(names, prefix+string(m.Name)+"."+string(o.Name))
+			}
+			walk(prefix+string(m.Name)+".", m.Messages)
+		}
+	}
+	walk("", f.Messages)
+	for _, e := range f.Enums {
+		for _, v := range e.Fields {
+			names = append(names, string(e.Name)+"."+string(v.Name))
+		}
+	}
+	for _, s := range f.Services {
+		for _, rpc := range s.RPCs {
+			names = append(names, string(s.Name)+"."+string(rpc.Name))
+		}
+	}
+	wantNames := []string{
+		"Foo.a", "Foo.e", "Foo.f", "Foo.Inner.d", "Unclosed.h",
+		"Bar.A", "Bar.C", "Search.Find", "Search.List",
+	}
+	if !reflect.DeepEqual(wantNames, names) {
+		t.Fatalf("expected definitions %v, got %v", wantNames, names)
+	}
+}
+
+func TestRecoverAliases(t *testing.T) {
+	in := `syntax = "proto3";
+
+enum Bar {
+	A = 0;
+	B = "one";
+	C = 0;
+}
+
+message Foo { int32 a 1; }
+`
+	f, err := ParseFile("foo.proto", strings.NewReader(in), Recover)
+	var got []string
+	for _, e := range err.(ErrorList) {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`foo.proto:5:6: expected integer, got string literal ("one")`,
+		`foo.proto:6:2: C uses the same number 0 as A, set option allow_alias = true to allow aliases`,
+		`foo.proto:9:23: expected '=', got decimal literal (1)`,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected errors:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	if len(f.Enums) != 1 || len(f.Enums[0].Fields) != 2 || len(f.Messages) != 1 {
+		t.Fatalf("expected enum Bar with values A and C, and message Foo, got %v", print(f))
+	}
+}
+
 func checkErrors(t *testing.T, want, got error) bool {
 	switch {
 	case want == nil && got == nil:
@@ -608,6 +1579,7 @@ func checkErrors(t *testing.T, want, got error) bool {
 }
 
 func checkResults(t *testing.T, want, got interface{}) {
+	got = withoutSpans(got)
 	if !reflect.DeepEqual(want, got) {
 		diff := pretty.Diff(want, got)
 		log.Printf("expected: %s", print(want))
@@ -616,14 +1588,52 @@ func checkResults(t *testing.T, want, got interface{}) {
 	}
 }
 
-func panicToErr(f func()) (err error) {
-	defer func() {
-		if rec := recover(); rec != nil {
-			err = fmt.Errorf("%v", rec)
+// withoutSpans returns a copy of v where all the spans have been zeroed,
+// so results can be compared without listing every position.
+// Slices and pointers in v are shared with the copy.
+func withoutSpans(v interface{}) interface{} {
+	rv := reflect.New(reflect.TypeOf(v)).Elem()
+	rv.Set(reflect.ValueOf(v))
+	zeroSpans(rv)
+	return rv.Interface()
+}
+
+var spanType = reflect.TypeOf(Span{})
+
+func zeroSpans(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			zeroSpans(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			zeroSpans(v.Index(i))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			zeroSpans(elem)
+			v.Set(elem)
 		}
-	}()
-	f()
-	return nil
+	case reflect.Struct:
+		if v.Type() == spanType {
+			v.Set(reflect.Zero(spanType))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			zeroSpans(v.Field(i))
+		}
+	}
+}
+
+// asError returns the given error as an error value, or nil if it is nil.
+func asError(e *Error) error {
+	if e == nil {
+		return nil
+	}
+	return e
 }
 
 func print(v interface{}) string {
@@ -0,0 +1,752 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package printer renders the definitions in a proto.File as .proto source.
+//
+// The output is canonical: it is indented with two spaces, has a single
+// space between tokens, and depends only on the given File, so printing a
+// file that was parsed from the output of the printer gives the same output.
+// Parsing the output gives back the same definitions and comments.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/campoy/groto/proto"
+	"github.com/campoy/groto/token"
+)
+
+// Fprint writes the source of the given file to w.
+//
+// Declarations are written in the order they appear in the file they were
+// parsed from, with a blank line between them where there was at least one.
+// Declarations with invalid spans, such as the ones built by a program, are
+// written first, grouped by kind, with the fields of each message sorted by
+// number.
+func Fprint(w io.Writer, f *proto.File) error {
+	p := &printer{}
+	p.file(f)
+	if p.err != nil {
+		return p.err
+	}
+	_, err := w.Write(p.buf.Bytes())
+	return err
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	err    error
+
+	// blank is set when the next declaration must be preceded by a blank
+	// line, so the comments printed before it are not attached to it.
+	blank bool
+}
+
+func (p *printer) print(args ...interface{}) {
+	for _, arg := range args {
+		fmt.Fprint(&p.buf, arg)
+	}
+}
+
+// newline ends the current line, and indents the next one.
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	p.buf.WriteString(strings.Repeat("  ", p.indent))
+}
+
+// An item is a declaration in a file or in the body of a block, which is
+// printed by the print function, starting with the current indentation.
+type item struct {
+	span     proto.Span
+	comments proto.Comments
+	kind     kind
+	print    func()
+}
+
+// A kind groups the declarations which are not separated by blank lines
+// when their position is not known. Blocks are always separated.
+type kind int
+
+const (
+	syntaxKind kind = iota
+	packageKind
+	importKind
+	optionKind
+	fieldKind
+	rangeKind
+	blockKind
+)
+
+// items prints the given declarations, sorted by position, starting a new
+// line before each of them. Their comments are printed too: the detached
+// and leading comments right before them, and the trailing comment by
+// print, which should call end or block.
+//
+// The syntax statement always goes first. Declarations without a position
+// go right after the positioned ones of the same or an earlier kind, in the
+// order they are given.
+func (p *printer) items(items []item) {
+	keys := make([]token.Position, len(items))
+	for i, it := range items {
+		keys[i] = it.span.Pos
+		if it.span.Pos.IsValid() {
+			continue
+		}
+		for _, prev := range items {
+			if prev.span.Pos.IsValid() && prev.kind <= it.kind && before(keys[i], prev.span.Pos) {
+				keys[i] = prev.span.Pos
+			}
+		}
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := items[order[i]], items[order[j]]
+		if (a.kind == syntaxKind) != (b.kind == syntaxKind) {
+			return a.kind == syntaxKind
+		}
+		ka, kb := keys[order[i]], keys[order[j]]
+		if before(ka, kb) || before(kb, ka) {
+			return before(ka, kb)
+		}
+		return a.span.Pos.IsValid() && !b.span.Pos.IsValid()
+	})
+	sorted := make([]item, len(items))
+	for i, k := range order {
+		sorted[i] = items[k]
+	}
+	items = sorted
+
+	for i, it := range items {
+		blank := p.blank || len(it.comments.LeadingDetachedComments) > 0
+		if i > 0 {
+			blank = blank || separated(items[i-1], it)
+		}
+		if blank && p.buf.Len() > 0 {
+			p.buf.WriteByte('\n')
+		}
+		p.blank = false
+		if p.buf.Len() > 0 {
+			p.newline()
+		} else {
+			p.buf.WriteString(strings.Repeat("  ", p.indent))
+		}
+		for _, c := range it.comments.LeadingDetachedComments {
+			p.comment(c)
+			p.buf.WriteByte('\n')
+			p.newline()
+		}
+		if c := it.comments.LeadingComments; c != "" {
+			p.comment(c)
+			p.newline()
+		}
+		it.print()
+	}
+}
+
+// before returns true if the position a is before b.
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// separated returns true if there must be a blank line between the given
+// declarations. If their positions are known, it is the case if there was
+// at least one between them, not counting the leading comments of next.
+func separated(prev, next item) bool {
+	if prev.span.End.IsValid() && next.span.Pos.IsValid() {
+		return next.span.Pos.Line-lines(next.comments.LeadingComments) > prev.span.End.Line+1
+	}
+	return prev.kind != next.kind || prev.kind == blockKind
+}
+
+// lines returns the number of lines used by a printed comment.
+func lines(c string) int {
+	if c == "" {
+		return 0
+	}
+	if isLineComment(c) {
+		return strings.Count(c, "\n")
+	}
+	return strings.Count(c, "\n") + 1
+}
+
+// isLineComment returns true if the given text is printed as line comments,
+// which is the case for texts ending with a newline, unless they also
+// start with one, as block comments documenting definitions often do.
+func isLineComment(c string) bool {
+	return strings.HasSuffix(c, "\n") && !strings.HasPrefix(c, "\n")
+}
+
+// comment prints the text of a comment, without a newline at the end.
+// The parser gives the same text for the printed comment.
+func (p *printer) comment(c string) {
+	if isLineComment(c) {
+		for i, line := range strings.Split(strings.TrimSuffix(c, "\n"), "\n") {
+			if i > 0 {
+				p.newline()
+			}
+			p.print("//", line)
+		}
+		return
+	}
+	// Leading asterisks are removed from the lines of block comments, so
+	// they can be used to align them.
+	lines := strings.Split(c, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			p.print("/*", line)
+		case i == len(lines)-1 && line == "":
+			p.newline()
+			p.print(" */")
+			return
+		default:
+			p.newline()
+			p.print(" *", line)
+		}
+	}
+	p.print("*/")
+}
+
+// trailing prints the trailing comment of a declaration, once its last token
+// has been printed. Only one comment can follow a declaration in the same
+// line, so longer ones are printed in the next lines, followed by a blank line.
+func (p *printer) trailing(c proto.Comments) {
+	switch t := c.TrailingComment; {
+	case t == "":
+	case isLineComment(t) && strings.Count(t, "\n") > 1:
+		p.newline()
+		p.comment(t)
+		p.blank = true
+	default:
+		p.print(" ")
+		p.comment(t)
+	}
+}
+
+// end ends a statement with a semicolon, followed by its trailing comment.
+func (p *printer) end(c proto.Comments) {
+	p.print(";")
+	p.trailing(c)
+}
+
+// block prints a block containing the given declarations, and the
+// trailing comment of the declaration owning it after the opening brace.
+func (p *printer) block(c proto.Comments, items []item) {
+	if len(items) == 0 && c.TrailingComment == "" {
+		p.print(" {}")
+		return
+	}
+	p.print(" {")
+	p.indent++
+	p.trailing(c)
+	p.items(items)
+	p.indent--
+	p.blank = false
+	p.newline()
+	p.print("}")
+}
+
+func (p *printer) file(f *proto.File) {
+	var items []item
+	switch {
+	case f.Syntax.Value == proto.Editions:
+		e := f.Edition
+		items = append(items, item{e.Span, e.Comments, syntaxKind, func() {
+			p.print("edition = ", quote(e.Value))
+			p.end(e.Comments)
+		}})
+	case f.Syntax.Value == proto.Proto2 && !f.Syntax.Pos.IsValid() && f.Pos.IsValid():
+		// The file was parsed from a file without a syntax statement.
+	default:
+		s := f.Syntax
+		if s.Value == "" {
+			s.Value = proto.Proto2
+		}
+		items = append(items, item{s.Span, s.Comments, syntaxKind, func() {
+			p.print("syntax = ", quote(s.Value))
+			p.end(s.Comments)
+		}})
+	}
+	if pkg := f.Package; len(pkg.Identifier) > 0 {
+		items = append(items, item{pkg.Span, pkg.Comments, packageKind, func() {
+			p.print("package ", join(pkg.Identifier))
+			p.end(pkg.Comments)
+		}})
+	}
+	for _, imp := range f.Imports {
+		imp := imp
+		items = append(items, item{imp.Span, imp.Comments, importKind, func() {
+			p.print("import ")
+			switch imp.Modifier {
+			case proto.WeakImport:
+				p.print("weak ")
+			case proto.PublicImport:
+				p.print("public ")
+			}
+			p.print(quote(imp.Path))
+			p.end(imp.Comments)
+		}})
+	}
+	items = append(items, p.options(f.Options)...)
+	items = append(items, p.definitions(f.Messages, f.Enums, f.Extends)...)
+	for _, s := range f.Services {
+		items = append(items, p.service(s))
+	}
+	p.items(items)
+	if p.buf.Len() > 0 {
+		p.buf.WriteByte('\n')
+	}
+}
+
+// options returns the option statements of a file or a block.
+func (p *printer) options(opts []proto.Option) []item {
+	var items []item
+	for _, opt := range opts {
+		opt := opt
+		items = append(items, item{opt.Span, opt.Comments, optionKind, func() {
+			p.print("option ")
+			p.option(opt, false)
+			p.end(opt.Comments)
+		}})
+	}
+	return items
+}
+
+// option prints the name and value of an option. Aggregates are printed
+// in a single line if inline is true.
+func (p *printer) option(opt proto.Option, inline bool) {
+	if opt.Prefix != nil {
+		p.print("(", join(opt.Prefix), ")")
+		if opt.Name != nil {
+			p.print(".")
+		}
+	}
+	p.print(join(opt.Name), " = ")
+	p.value(opt.Value, inline)
+}
+
+// fieldOptions prints the options of a field, if any, in brackets.
+func (p *printer) fieldOptions(opts []proto.Option) {
+	if len(opts) == 0 {
+		return
+	}
+	p.print(" [")
+	for i, opt := range opts {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.option(opt, true)
+	}
+	p.print("]")
+}
+
+// value prints the value of an option or of a field in an aggregate.
+func (p *printer) value(v interface{}, inline bool) {
+	switch v := v.(type) {
+	case string:
+		p.print(quote(v))
+	case bool:
+		p.print(v)
+	case proto.Number:
+		p.print(number(v))
+	case []proto.Identifier:
+		p.print(join(v))
+	case proto.Aggregate:
+		p.aggregate(v, inline)
+	case proto.List:
+		p.print("[")
+		for i, v := range v.Values {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.value(v, true)
+		}
+		p.print("]")
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("unsupported value %v of type %T", v, v)
+		}
+	}
+}
+
+// aggregate prints an aggregate value in the text format, with one field
+// per line unless inline is true.
+func (p *printer) aggregate(agg proto.Aggregate, inline bool) {
+	if len(agg.Fields) == 0 {
+		p.print("{}")
+		return
+	}
+	p.print("{")
+	p.indent++
+	for i, f := range agg.Fields {
+		switch {
+		case !inline:
+			p.newline()
+		case i > 0:
+			p.print(" ")
+		}
+		if f.Extension {
+			p.print("[")
+			if f.TypeURL != "" {
+				p.print(f.TypeURL, "/")
+			}
+			p.print(join(f.Name), "]")
+		} else {
+			p.print(join(f.Name))
+		}
+		// Messages, and lists of messages, don't need a colon.
+		if isMessage(f.Value) {
+			p.print(" ")
+		} else {
+			p.print(": ")
+		}
+		p.value(f.Value, inline)
+	}
+	p.indent--
+	if !inline {
+		p.newline()
+	}
+	p.print("}")
+}
+
+func isMessage(v interface{}) bool {
+	switch v := v.(type) {
+	case proto.Aggregate:
+		return true
+	case proto.List:
+		for _, v := range v.Values {
+			if _, ok := v.(proto.Aggregate); !ok {
+				return false
+			}
+		}
+		return len(v.Values) > 0
+	}
+	return false
+}
+
+// definitions returns the messages, enums and extend blocks defined in a
+// file or in a message.
+func (p *printer) definitions(msgs []proto.Message, enums []proto.Enum, extends []proto.Extend) []item {
+	var items []item
+	for _, m := range msgs {
+		m := m
+		items = append(items, item{m.Span, m.Comments, blockKind, func() {
+			p.print("message ", m.Name)
+			p.block(m.Comments, p.message(m))
+		}})
+	}
+	for _, e := range enums {
+		items = append(items, p.enum(e))
+	}
+	for _, ext := range extends {
+		ext := ext
+		items = append(items, item{ext.Span, ext.Comments, blockKind, func() {
+			p.print("extend ", typeName(ext.Type))
+			var fields []item
+			for _, f := range ext.Fields {
+				fields = append(fields, p.field(f))
+			}
+			p.block(ext.Comments, fields)
+		}})
+	}
+	return items
+}
+
+// message returns the declarations in the body of a message.
+func (p *printer) message(m proto.Message) []item {
+	items := p.options(m.Options)
+
+	// Fields, maps and oneofs are sorted by number.
+	type numbered struct {
+		number int
+		item   item
+	}
+	var fields []numbered
+	for _, f := range m.Fields {
+		fields = append(fields, numbered{f.Number, p.field(f)})
+	}
+	for _, f := range m.Maps {
+		f := f
+		fields = append(fields, numbered{f.Number, item{f.Span, f.Comments, fieldKind, func() {
+			p.print("map<", typeName(f.KeyType), ", ", typeName(f.ValueType), "> ", f.Name, " = ", f.Number)
+			p.fieldOptions(f.Options)
+			p.end(f.Comments)
+		}}})
+	}
+	for _, o := range m.OneOfs {
+		o := o
+		n := math.MaxInt32
+		for _, f := range o.Fields {
+			if f.Number < n {
+				n = f.Number
+			}
+		}
+		fields = append(fields, numbered{n, item{o.Span, o.Comments, blockKind, func() {
+			p.print("oneof ", o.Name)
+			var items []item
+			for _, f := range o.Fields {
+				items = append(items, p.field(proto.Field{
+					Span:     f.Span,
+					Comments: f.Comments,
+					Type:     f.Type,
+					Name:     f.Name,
+					Number:   f.Number,
+					Options:  f.Options,
+					Group:    f.Group,
+				}))
+			}
+			p.block(o.Comments, items)
+		}}})
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].number < fields[j].number })
+	for _, f := range fields {
+		items = append(items, f.item)
+	}
+
+	for _, r := range m.Extensions {
+		r := r
+		items = append(items, item{r.Span, r.Comments, rangeKind, func() {
+			p.print("extensions ")
+			for i, rng := range r.Ranges {
+				if i > 0 {
+					p.print(", ")
+				}
+				p.print(rng.From)
+				if rng.To != rng.From {
+					p.print(" to ", rangeEnd(rng.To, proto.MaxFieldNumber))
+				}
+			}
+			p.fieldOptions(r.Options)
+			p.end(r.Comments)
+		}})
+	}
+	items = append(items, p.reserved(m.Reserveds, proto.MaxFieldNumber)...)
+	return append(items, p.definitions(m.Messages, m.Enums, m.Extends)...)
+}
+
+// field returns a field, or a group, of a message, a oneof or an extend block.
+func (p *printer) field(f proto.Field) item {
+	if f.Group != nil {
+		g := f.Group
+		return item{f.Span, g.Comments, blockKind, func() {
+			p.print(label(f.Label), "group ", g.Name, " = ", f.Number)
+			p.fieldOptions(f.Options)
+			p.block(g.Comments, p.message(*g))
+		}}
+	}
+	return item{f.Span, f.Comments, fieldKind, func() {
+		p.print(label(f.Label), typeName(f.Type), " ", f.Name, " = ", f.Number)
+		p.fieldOptions(f.Options)
+		p.end(f.Comments)
+	}}
+}
+
+func label(l proto.Label) string {
+	switch l {
+	case proto.OptionalLabel:
+		return "optional "
+	case proto.RequiredLabel:
+		return "required "
+	case proto.RepeatedLabel:
+		return "repeated "
+	default:
+		return ""
+	}
+}
+
+// reserved returns the reserved statements of a message or an enum, whose
+// ranges end in max at the given number.
+func (p *printer) reserved(rs []proto.Reserved, max int) []item {
+	var items []item
+	for _, r := range rs {
+		r := r
+		items = append(items, item{r.Span, r.Comments, rangeKind, func() {
+			p.print("reserved ")
+			var values []string
+			for _, rng := range r.Ranges {
+				if rng.From == rng.To {
+					values = append(values, strconv.Itoa(rng.From))
+				} else {
+					values = append(values, fmt.Sprintf("%d to %s", rng.From, rangeEnd(rng.To, max)))
+				}
+			}
+			for _, name := range r.Names {
+				values = append(values, quote(name))
+			}
+			p.print(strings.Join(values, ", "))
+			p.end(r.Comments)
+		}})
+	}
+	return items
+}
+
+func rangeEnd(to, max int) string {
+	if to == max {
+		return "max"
+	}
+	return strconv.Itoa(to)
+}
+
+func (p *printer) enum(e proto.Enum) item {
+	return item{e.Span, e.Comments, blockKind, func() {
+		p.print("enum ", e.Name)
+		items := p.options(e.Options)
+		for _, f := range e.Fields {
+			f := f
+			items = append(items, item{f.Span, f.Comments, fieldKind, func() {
+				p.print(f.Name, " = ", f.Number)
+				p.fieldOptions(f.Options)
+				p.end(f.Comments)
+			}})
+		}
+		items = append(items, p.reserved(e.Reserveds, proto.MaxEnumNumber)...)
+		p.block(e.Comments, items)
+	}}
+}
+
+func (p *printer) service(s proto.Service) item {
+	return item{s.Span, s.Comments, blockKind, func() {
+		p.print("service ", s.Name)
+		items := p.options(s.Options)
+		for _, rpc := range s.RPCs {
+			rpc := rpc
+			k := fieldKind
+			if len(rpc.Options) > 0 {
+				k = blockKind
+			}
+			items = append(items, item{rpc.Span, rpc.Comments, k, func() {
+				p.print("rpc ", rpc.Name, param(rpc.In), " returns ", param(rpc.Out))
+				if len(rpc.Options) == 0 && !rpc.Body {
+					p.end(rpc.Comments)
+					return
+				}
+				p.block(rpc.Comments, p.options(rpc.Options))
+			}})
+		}
+		p.block(s.Comments, items)
+	}}
+}
+
+func param(rp proto.RPCParam) string {
+	typ := join(rp.Type)
+	if rp.FullyQualified {
+		typ = "." + typ
+	}
+	if rp.Stream {
+		return "(stream " + typ + ")"
+	}
+	return "(" + typ + ")"
+}
+
+func typeName(t proto.Type) string {
+	if t.Predefined != proto.TypeInvalid {
+		return typeNames[t.Predefined]
+	}
+	if t.FullyQualified {
+		return "." + join(t.UserDefined)
+	}
+	return join(t.UserDefined)
+}
+
+var typeNames = map[proto.PredefinedType]string{
+	proto.TypeBytes:    "bytes",
+	proto.TypeDouble:   "double",
+	proto.TypeFloat:    "float",
+	proto.TypeBool:     "bool",
+	proto.TypeFixed32:  "fixed32",
+	proto.TypeFixed64:  "fixed64",
+	proto.TypeInt32:    "int32",
+	proto.TypeInt64:    "int64",
+	proto.TypeSfixed32: "sfixed32",
+	proto.TypeSfixed64: "sfixed64",
+	proto.TypeSint32:   "sint32",
+	proto.TypeSint64:   "sint64",
+	proto.TypeString:   "string",
+	proto.TypeUint32:   "uint32",
+	proto.TypeUint64:   "uint64",
+}
+
+func join(ids []proto.Identifier) string {
+	var s []string
+	for _, id := range ids {
+		s = append(s, string(id))
+	}
+	return strings.Join(s, ".")
+}
+
+// number returns the literal of a number as it was written or, for numbers
+// built by a program, the shortest literal of the same kind and value.
+func number(n proto.Number) string {
+	if n.Text != "" {
+		return n.Text
+	}
+	switch n.Kind {
+	case proto.IntNumber:
+		return strconv.FormatInt(n.Int, 10)
+	case proto.UintNumber:
+		return strconv.FormatUint(n.Uint, 10)
+	case proto.InfNumber:
+		if n.Float < 0 {
+			return "-inf"
+		}
+		return "inf"
+	case proto.NaNNumber:
+		return "nan"
+	default:
+		s := strconv.FormatFloat(n.Float, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			// Make sure the literal is parsed as a float.
+			s += ".0"
+		}
+		return s
+	}
+}
+
+// quote returns a string literal with the given value. Bytes that are not
+// part of valid UTF-8 sequences, and control characters, are escaped.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == utf8.RuneError && size == 1, r < 0x20, r == 0x7f:
+			fmt.Fprintf(&b, `\%03o`, s[i])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
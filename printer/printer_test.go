@@ -0,0 +1,493 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package printer
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kr/pretty"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"github.com/campoy/groto/desc"
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+)
+
+func parse(t *testing.T, in string) *proto.File {
+	t.Helper()
+	f, err := parser.Parse(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("could not parse: %v\n%s", err, in)
+	}
+	return f
+}
+
+func fprint(t *testing.T, f *proto.File) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := Fprint(&buf, f); err != nil {
+		t.Fatalf("could not print: %v", err)
+	}
+	return buf.String()
+}
+
+// trim removes the indentation of a test case, which is the one of its
+// first line, and its first line break.
+func trim(s string) string {
+	s = strings.TrimPrefix(s, "\n")
+	indent := s[:len(s)-len(strings.TrimLeft(s, "\t"))]
+	return strings.ReplaceAll(strings.TrimPrefix(s, indent), "\n"+indent, "\n")
+}
+
+func TestFprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		in, out string
+	}{
+		{"empty file", ``, ``},
+		{"no syntax", `message  Foo{}`, "message Foo {}\n"},
+		{"reserved order", `message Foo{reserved 5 to 7,3,1;}enum E{A=0;reserved 5 to 7,-3;}`, `
+			message Foo {
+			  reserved 5 to 7, 3, 1;
+			}
+			enum E {
+			  A = 0;
+			  reserved 5 to 7, -3;
+			}
+			`},
+		{"empty method body", `service S{rpc Get(A)returns(B);rpc Put(A)returns(B){}}`, `
+			service S {
+			  rpc Get(A) returns (B);
+			  rpc Put(A) returns (B) {}
+			}
+			`},
+		{"spacing and indentation", `
+			syntax="proto3";package foo . bar;
+			import public"a.proto";import weak 'b.proto';
+			option(foo).bar={a:1,b:[1,2]c<d:"x">};
+			message Foo{option deprecated=true;
+			repeated .foo.bar.Foo foo=1[deprecated=true,json_name="f"];map<string,Foo>m=2;
+			oneof x{string a=3;}
+			reserved 4,5 to 9,20 to max;reserved"a","b";
+			enum E{A=0;B=-1[deprecated=true];reserved -5 to -3;}}
+			service S{rpc Get(Foo)returns(stream Foo);rpc Put(Foo)returns(Foo){option idempotency_level=IDEMPOTENT;}}`, `
+			syntax = "proto3";
+			package foo.bar;
+			import public "a.proto";
+			import weak "b.proto";
+			option (foo).bar = {
+			  a: 1
+			  b: [1, 2]
+			  c {
+			    d: "x"
+			  }
+			};
+			message Foo {
+			  option deprecated = true;
+			  repeated .foo.bar.Foo foo = 1 [deprecated = true, json_name = "f"];
+			  map<string, Foo> m = 2;
+			  oneof x {
+			    string a = 3;
+			  }
+			  reserved 4, 5 to 9, 20 to max;
+			  reserved "a", "b";
+			  enum E {
+			    A = 0;
+			    B = -1 [deprecated = true];
+			    reserved -5 to -3;
+			  }
+			}
+			service S {
+			  rpc Get(Foo) returns (stream Foo);
+			  rpc Put(Foo) returns (Foo) {
+			    option idempotency_level = IDEMPOTENT;
+			  }
+			}
+			`,
+		},
+		{"blank lines", `
+
+			syntax = "proto2";
+
+
+			message Foo {
+
+			  optional int32 a = 1;
+
+
+			  optional int32 b = 2;
+			  // c.
+			  optional int32 c = 3;
+
+			}
+			`, `
+			syntax = "proto2";
+
+			message Foo {
+			  optional int32 a = 1;
+
+			  optional int32 b = 2;
+			  // c.
+			  optional int32 c = 3;
+			}
+			`,
+		},
+		{"comments", `
+			// Detached.
+
+			/* Leading. */
+			syntax = "proto3";   // Trailing.
+
+			message Foo { // Foo.
+			  // A.
+			  int32 a = 1;
+			  // More about a.
+			  // And more.
+
+			  /*
+			   * Block.
+			   */
+			  int32 b = 2;
+			}
+			`, `
+			// Detached.
+
+			/* Leading. */
+			syntax = "proto3"; // Trailing.
+
+			message Foo { // Foo.
+			  // A.
+			  int32 a = 1;
+			  // More about a.
+			  // And more.
+
+			  /*
+			   * Block.
+			   */
+			  int32 b = 2;
+			}
+			`,
+		},
+		{"proto2", `
+			syntax = "proto2";
+			message Foo {
+				optional string s = 1 [default = "a\tb\001\"'\\\xff"];
+				required group Result = 2 [deprecated = true] { optional float f = 1 [default = -inf]; }
+				extensions 100 to 199, 300 [verification = UNVERIFIED];
+				extend Foo { repeated uint64 u = 101 [packed = true]; }
+			}`, `
+			syntax = "proto2";
+			message Foo {
+			  optional string s = 1 [default = "a\tb\001\"'\\\377"];
+			  required group Result = 2 [deprecated = true] {
+			    optional float f = 1 [default = -inf];
+			  }
+			  extensions 100 to 199, 300 [verification = UNVERIFIED];
+			  extend Foo {
+			    repeated uint64 u = 101 [packed = true];
+			  }
+			}
+			`,
+		},
+		{"editions", `edition = "2023"; option features.field_presence = IMPLICIT;`, `
+			edition = "2023";
+			option features.field_presence = IMPLICIT;
+			`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := trim(tt.out)
+			got := fprint(t, parse(t, tt.in))
+			if got != want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", want, got)
+			}
+			if again := fprint(t, parse(t, got)); again != got {
+				t.Errorf("printing the output again gave:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := `// Copyright.
+
+// Package foo.
+syntax = "proto2"; // Proto2.
+
+package foo.bar;
+
+import "google/protobuf/descriptor.proto";
+import public "other.proto"; // Public.
+
+option java_package = "com.foo";
+option (foo.bar.opt) = { a: 1 [foo.ext]: "x" [type.googleapis.com/foo.Any] { b: true } l: [1.5, -inf] m [{ k: E }, < k: F >] };
+
+extend google.protobuf.FileOptions {
+  optional Agg opt = 50000;
+}
+
+/* Agg
+ * is an aggregate.
+ */
+message Agg {
+  option (foo.bar.msg).x = 0x1F;
+
+  required int32 a = 1 [default = -017];
+  repeated string s = 2 [json_name = "ss", (foo.bar.field) = 18446744073709551615];
+  optional Agg child = 3;
+  map<sint64, .foo.bar.Agg> m = 4;
+  optional group G = 5 {
+    optional bytes b = 1 [default = "\x00\n"];
+  } // G.
+
+  oneof choice {
+    // In choice.
+    string x = 6;
+    Agg y = 7 [lazy = true];
+    // In choice too.
+    group Z = 11 {
+      optional int32 z = 1;
+    }
+  }
+
+  extensions 100, 200 to max;
+  reserved 8, 9 to 10;
+  reserved "old";
+
+  message Nested {
+    enum Kind {
+      option allow_alias = true;
+      A = 0;
+      B = 0;
+      reserved 10 to max;
+    }
+  }
+  enum E { E_UNSPECIFIED = 0; }
+  extend Agg {
+    optional int32 ext = 100;
+  }
+}
+
+service Svc {
+  option deprecated = true;
+  // Get.
+  rpc Get(stream foo.bar.Agg) returns (.foo.bar.Agg);
+}
+`
+	want := parse(t, in)
+	out := fprint(t, want)
+	got := parse(t, out)
+	zeroSpans(reflect.ValueOf(want))
+	zeroSpans(reflect.ValueOf(got))
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("parsing the output gave a different file:\n%s\n%v", out, pretty.Diff(want, got))
+	}
+}
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"editions", `edition = "2023";
+
+package foo;
+
+// Implicit.
+option features.field_presence = IMPLICIT;
+
+message M {
+  int32 a = 1 [features.field_presence = EXPLICIT];
+}
+`},
+		{"custom options", `syntax = "proto3";
+
+import "google/protobuf/descriptor.proto";
+
+message R {
+  string get = 1;
+  int32 n = 2;
+}
+
+extend google.protobuf.FileOptions {
+  R r = 50001;
+}
+
+option (r).get = "x";
+option (r).n = 1;
+option java_package = "foo";
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parser.ParseFile("test.proto", strings.NewReader(tt.in), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd, err := desc.ToDescriptor(f, desc.Options{Source: []byte(tt.in)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := desc.FromDescriptor(fd)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out := fprint(t, back)
+			again, err := parser.ParseFile("test.proto", strings.NewReader(out), 0)
+			if err != nil {
+				t.Fatalf("could not parse the output: %v\n%s", err, out)
+			}
+			got, err := desc.ToDescriptor(again, desc.Options{})
+			if err != nil {
+				t.Fatalf("could not convert the output: %v\n%s", err, out)
+			}
+			fd.SourceCodeInfo = nil
+			if !protobuf.Equal(fd, got) {
+				t.Errorf("the output gave a different descriptor:\n%s\nwant %v\ngot %v", out, fd, got)
+			}
+		})
+	}
+}
+
+func TestFprintSomePositions(t *testing.T) {
+	f := parse(t, `
+		syntax = "proto3";
+		package foo;
+		import "a.proto";
+		message Foo {
+			int32 a = 1;
+			message Bar {}
+		}`)
+	f.Options = append(f.Options, proto.Option{Name: []proto.Identifier{"java_package"}, Value: "foo"})
+	f.Messages[0].Fields = append(f.Messages[0].Fields, proto.Field{Type: proto.Type{Predefined: proto.TypeString}, Name: "b", Number: 2})
+	want := trim(`
+		syntax = "proto3";
+		package foo;
+		import "a.proto";
+
+		option java_package = "foo";
+
+		message Foo {
+		  int32 a = 1;
+		  string b = 2;
+
+		  message Bar {}
+		}
+		`)
+	if got := fprint(t, f); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFprintWithoutPositions(t *testing.T) {
+	f := parse(t, `
+		syntax = "proto3";
+		message Foo {
+			map<string, int32> m = 3;
+			message Bar {}
+			string b = 2;
+			option deprecated = true;
+			oneof x { int32 a = 1; }
+			reserved 10;
+		}
+		import "a.proto";
+		package foo;`)
+	zeroSpans(reflect.ValueOf(f))
+	want := trim(`
+		syntax = "proto3";
+
+		package foo;
+
+		import "a.proto";
+
+		message Foo {
+		  option deprecated = true;
+
+		  oneof x {
+		    int32 a = 1;
+		  }
+
+		  string b = 2;
+		  map<string, int32> m = 3;
+
+		  reserved 10;
+
+		  message Bar {}
+		}
+		`)
+	if got := fprint(t, f); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestFprintValues(t *testing.T) {
+	f := &proto.File{Options: []proto.Option{
+		{Name: []proto.Identifier{"a"}, Value: proto.Number{Kind: proto.FloatNumber, Float: 1}},
+		{Name: []proto.Identifier{"b"}, Value: proto.Number{Kind: proto.UintNumber, Uint: 1 << 63}},
+		{Name: []proto.Identifier{"c"}, Value: proto.Number{Kind: proto.InfNumber, Float: -1}},
+		{Name: []proto.Identifier{"d"}, Value: "\x7fé"},
+	}}
+	want := trim(`
+		syntax = "proto2";
+
+		option a = 1.0;
+		option b = 9223372036854775808;
+		option c = -inf;
+		option d = "\177é";
+		`)
+	if got := fprint(t, f); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	f.Options[0].Value = 1
+	if err := Fprint(new(bytes.Buffer), f); err == nil || err.Error() != "unsupported value 1 of type int" {
+		t.Errorf("expected error for int value, got %v", err)
+	}
+}
+
+var spanType = reflect.TypeOf(proto.Span{})
+
+// zeroSpans zeroes all the spans in the value v points to.
+func zeroSpans(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			zeroSpans(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			zeroSpans(v.Index(i))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			elem := reflect.New(v.Elem().Type()).Elem()
+			elem.Set(v.Elem())
+			zeroSpans(elem)
+			v.Set(elem)
+		}
+	case reflect.Struct:
+		if v.Type() == spanType {
+			v.Set(reflect.Zero(spanType))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			zeroSpans(v.Field(i))
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+// Features control the behavior of the definitions in a file.
+// Files using editions set them with options such as
+//
+//	option features.field_presence = IMPLICIT;
+//
+// which apply to the element where they're declared and every element
+// nested in it, unless overridden. Files using proto2 or proto3 have the
+// fixed features of their syntax.
+//
+// The features resolved for a field do not take into account the type of
+// the field, so for instance message fields in proto3 are reported to have
+// implicit presence.
+type Features struct {
+	FieldPresence         FieldPresence
+	EnumType              EnumType
+	RepeatedFieldEncoding RepeatedFieldEncoding
+	UTF8Validation        UTF8Validation
+}
+
+// FieldPresence defines whether a field tracks if it has been set.
+type FieldPresence int
+
+const (
+	ExplicitPresence FieldPresence = iota
+	ImplicitPresence
+	LegacyRequired
+)
+
+func (f FieldPresence) String() string {
+	return featureName(fieldPresenceNames, int(f))
+}
+
+// EnumType defines whether an enum accepts unknown values.
+type EnumType int
+
+const (
+	OpenEnum EnumType = iota
+	ClosedEnum
+)
+
+func (e EnumType) String() string {
+	return featureName(enumTypeNames, int(e))
+}
+
+// RepeatedFieldEncoding defines how repeated scalar fields are encoded.
+type RepeatedFieldEncoding int
+
+const (
+	PackedEncoding RepeatedFieldEncoding = iota
+	ExpandedEncoding
+)
+
+func (r RepeatedFieldEncoding) String() string {
+	return featureName(repeatedFieldEncodingNames, int(r))
+}
+
+// UTF8Validation defines whether string fields are validated as UTF-8.
+type UTF8Validation int
+
+const (
+	VerifyUTF8 UTF8Validation = iota
+	NoUTF8Validation
+)
+
+func (u UTF8Validation) String() string {
+	return featureName(utf8ValidationNames, int(u))
+}
+
+// Names used for the feature values in .proto files.
+var (
+	fieldPresenceNames         = []string{"EXPLICIT", "IMPLICIT", "LEGACY_REQUIRED"}
+	enumTypeNames              = []string{"OPEN", "CLOSED"}
+	repeatedFieldEncodingNames = []string{"PACKED", "EXPANDED"}
+	utf8ValidationNames        = []string{"VERIFY", "NONE"}
+)
+
+func featureName(names []string, v int) string {
+	if v < 0 || v >= len(names) {
+		return "UNKNOWN"
+	}
+	return names[v]
+}
+
+// DefaultFeatures returns the features used by files with the given syntax
+// and edition before any option is applied. Unknown editions get the
+// defaults of Edition2023.
+func DefaultFeatures(syntax, edition string) Features {
+	switch syntax {
+	case Proto2:
+		return Features{
+			FieldPresence:         ExplicitPresence,
+			EnumType:              ClosedEnum,
+			RepeatedFieldEncoding: ExpandedEncoding,
+			UTF8Validation:        NoUTF8Validation,
+		}
+	case Proto3:
+		return Features{
+			FieldPresence:         ImplicitPresence,
+			EnumType:              OpenEnum,
+			RepeatedFieldEncoding: PackedEncoding,
+			UTF8Validation:        VerifyUTF8,
+		}
+	default:
+		return Features{
+			FieldPresence:         ExplicitPresence,
+			EnumType:              OpenEnum,
+			RepeatedFieldEncoding: PackedEncoding,
+			UTF8Validation:        VerifyUTF8,
+		}
+	}
+}
+
+// Features returns the features of the file, resolved from the defaults
+// of its syntax or edition and its options.
+func (f *File) Features() Features {
+	return DefaultFeatures(f.Syntax.Value, f.Edition.Value).Apply(f.Options)
+}
+
+// Message returns the features of a message declared in an element with
+// features fs.
+func (fs Features) Message(m Message) Features { return fs.Apply(m.Options) }
+
+// Enum returns the features of an enum declared in an element with
+// features fs.
+func (fs Features) Enum(e Enum) Features { return fs.Apply(e.Options) }
+
+// Field returns the features of a field declared in a message with
+// features fs. The labels and packed option used in proto2 and proto3
+// are translated to their equivalent features.
+func (fs Features) Field(f Field) Features {
+	switch f.Label {
+	case RequiredLabel:
+		fs.FieldPresence = LegacyRequired
+	case OptionalLabel:
+		fs.FieldPresence = ExplicitPresence
+	}
+	for _, opt := range f.Options {
+		if opt.Prefix != nil || len(opt.Name) != 1 || opt.Name[0] != "packed" {
+			continue
+		}
+		if packed, ok := opt.Value.(bool); ok && packed {
+			fs.RepeatedFieldEncoding = PackedEncoding
+		} else if ok {
+			fs.RepeatedFieldEncoding = ExpandedEncoding
+		}
+	}
+	return fs.Apply(f.Options)
+}
+
+// Apply returns the result of overriding fs with the features set in the
+// given options, either one by one or as an aggregate:
+//
+//	option features.enum_type = CLOSED;
+//	option features = { enum_type: CLOSED };
+//
+// Unknown features and values are ignored.
+func (fs Features) Apply(opts []Option) Features {
+	for _, opt := range opts {
+		if opt.Prefix != nil || len(opt.Name) == 0 || opt.Name[0] != "features" {
+			continue
+		}
+		switch {
+		case len(opt.Name) == 2:
+			fs.set(opt.Name[1], opt.Value)
+		case len(opt.Name) == 1:
+			agg, _ := opt.Value.(Aggregate)
+			for _, f := range agg.Fields {
+				if !f.Extension && len(f.Name) == 1 {
+					fs.set(f.Name[0], f.Value)
+				}
+			}
+		}
+	}
+	return fs
+}
+
+func (fs *Features) set(name Identifier, v interface{}) {
+	value, ok := v.([]Identifier)
+	if !ok || len(value) != 1 {
+		return
+	}
+	switch name {
+	case "field_presence":
+		if v, ok := featureValue(fieldPresenceNames, value[0]); ok {
+			fs.FieldPresence = FieldPresence(v)
+		}
+	case "enum_type":
+		if v, ok := featureValue(enumTypeNames, value[0]); ok {
+			fs.EnumType = EnumType(v)
+		}
+	case "repeated_field_encoding":
+		if v, ok := featureValue(repeatedFieldEncodingNames, value[0]); ok {
+			fs.RepeatedFieldEncoding = RepeatedFieldEncoding(v)
+		}
+	case "utf8_validation":
+		if v, ok := featureValue(utf8ValidationNames, value[0]); ok {
+			fs.UTF8Validation = UTF8Validation(v)
+		}
+	}
+}
+
+func featureValue(names []string, name Identifier) (int, bool) {
+	for i, n := range names {
+		if Identifier(n) == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
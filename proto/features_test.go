@@ -0,0 +1,101 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import "testing"
+
+func feature(name, value string) Option {
+	return Option{
+		Name:  []Identifier{"features", Identifier(name)},
+		Value: []Identifier{Identifier(value)},
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	editions := &File{
+		Syntax:  Syntax{Value: Editions},
+		Edition: Edition{Value: Edition2023},
+		Options: []Option{feature("field_presence", "IMPLICIT")},
+	}
+	msg := Message{Options: []Option{feature("repeated_field_encoding", "EXPANDED")}}
+
+	tests := []struct {
+		name string
+		got  Features
+		want Features
+	}{
+		{"proto2 file",
+			(&File{Syntax: Syntax{Value: Proto2}}).Features(),
+			Features{ExplicitPresence, ClosedEnum, ExpandedEncoding, NoUTF8Validation},
+		},
+		{"proto3 file",
+			(&File{Syntax: Syntax{Value: Proto3}}).Features(),
+			Features{ImplicitPresence, OpenEnum, PackedEncoding, VerifyUTF8},
+		},
+		{"editions file",
+			editions.Features(),
+			Features{ImplicitPresence, OpenEnum, PackedEncoding, VerifyUTF8},
+		},
+		{"message inherits from file",
+			editions.Features().Message(msg),
+			Features{ImplicitPresence, OpenEnum, ExpandedEncoding, VerifyUTF8},
+		},
+		{"field inherits from message",
+			editions.Features().Message(msg).Field(Field{
+				Options: []Option{feature("utf8_validation", "NONE")},
+			}),
+			Features{ImplicitPresence, OpenEnum, ExpandedEncoding, NoUTF8Validation},
+		},
+		{"field overrides message",
+			editions.Features().Message(msg).Field(Field{
+				Options: []Option{feature("repeated_field_encoding", "PACKED")},
+			}),
+			Features{ImplicitPresence, OpenEnum, PackedEncoding, VerifyUTF8},
+		},
+		{"enum",
+			editions.Features().Enum(Enum{Options: []Option{feature("enum_type", "CLOSED")}}),
+			Features{ImplicitPresence, ClosedEnum, PackedEncoding, VerifyUTF8},
+		},
+		{"aggregate",
+			editions.Features().Apply([]Option{{
+				Name: []Identifier{"features"},
+				Value: Aggregate{Fields: []AggregateField{
+					{Name: []Identifier{"enum_type"}, Value: []Identifier{"CLOSED"}},
+					{Name: []Identifier{"utf8_validation"}, Value: []Identifier{"NONE"}},
+				}},
+			}}),
+			Features{ImplicitPresence, ClosedEnum, PackedEncoding, NoUTF8Validation},
+		},
+		{"unknown values are ignored",
+			editions.Features().Apply([]Option{feature("enum_type", "AJAR")}),
+			Features{ImplicitPresence, OpenEnum, PackedEncoding, VerifyUTF8},
+		},
+		{"proto2 required field",
+			DefaultFeatures(Proto2, "").Field(Field{Label: RequiredLabel}),
+			Features{LegacyRequired, ClosedEnum, ExpandedEncoding, NoUTF8Validation},
+		},
+		{"proto2 packed field",
+			DefaultFeatures(Proto2, "").Field(Field{
+				Label:   RepeatedLabel,
+				Options: []Option{{Name: []Identifier{"packed"}, Value: true}},
+			}),
+			Features{ExplicitPresence, ClosedEnum, PackedEncoding, NoUTF8Validation},
+		},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, tt.got)
+		}
+	}
+}
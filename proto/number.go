@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+// A Number is a numeric constant used as the value of an option.
+// It keeps the text of the literal, including its sign, and its exact value
+// in the field corresponding to its Kind.
+type Number struct {
+	Kind  NumberKind
+	Text  string  // the literal as written, such as "-0x1F" or "inf".
+	Int   int64   // value of IntNumber.
+	Uint  uint64  // value of UintNumber.
+	Float float64 // value of FloatNumber, InfNumber and NaNNumber.
+}
+
+// A NumberKind defines how the value of a Number is stored.
+type NumberKind int
+
+const (
+	IntNumber   NumberKind = iota // integers that fit in an int64.
+	UintNumber                    // integers larger than the maximum int64.
+	FloatNumber                   // float literals.
+	InfNumber                     // inf, with an optional sign.
+	NaNNumber                     // nan, with an optional sign.
+)
+
+func (n Number) String() string { return n.Text }
+
+// IsInteger returns true if the number was written as an integer literal.
+func (n Number) IsInteger() bool { return n.Kind == IntNumber || n.Kind == UintNumber }
+
+// Int64 returns the value of an integer number, and whether it fits in an int64.
+func (n Number) Int64() (int64, bool) { return n.Int, n.Kind == IntNumber }
+
+// Uint64 returns the value of a non negative integer number, and whether
+// the number is one.
+func (n Number) Uint64() (uint64, bool) {
+	switch {
+	case n.Kind == UintNumber:
+		return n.Uint, true
+	case n.Kind == IntNumber && n.Int >= 0:
+		return uint64(n.Int), true
+	default:
+		return 0, false
+	}
+}
+
+// Float64 returns the value of the number as a float64, which might lose
+// precision for large integers.
+func (n Number) Float64() float64 {
+	switch n.Kind {
+	case IntNumber:
+		return float64(n.Int)
+	case UintNumber:
+		return float64(n.Uint)
+	default:
+		return n.Float
+	}
+}
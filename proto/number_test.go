@@ -0,0 +1,51 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		n       Number
+		integer bool
+		i       int64
+		iok     bool
+		u       uint64
+		uok     bool
+		f       float64
+	}{
+		{Number{Kind: IntNumber, Text: "-3", Int: -3}, true, -3, true, 0, false, -3},
+		{Number{Kind: IntNumber, Text: "7", Int: 7}, true, 7, true, 7, true, 7},
+		{Number{Kind: UintNumber, Text: "18446744073709551615", Uint: math.MaxUint64}, true, 0, false, math.MaxUint64, true, math.MaxUint64},
+		{Number{Kind: FloatNumber, Text: "0.5", Float: 0.5}, false, 0, false, 0, false, 0.5},
+		{Number{Kind: InfNumber, Text: "-inf", Float: math.Inf(-1)}, false, 0, false, 0, false, math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		if got := tt.n.IsInteger(); got != tt.integer {
+			t.Errorf("%s: expected IsInteger to be %v", tt.n, tt.integer)
+		}
+		if i, ok := tt.n.Int64(); i != tt.i || ok != tt.iok {
+			t.Errorf("%s: expected Int64 to return %d, %v; got %d, %v", tt.n, tt.i, tt.iok, i, ok)
+		}
+		if u, ok := tt.n.Uint64(); u != tt.u || ok != tt.uok {
+			t.Errorf("%s: expected Uint64 to return %d, %v; got %d, %v", tt.n, tt.u, tt.uok, u, ok)
+		}
+		if f := tt.n.Float64(); f != tt.f {
+			t.Errorf("%s: expected Float64 to return %v; got %v", tt.n, tt.f, f)
+		}
+	}
+}
@@ -1,18 +1,52 @@
 package proto
 
+import (
+	"strings"
+
+	"github.com/campoy/groto/token"
+)
+
 // A File contains all the information that one can define in a .proto file.
 type File struct {
+	Span
 	Syntax   Syntax
+	Edition  Edition // only set if Syntax is Editions.
 	Package  Package
 	Imports  []Import
 	Options  []Option
 	Messages []Message
 	Enums    []Enum
 	Services []Service
+	Extends  []Extend
+}
+
+// Syntax defines the protobuf version used in a file, Proto2 or Proto3.
+// Files without a syntax statement use Proto2, and have an invalid Span.
+// Files with an edition statement use Editions.
+type Syntax struct {
+	Span
+	Comments
+	Value string
+}
+
+// Values of Syntax.
+const (
+	Proto2   = "proto2"
+	Proto3   = "proto3"
+	Editions = "editions"
+)
+
+// An Edition statement replaces the syntax statement in files using
+// editions, such as "2023". The behavior of the definitions in the file
+// is then controlled by features, see Features.
+type Edition struct {
+	Span
+	Comments
+	Value string
 }
 
-// Syntax defines the protobuf version, it is always "proto3".
-type Syntax struct{ Value string }
+// Edition2023 is the only supported edition.
+const Edition2023 = "2023"
 
 // An ImportModifier modifies an import statement to be weak or public.
 type ImportModifier int
@@ -25,12 +59,16 @@ const (
 
 // An Import statement is used to import definitions from other files.
 type Import struct {
+	Span
+	Comments
 	Modifier ImportModifier
 	Path     string
 }
 
 // A Package statement can be used to prevent name clashes between protocol message types.
 type Package struct {
+	Span
+	Comments
 	Identifier []Identifier
 }
 
@@ -41,46 +79,204 @@ type Identifier string
 // An option can be a protobuf defined option or a custom option.
 // For more information, see Options in the language guide.
 // https://developers.google.com/protocol-buffers/docs/proto3#options
+//
+// The Value of an option is a string, Number, bool, []Identifier,
+// or an Aggregate.
 type Option struct {
+	Span
+	Comments
 	Prefix []Identifier // Parenthesised part of the identifier, if any.
 	Name   []Identifier
 	Value  interface{}
 }
 
+// An Aggregate is a message literal used as the value of an option,
+// written in the protobuf text format, as in:
+//
+//	option (google.api.http) = { get: "/v1/{name=*}" body: "*" };
+type Aggregate struct {
+	Span
+	Fields []AggregateField
+}
+
+// An AggregateField sets the value of one of the fields in an Aggregate.
+// Names written in brackets are extensions, or the message type of an
+// expanded Any value if TypeURL is set.
+type AggregateField struct {
+	Span
+	Name      []Identifier
+	Extension bool
+	TypeURL   string      // prefix of the type URL, such as "type.googleapis.com".
+	Value     interface{} // same as Option.Value, or a List.
+}
+
+// A List contains the values of a repeated field in an Aggregate.
+type List struct {
+	Span
+	Values []interface{}
+}
+
 // A Message consists of a message name and a message body.
 // The message body can have fields, nested enum definitions,
 // nested message definitions, options, oneofs, map fields,
-// and reserved statements.
+// reserved statements, extension ranges and extend blocks.
 type Message struct {
-	Name      Identifier
-	Fields    []Field
-	Enums     []Enum
-	Messages  []Message
-	Options   []Option
-	OneOfs    []OneOf
-	Maps      []Map
-	Reserveds []Reserved
+	Span
+	Comments
+	Name       Identifier
+	Fields     []Field
+	Enums      []Enum
+	Messages   []Message
+	Options    []Option
+	OneOfs     []OneOf
+	Maps       []Map
+	Reserveds  []Reserved
+	Extensions []ExtensionRange
+	Extends    []Extend
 }
 
 // Fields are the basic elements of a protocol buffer message.
+//
+// In proto2, a group defines both a field and the message type of the
+// field. For those, Group holds the message, Type refers to it, and Name
+// is the lowercase version of the name of the group.
 type Field struct {
-	Repeated bool
-	Type     Type
-	Name     Identifier
-	Number   int
-	Options  []Option
+	Span
+	Comments
+	Label   Label
+	Type    Type
+	Name    Identifier
+	Number  int
+	Options []Option
+	Group   *Message
+}
+
+// Default returns the value of the default option of the field, if any.
+// Default values are only allowed in proto2.
+func (f Field) Default() (interface{}, bool) {
+	for _, opt := range f.Options {
+		if opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == "default" {
+			return opt.Value, true
+		}
+	}
+	return nil, false
+}
+
+// JSONName returns the name used for a field in JSON, as protoc does:
+// underscores are removed, and the letter after each one is capitalized.
+func JSONName(name string) string {
+	var buf strings.Builder
+	upper := false
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			buf.WriteByte(c - 'a' + 'A')
+			upper = false
+		default:
+			buf.WriteByte(c)
+			upper = false
+		}
+	}
+	return buf.String()
+}
+
+// A Label defines whether a field is optional, required, or repeated.
+type Label int
+
+const (
+	NoLabel Label = iota // proto3 and editions fields, and fields in oneofs.
+	OptionalLabel
+	RequiredLabel
+	RepeatedLabel
+)
+
+// SyntheticOneOfs returns the names of the oneofs that protoc generates in
+// descriptors for the optional fields of a message in a proto3 file, indexed
+// by field name. Each oneof is named after its field with a leading
+// underscore, prefixed with as many X as needed to avoid conflicts with
+// other fields and oneofs. It returns nil for other syntaxes.
+func (m Message) SyntheticOneOfs(syntax string) map[Identifier]Identifier {
+	if syntax != Proto3 {
+		return nil
+	}
+
+	names := make(map[Identifier]bool)
+	for _, f := range m.Fields {
+		names[f.Name] = true
+	}
+	for _, f := range m.Maps {
+		names[f.Name] = true
+	}
+	for _, o := range m.OneOfs {
+		names[o.Name] = true
+		for _, f := range o.Fields {
+			names[f.Name] = true
+		}
+	}
+
+	var oneofs map[Identifier]Identifier
+	for _, f := range m.Fields {
+		if f.Label != OptionalLabel {
+			continue
+		}
+		name := f.Name
+		if !strings.HasPrefix(string(name), "_") {
+			name = "_" + name
+		}
+		for names[name] {
+			name = "X" + name
+		}
+		names[name] = true
+		if oneofs == nil {
+			oneofs = make(map[Identifier]Identifier)
+		}
+		oneofs[f.Name] = name
+	}
+	return oneofs
+}
+
+// MessageSetWireFormat returns true if the message has the option
+// message_set_wire_format set to true. The extension numbers of those
+// messages go up to MaxMessageSetNumber.
+func (m Message) MessageSetWireFormat() bool {
+	for _, opt := range m.Options {
+		if opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == "message_set_wire_format" {
+			v, _ := opt.Value.(bool)
+			return v
+		}
+	}
+	return false
 }
 
 // An Enum consists of a name and an enum body.
-// The enum body can have options and enum fields.
+// The enum body can have options, enum fields and reserved statements.
 type Enum struct {
-	Name    Identifier
-	Fields  []EnumField
-	Options []Option
+	Span
+	Comments
+	Name      Identifier
+	Fields    []EnumField
+	Options   []Option
+	Reserveds []Reserved
+}
+
+// AllowAlias returns true if the enum has the option allow_alias set to
+// true, which allows different enum fields to have the same number.
+func (e Enum) AllowAlias() bool {
+	for _, opt := range e.Options {
+		if opt.Prefix == nil && len(opt.Name) == 1 && opt.Name[0] == "allow_alias" {
+			v, _ := opt.Value.(bool)
+			return v
+		}
+	}
+	return false
 }
 
 // An EnumField is one of the values defined in an Enum.
 type EnumField struct {
+	Span
+	Comments
 	Name    Identifier
 	Number  int
 	Options []Option
@@ -89,21 +285,29 @@ type EnumField struct {
 // A OneOf provides a way to define when only one of a set of fields
 // can be set at any time.
 type OneOf struct {
+	Span
+	Comments
 	Name   Identifier
 	Fields []OneOfField
 }
 
 // A OneOfField is one of the possible fields in a OneOf statement.
+// In proto2 it can also be a group, as described in Field.
 type OneOfField struct {
+	Span
+	Comments
 	Type    Type
 	Name    Identifier
 	Number  int
 	Options []Option
+	Group   *Message
 }
 
 // A Map field has a key type, value type, name, and field number.
 // The key type can be any integral or string type.
 type Map struct {
+	Span
+	Comments
 	KeyType   Type
 	ValueType Type
 	Name      Identifier
@@ -111,11 +315,61 @@ type Map struct {
 	Options   []Option
 }
 
+// EntryName returns the name of the message protoc generates for the
+// entries of a map field: the name of the field in camel case with the
+// suffix Entry.
+func (m Map) EntryName() Identifier {
+	var buf strings.Builder
+	upper := true
+	for i := 0; i < len(m.Name); i++ {
+		switch c := m.Name[i]; {
+		case c == '_':
+			upper = true
+		case upper && 'a' <= c && c <= 'z':
+			buf.WriteByte(c - 'a' + 'A')
+			upper = false
+		default:
+			buf.WriteByte(c)
+			upper = false
+		}
+	}
+	return Identifier(buf.String() + "Entry")
+}
+
+// Entry returns the message protoc generates for the entries of a map field,
+// which is nested in the message containing the field, and has the option
+// map_entry set. Its fields, key and value, are optional, as they are in
+// descriptors. The field is equivalent to a repeated field of that type.
+// The message and its fields are located at the map field.
+func (m Map) Entry() Message {
+	return Message{
+		Span: m.Span,
+		Name: m.EntryName(),
+		Fields: []Field{
+			{Span: m.Span, Label: OptionalLabel, Type: m.KeyType, Name: "key", Number: 1},
+			{Span: m.Span, Label: OptionalLabel, Type: m.ValueType, Name: "value", Number: 2},
+		},
+		Options: []Option{{Span: m.Span, Name: []Identifier{"map_entry"}, Value: true}},
+	}
+}
+
 // Type contains either a predefined type in the form a Token,
-// or a full identifier.
+// or a full identifier. FullyQualified is set for identifiers starting
+// with a dot, which are resolved from the outermost scope.
 type Type struct {
-	Predefined  PredefinedType
-	UserDefined []Identifier
+	Span
+	Predefined     PredefinedType
+	UserDefined    []Identifier
+	FullyQualified bool
+	Target         *Target // definition of a user defined type, set by package linker.
+}
+
+// A Target is the message or enum a user defined type refers to.
+type Target struct {
+	File     string   // name of the file where it is defined.
+	FullName string   // fully qualified name, without a leading dot.
+	Message  *Message // set if the target is a message.
+	Enum     *Enum    // set if the target is an enum.
 }
 
 // A PredefinedType is a type that is part of the definition of the
@@ -142,18 +396,63 @@ const (
 )
 
 // A Reserved statement declares a range of field numbers or field
-// names that cannot be used in this message.
+// names that cannot be used in this message, or a range of numbers or
+// names that cannot be used by the fields of an enum.
+//
+// Ranges holds the numbers in the order they were written, with single
+// numbers as ranges from and to the same number.
 type Reserved struct {
-	IDs    []int
+	Span
+	Comments
 	Names  []string
 	Ranges []Range
 }
 
-// A Range defines a range of values that are reserved in a Reserved statement.
-type Range struct{ From, To int }
+// A Range defines a range of values, from From to To both included,
+// that are reserved in a Reserved statement or used for extensions.
+type Range struct {
+	Span
+	From, To int
+}
+
+// MaxFieldNumber is the largest valid field number, which is used as the end
+// of a range of field numbers defined with the keyword max.
+const MaxFieldNumber = 1<<29 - 1
+
+// MaxMessageSetNumber is the largest valid extension number of a message
+// with the option message_set_wire_format. The ranges of those messages
+// defined with the keyword max still end at MaxFieldNumber, which stands
+// for this number.
+const MaxMessageSetNumber = 1<<31 - 2
+
+// MaxEnumNumber is the largest valid enum number, which is used as the end
+// of a range of enum numbers defined with the keyword max.
+const MaxEnumNumber = 1<<31 - 1
+
+// An ExtensionRange declares a range of field numbers that are available
+// for extensions of a message, which are declared in Extend blocks.
+// Extension ranges are not allowed in proto3.
+type ExtensionRange struct {
+	Span
+	Comments
+	Ranges  []Range
+	Options []Option
+}
+
+// An Extend block declares fields, known as extensions, of a message defined
+// elsewhere with extension ranges. In proto3, only the options defined in
+// google/protobuf/descriptor.proto can be extended.
+type Extend struct {
+	Span
+	Comments
+	Type   Type // the extended message.
+	Fields []Field
+}
 
 // A Service is defined by its name and a list of RPC methods.
 type Service struct {
+	Span
+	Comments
 	Name    Identifier
 	Options []Option
 	RPCs    []RPC
@@ -162,14 +461,47 @@ type Service struct {
 // A RPC method defines a remote procedure call with a name,
 // input and output types, and options.
 type RPC struct {
+	Span
+	Comments
 	Name    Identifier
 	In      RPCParam
 	Out     RPCParam
 	Options []Option
+	Body    bool // the method has a body in braces, even if empty.
 }
 
 // An RPCParam defines an input or output parameter for an RPC service.
 type RPCParam struct {
-	Stream bool
-	Type   []Identifier
+	Span
+	Stream         bool
+	Type           []Identifier
+	FullyQualified bool    // the type starts with a dot.
+	Target         *Target // message the type refers to, set by package linker.
+}
+
+// A Span holds the positions of the first character of a node in the
+// source file it was parsed from, and of the character immediately after it.
+// Nodes that were not parsed from a file have an invalid Span.
+type Span struct {
+	Pos token.Position
+	End token.Position
+}
+
+// Comments holds the comments attached to a node, following the same
+// conventions as protoc when it generates SourceCodeInfo:
+//
+//   - LeadingComments is the comment right before the node, with no blank
+//     lines in between.
+//   - TrailingComment is the comment right after the node, on the same line
+//     or the next one.
+//   - LeadingDetachedComments are the comments before the node that are
+//     separated from it, and from the previous node, by blank lines.
+//
+// Comment markers are removed, as well as the leading asterisks on each line
+// of block comments, but the rest of the text is kept as is, including
+// newlines and leading spaces.
+type Comments struct {
+	LeadingDetachedComments []string
+	LeadingComments         string
+	TrailingComment         string
 }
@@ -0,0 +1,91 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proto
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/campoy/groto/token"
+)
+
+func TestSyntheticOneOfs(t *testing.T) {
+	msg := Message{
+		Fields: []Field{
+			{Label: OptionalLabel, Name: "foo"},
+			{Name: "_bar"},
+			{Label: OptionalLabel, Name: "bar"},
+			{Label: OptionalLabel, Name: "_baz"},
+			{Label: RepeatedLabel, Name: "list"},
+		},
+		OneOfs: []OneOf{{Name: "X_bar"}},
+	}
+
+	tests := []struct {
+		syntax string
+		want   map[Identifier]Identifier
+	}{
+		{Proto3, map[Identifier]Identifier{
+			"foo":  "_foo",
+			"bar":  "XX_bar",
+			"_baz": "X_baz",
+		}},
+		{Proto2, nil},
+		{Editions, nil},
+	}
+	for _, tt := range tests {
+		got := msg.SyntheticOneOfs(tt.syntax)
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("%s: expected %v, got %v", tt.syntax, tt.want, got)
+		}
+	}
+}
+
+func TestMapEntry(t *testing.T) {
+	for _, tt := range []struct {
+		name, want Identifier
+	}{
+		{"foo", "FooEntry"},
+		{"foo_bar", "FooBarEntry"},
+		{"_foo__bar_", "FooBarEntry"},
+		{"fooBar2x", "FooBar2xEntry"},
+		{"Foo", "FooEntry"},
+	} {
+		if got := (Map{Name: tt.name}).EntryName(); got != tt.want {
+			t.Errorf("%s: expected entry name %s, got %s", tt.name, tt.want, got)
+		}
+	}
+
+	span := Span{Pos: token.Position{Line: 1, Column: 1}}
+	m := Map{
+		Span:      span,
+		KeyType:   Type{Predefined: TypeString},
+		ValueType: Type{UserDefined: []Identifier{"Foo"}},
+		Name:      "foos",
+		Number:    3,
+		Options:   []Option{{Name: []Identifier{"deprecated"}, Value: true}},
+	}
+	want := Message{
+		Span: span,
+		Name: "FoosEntry",
+		Fields: []Field{
+			{Span: span, Label: OptionalLabel, Type: Type{Predefined: TypeString}, Name: "key", Number: 1},
+			{Span: span, Label: OptionalLabel, Type: Type{UserDefined: []Identifier{"Foo"}}, Name: "value", Number: 2},
+		},
+		Options: []Option{{Span: span, Name: []Identifier{"map_entry"}, Value: true}},
+	}
+	if got := m.Entry(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected entry:\n%+v\ngot:\n%+v", want, got)
+	}
+}
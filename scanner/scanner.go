@@ -25,19 +25,35 @@ import (
 )
 
 // New creates a new Scanner reading from the given io.Reader.
-func New(r io.Reader) *Scanner {
-	return &Scanner{r: bufio.NewReader(r)}
+func New(r io.Reader) *Scanner { return NewFile("", r) }
+
+// NewFile creates a new Scanner reading from the given io.Reader, which
+// contains the file with the given name. The name is only used to fill
+// the positions of the scanned tokens.
+func NewFile(filename string, r io.Reader) *Scanner {
+	return &Scanner{
+		r:   bufio.NewReader(r),
+		pos: token.Position{Filename: filename, Line: 1, Column: 1},
+	}
 }
 
 // A Scanner scans tokens from the io.Reader given at construction.
 type Scanner struct {
 	r *bufio.Reader
+
+	pos   token.Position // position of the next rune to be read.
+	prev  token.Position // position before the last read, restored by unread.
+	start token.Position // position of the first rune of the current token.
 }
 
 // A Token is defined by its kind, and sometimes by some text.
+// Pos and End are the positions of the first character of the token
+// and of the character immediately after it.
 type Token struct {
 	token.Kind
 	Text string
+	Pos  token.Position
+	End  token.Position
 }
 
 // String returns a human readable representation of a Token.
@@ -49,7 +65,7 @@ func (t Token) String() string {
 }
 
 func (s *Scanner) emit(kind token.Kind, value []rune) Token {
-	return Token{Kind: kind, Text: string(value)}
+	return Token{Kind: kind, Text: string(value), Pos: s.start, End: s.pos}
 }
 
 // Scan returns the next token found in the given io.Reader.
@@ -58,6 +74,7 @@ func (s *Scanner) emit(kind token.Kind, value []rune) Token {
 // If the io.Reader reaches EOF, the token will be of kind EOF.
 func (s *Scanner) Scan() (tok Token) {
 	s.readWhile(isSpace)
+	s.start = s.pos
 
 	r := s.peek()
 	switch {
@@ -97,26 +114,56 @@ func (s *Scanner) identifier() Token {
 	}
 }
 
+// string scans a string literal, keeping its escape sequences as they are.
+// String literals can't contain new lines.
 func (s *Scanner) string() Token {
 	first := s.read()
 	value := []rune{first}
 	for {
-		value = append(value, s.readUntil(equals(first))...)
-		value = append(value, s.read())
-		if len(value) == 2 || value[len(value)-2] != backslash {
-			return s.emit(token.StringLiteral, value)
+		switch r := s.read(); r {
+		case first:
+			return s.emit(token.StringLiteral, append(value, r))
+		case eof:
+			return s.emit(token.Illegal, []rune("unterminated string literal"))
+		case '\n':
+			s.unread()
+			return s.emit(token.Illegal, []rune("unterminated string literal"))
+		case backslash:
+			value = append(value, r)
+			if next := s.peek(); next != eof && next != '\n' {
+				value = append(value, s.read())
+			}
+		default:
+			value = append(value, r)
 		}
 	}
 }
 
 func (s *Scanner) comment() Token {
-	value := []rune{s.read(), s.read()}
-	if string(value) != "//" {
-		return s.emit(token.Illegal, value)
+	value := []rune{s.read()}
+	switch s.peek() {
+	case '/':
+		value = append(value, s.read())
+		value = append(value, s.readUntil(equals('\n'))...)
+		return s.emit(token.Comment, value)
+	case '*':
+		return s.blockComment(append(value, s.read()))
+	default:
+		return s.emit(token.Slash, nil)
 	}
+}
 
-	value = append(value, s.readUntil(equals('\n'))...)
-	return s.emit(token.Comment, value)
+func (s *Scanner) blockComment(value []rune) Token {
+	for {
+		r := s.read()
+		if r == eof {
+			return s.emit(token.Illegal, []rune("unterminated block comment"))
+		}
+		value = append(value, r)
+		if r == '/' && len(value) > 3 && value[len(value)-2] == '*' {
+			return s.emit(token.Comment, value)
+		}
+	}
 }
 
 func (s *Scanner) number() Token {
@@ -149,9 +196,14 @@ func (s *Scanner) number() Token {
 		tok = token.FloatLiteral
 		value = append(value, next)
 
-		sign := s.read()
-		value = append(value, sign)
-		if sign != '+' && sign != '-' {
+		// The sign of the exponent is optional, but its digits are not.
+		if sign := s.peek(); sign == '+' || sign == '-' {
+			value = append(value, s.read())
+		}
+		if r := s.peek(); !isDecimalDigit(r) {
+			if r != eof && !isSpace(r) {
+				value = append(value, s.read())
+			}
 			return s.emit(token.Illegal, value)
 		}
 		value = append(value, s.readWhile(isDecimalDigit)...)
@@ -177,10 +229,19 @@ func (s *Scanner) hex(value []rune) Token {
 }
 
 func (s *Scanner) read() rune {
-	r, _, err := s.r.ReadRune()
+	r, size, err := s.r.ReadRune()
 	if err == io.EOF {
 		return eof
 	}
+
+	s.prev = s.pos
+	s.pos.Offset += size
+	if r == '\n' {
+		s.pos.Line++
+		s.pos.Column = 1
+	} else {
+		s.pos.Column++
+	}
 	return r
 }
 
@@ -188,6 +249,7 @@ func (s *Scanner) unread() {
 	if err := s.r.UnreadRune(); err != nil {
 		panic(err)
 	}
+	s.pos = s.prev
 }
 
 func (s *Scanner) peek() rune {
@@ -20,79 +20,99 @@ import (
 	"github.com/campoy/groto/token"
 )
 
+// kindText is a Token without positions, used to keep test tables short.
+type kindText struct {
+	Kind token.Kind
+	Text string
+}
+
 func TestScanner(t *testing.T) {
 	tests := []struct {
 		name string
 		in   string
-		out  []Token
+		out  []kindText
 	}{
 		{"empty string", "", nil},
-		{"one letter ident", "x", []Token{
+		{"one letter ident", "x", []kindText{
 			{token.Identifier, "x"},
 		}},
-		{"longer ident", "counter", []Token{
+		{"longer ident", "counter", []kindText{
 			{token.Identifier, "counter"},
 		}},
-		{"full identifier", "one.two.three", []Token{
+		{"full identifier", "one.two.three", []kindText{
 			{token.Identifier, "one"}, {token.Dot, ""},
 			{token.Identifier, "two"}, {token.Dot, ""},
 			{token.Identifier, "three"},
 		}},
-		{"two identifiers", "a b ", []Token{
+		{"two identifiers", "a b ", []kindText{
 			{token.Identifier, "a"},
 			{token.Identifier, "b"},
 		}},
-		{"decimal numbers", "0 1 20 30000", []Token{
+		{"decimal numbers", "0 1 20 30000", []kindText{
 			{token.DecimalLiteral, "0"},
 			{token.DecimalLiteral, "1"},
 			{token.DecimalLiteral, "20"},
 			{token.DecimalLiteral, "30000"},
 		}},
-		{"octal numbers", "01 020 019", []Token{
+		{"octal numbers", "01 020 019", []kindText{
 			{token.OctalLiteral, "01"},
 			{token.OctalLiteral, "020"},
 			{token.Illegal, "019"},
 		}},
-		{"hex numbers", "0x1 0XA2F 0x", []Token{
+		{"hex numbers", "0x1 0XA2F 0x", []kindText{
 			{token.HexLiteral, "0x1"},
 			{token.HexLiteral, "0XA2F"},
 			{token.Illegal, "0x"},
 		}},
-		{"float numbers", "0.1E+2 1.2 1.3E-10 4e+5 4e.5", []Token{
+		{"float numbers", "0.1E+2 1.2 1.3E-10 4e+5 1.5e3 4e.5 4e+", []kindText{
 			{token.FloatLiteral, "0.1E+2"},
 			{token.FloatLiteral, "1.2"},
 			{token.FloatLiteral, "1.3E-10"},
 			{token.FloatLiteral, "4e+5"},
+			{token.FloatLiteral, "1.5e3"},
 			{token.Illegal, "4e."}, {token.DecimalLiteral, "5"},
+			{token.Illegal, "4e+"},
 		}},
-		{"signed numbers", "+0 -010 -0xfff +0.5 -1", []Token{
+		{"signed numbers", "+0 -010 -0xfff +0.5 -1", []kindText{
 			{token.Plus, ""}, {token.DecimalLiteral, "0"},
 			{token.Minus, ""}, {token.OctalLiteral, "010"},
 			{token.Minus, ""}, {token.HexLiteral, "0xfff"},
 			{token.Plus, ""}, {token.FloatLiteral, "0.5"},
 			{token.Minus, ""}, {token.DecimalLiteral, "1"},
 		}},
-		{"double quote strings", `"" "hello" "hello\" there"`, []Token{
+		{"double quote strings", `"" "hello" "hello\" there"`, []kindText{
 			{token.StringLiteral, `""`},
 			{token.StringLiteral, `"hello"`},
 			{token.StringLiteral, `"hello\" there"`},
 		}},
-		{"single quote strings", `'' 'hello' 'hello\' there'`, []Token{
+		{"single quote strings", `'' 'hello' 'hello\' there'`, []kindText{
 			{token.StringLiteral, `''`},
 			{token.StringLiteral, `'hello'`},
 			{token.StringLiteral, `'hello\' there'`},
 		}},
-		{"booleans", `true false`, []Token{
+		{"escaped backslashes", `"a\\" 'b\\\'c'`, []kindText{
+			{token.StringLiteral, `"a\\"`},
+			{token.StringLiteral, `'b\\\'c'`},
+		}},
+		{"unterminated string", `"hello`, []kindText{
+			{token.Illegal, "unterminated string literal"},
+		}},
+		{"new line in string", "'hello\nthere'", []kindText{
+			{token.Illegal, "unterminated string literal"},
+			{token.Identifier, "there"},
+			{token.Illegal, "unterminated string literal"},
+		}},
+		{"booleans", `true false`, []kindText{
 			{token.True, ""},
 			{token.False, ""},
 		}},
-		{"keywords, booleans, and idents", `import false hello bytes`, []Token{
+		{"keywords, booleans, and idents", `import false hello bytes`, []kindText{
 			{token.Import, ""},
 			{token.False, ""},
 			{token.Identifier, "hello"},
 			{token.Bytes, ""},
 		}},
-		{"punctuation", `(){};=`, []Token{
+		{"punctuation", `(){};=`, []kindText{
 			{token.OpenParen, ""},
 			{token.CloseParen, ""},
 			{token.OpenBrace, ""},
@@ -100,20 +120,35 @@ func TestScanner(t *testing.T) {
 			{token.Semicolon, ""},
 			{token.Equals, ""},
 		}},
-		{"comments", "text // a comment\nimport", []Token{
+		{"comments", "text // a comment\nimport", []kindText{
 			{token.Identifier, "text"},
 			{token.Comment, "// a comment"},
 			{token.Import, ""},
 		}},
-		{"unexpected characters", "#blessed", []Token{
+		{"unexpected characters", "#blessed", []kindText{
 			{token.Illegal, "#"},
 			{token.Identifier, "blessed"},
 		}},
-		{"not a comment", "/* badcomment", []Token{
-			{token.Illegal, "/*"},
-			{token.Identifier, "badcomment"},
+		{"block comments", "text /* a comment */ import /**/ /*/ a ** b */", []kindText{
+			{token.Identifier, "text"},
+			{token.Comment, "/* a comment */"},
+			{token.Import, ""},
+			{token.Comment, "/**/"},
+			{token.Comment, "/*/ a ** b */"},
 		}},
-		{"option command", `option options.number = 42;`, []Token{
+		{"multi-line block comment", "/* one\n * two\n */\nimport", []kindText{
+			{token.Comment, "/* one\n * two\n */"},
+			{token.Import, ""},
+		}},
+		{"unterminated block comment", "text /* badcomment *", []kindText{
+			{token.Identifier, "text"},
+			{token.Illegal, "unterminated block comment"},
+		}},
+		{"not a comment", "/ notcomment", []kindText{
+			{token.Slash, ""},
+			{token.Identifier, "notcomment"},
+		}},
+		{"option command", `option options.number = 42;`, []kindText{
 			{token.Option, ""},
 			{token.Identifier, "options"},
 			{token.Dot, ""},
@@ -148,3 +183,30 @@ func TestScanner(t *testing.T) {
 		})
 	}
 }
+
+func TestPositions(t *testing.T) {
+	pos := func(offset, line, column int) token.Position {
+		return token.Position{Filename: "foo.proto", Offset: offset, Line: line, Column: column}
+	}
+
+	in := "syntax = \"proto3\";\n\n// héllo\nmessage  Foo {}"
+	out := []Token{
+		{Kind: token.Syntax, Pos: pos(0, 1, 1), End: pos(6, 1, 7)},
+		{Kind: token.Equals, Pos: pos(7, 1, 8), End: pos(8, 1, 9)},
+		{Kind: token.StringLiteral, Text: `"proto3"`, Pos: pos(9, 1, 10), End: pos(17, 1, 18)},
+		{Kind: token.Semicolon, Pos: pos(17, 1, 18), End: pos(18, 1, 19)},
+		{Kind: token.Comment, Text: "// héllo", Pos: pos(20, 3, 1), End: pos(29, 3, 9)},
+		{Kind: token.Message, Pos: pos(30, 4, 1), End: pos(37, 4, 8)},
+		{Kind: token.Identifier, Text: "Foo", Pos: pos(39, 4, 10), End: pos(42, 4, 13)},
+		{Kind: token.OpenBrace, Pos: pos(43, 4, 14), End: pos(44, 4, 15)},
+		{Kind: token.CloseBrace, Pos: pos(44, 4, 15), End: pos(45, 4, 16)},
+		{Kind: token.EOF, Pos: pos(45, 4, 16), End: pos(45, 4, 16)},
+	}
+
+	s := NewFile("foo.proto", strings.NewReader(in))
+	for i, want := range out {
+		if got := s.Scan(); got != want {
+			t.Errorf("token[%d] expected %v at %v-%v, got %v at %v-%v", i, want, want.Pos, want.End, got, got.Pos, got.End)
+		}
+	}
+}
@@ -11,9 +11,12 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// Package token defines all the token kinds defined in the Protocol Buffers language version 3.
+// Package token defines all the token kinds defined in the Protocol Buffers language,
+// versions 2 and 3, and editions.
 //
-// You can find the specification of the language in https://developers.google.com/protocol-buffers/docs/reference/proto3-spec.
+// You can find the specification of the language in https://developers.google.com/protocol-buffers/docs/reference/proto3-spec,
+// https://developers.google.com/protocol-buffers/docs/reference/proto2-spec
+// and https://protobuf.dev/reference/protobuf/edition-2023-spec.
 package token
 
 import (
@@ -45,15 +48,21 @@ const (
 	True
 	last_constant
 
+	Edition
 	Enum
+	Extend
+	Extensions
+	Group
 	Import
 	Map
 	Message
 	Oneof
 	Option
+	Optional
 	Package
 	Public
 	Repeated
+	Required
 	Reserved
 	Returns
 	RPC
@@ -68,7 +77,6 @@ const (
 	Bytes
 	Double
 	Float
-	first_key_type
 	Bool
 	Fixed32
 	Fixed64
@@ -88,6 +96,7 @@ const (
 	Minus        // -
 	Plus         // +
 	Comma        // ,
+	Colon        // :
 	Semicolon    // ;
 	OpenParen    // (
 	CloseParen   // )
@@ -97,6 +106,7 @@ const (
 	CloseBracket // ]
 	OpenAngled   // <
 	CloseAngled  // >
+	Slash        // /
 
 	last_kind
 )
@@ -110,6 +120,7 @@ var (
 		"-": Minus,
 		"+": Plus,
 		",": Comma,
+		":": Colon,
 		";": Semicolon,
 		"(": OpenParen,
 		")": CloseParen,
@@ -119,6 +130,7 @@ var (
 		"]": CloseBracket,
 		"<": OpenAngled,
 		">": CloseAngled,
+		"/": Slash,
 	}
 )
 
@@ -149,8 +161,16 @@ func (k Kind) IsNumber() bool { return k > first_number && k < last_number }
 // IsType returns true only if the given Kind is a type.
 func (k Kind) IsType() bool { return k > first_type && k < last_type }
 
-// IsKeyType returns true only if the given Kind is a valid map key type.
-func (k Kind) IsKeyType() bool { return k > first_key_type && k < last_type }
+// IsKeyType returns true only if the given Kind is a valid map key type:
+// any integral or string type, which excludes bytes and floating point types.
+func (k Kind) IsKeyType() bool {
+	switch k {
+	case Bool, Fixed32, Fixed64, Int32, Int64, Sfixed32, Sfixed64, Sint32, Sint64, String, Uint32, Uint64:
+		return true
+	default:
+		return false
+	}
+}
 
 func from(a, b Kind) map[string]Kind {
 	m := make(map[string]Kind, b-a-1)
@@ -186,8 +206,16 @@ func (k Kind) String() string {
 		return "false"
 	case True:
 		return "true"
+	case Edition:
+		return "edition"
 	case Enum:
 		return "enum"
+	case Extend:
+		return "extend"
+	case Extensions:
+		return "extensions"
+	case Group:
+		return "group"
 	case Import:
 		return "import"
 	case Map:
@@ -198,12 +226,16 @@ func (k Kind) String() string {
 		return "oneof"
 	case Option:
 		return "option"
+	case Optional:
+		return "optional"
 	case Package:
 		return "package"
 	case Public:
 		return "public"
 	case Repeated:
 		return "repeated"
+	case Required:
+		return "required"
 	case Reserved:
 		return "reserved"
 	case Returns:
@@ -261,6 +293,8 @@ func (k Kind) String() string {
 		return "'+'"
 	case Comma:
 		return "','"
+	case Colon:
+		return "':'"
 	case Semicolon:
 		return "';'"
 	case OpenParen:
@@ -279,6 +313,8 @@ func (k Kind) String() string {
 		return "'<'"
 	case CloseAngled:
 		return "'>'"
+	case Slash:
+		return "'/'"
 	default:
 		return fmt.Sprintf("unkown token kind %d", k)
 	}
@@ -23,15 +23,21 @@ func TestConstructors(t *testing.T) {
 	}{
 		{"false", Keyword, False},
 		{"true", Keyword, True},
+		{"edition", Keyword, Edition},
 		{"enum", Keyword, Enum},
+		{"extend", Keyword, Extend},
+		{"extensions", Keyword, Extensions},
+		{"group", Keyword, Group},
 		{"import", Keyword, Import},
 		{"map", Keyword, Map},
 		{"message", Keyword, Message},
 		{"oneof", Keyword, Oneof},
 		{"option", Keyword, Option},
+		{"optional", Keyword, Optional},
 		{"package", Keyword, Package},
 		{"public", Keyword, Public},
 		{"repeated", Keyword, Repeated},
+		{"required", Keyword, Required},
 		{"reserved", Keyword, Reserved},
 		{"returns", Keyword, Returns},
 		{"rpc", Keyword, RPC},
@@ -62,6 +68,7 @@ func TestConstructors(t *testing.T) {
 		{"-", Punctuation, Minus},
 		{"+", Punctuation, Plus},
 		{",", Punctuation, Comma},
+		{":", Punctuation, Colon},
 		{";", Punctuation, Semicolon},
 		{"(", Punctuation, OpenParen},
 		{")", Punctuation, CloseParen},
@@ -71,6 +78,7 @@ func TestConstructors(t *testing.T) {
 		{"]", Punctuation, CloseBracket},
 		{"<", Punctuation, OpenAngled},
 		{">", Punctuation, CloseAngled},
+		{"/", Punctuation, Slash},
 	}
 	for _, tt := range tests {
 		if tt.f(tt.text) != tt.kind {
@@ -120,15 +128,21 @@ func TestIsKeyword(t *testing.T) {
 		{StringLiteral, only(isConstant)},
 		{False, only(isKeyword, isConstant)},
 		{True, only(isKeyword, isConstant)},
+		{Edition, only(isKeyword)},
 		{Enum, only(isKeyword)},
+		{Extend, only(isKeyword)},
+		{Extensions, only(isKeyword)},
+		{Group, only(isKeyword)},
 		{Import, only(isKeyword)},
 		{Map, only(isKeyword)},
 		{Message, only(isKeyword)},
 		{Oneof, only(isKeyword)},
 		{Option, only(isKeyword)},
+		{Optional, only(isKeyword)},
 		{Package, only(isKeyword)},
 		{Public, only(isKeyword)},
 		{Repeated, only(isKeyword)},
+		{Required, only(isKeyword)},
 		{Reserved, only(isKeyword)},
 		{Returns, only(isKeyword)},
 		{RPC, only(isKeyword)},
@@ -157,6 +171,7 @@ func TestIsKeyword(t *testing.T) {
 		{Minus, only()},
 		{Plus, only()},
 		{Comma, only()},
+		{Colon, only()},
 		{Semicolon, only()},
 		{OpenParen, only()},
 		{CloseParen, only()},
@@ -166,6 +181,7 @@ func TestIsKeyword(t *testing.T) {
 		{CloseBracket, only()},
 		{OpenAngled, only()},
 		{CloseAngled, only()},
+		{Slash, only()},
 	}
 
 	for _, tt := range tests {
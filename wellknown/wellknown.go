@@ -0,0 +1,43 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wellknown provides the sources of the .proto files distributed
+// with protoc, such as google/protobuf/timestamp.proto, so they can be
+// imported without a protoc installation.
+package wellknown
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed google/protobuf/*.proto google/protobuf/compiler/*.proto
+var files embed.FS
+
+// FS contains the well-known files, under the paths used to import them.
+var FS fs.FS = files
+
+// Names returns the paths used to import the well-known files, sorted.
+func Names() []string {
+	var names []string
+	err := fs.WalkDir(files, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, path)
+		}
+		return err
+	})
+	if err != nil {
+		panic(err)
+	}
+	return names
+}
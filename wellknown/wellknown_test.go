@@ -0,0 +1,70 @@
+// Copyright 2016 Google Inc. All rights reserved.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to writing, software distributed
+// under the License is distributed on a "AS IS" BASIS, WITHOUT WARRANTIES OR
+// CONDITIONS OF ANY KIND, either express or implied.
+//
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wellknown
+
+import (
+	"bytes"
+	"io/fs"
+	"sort"
+	"testing"
+
+	"github.com/campoy/groto/linker"
+	"github.com/campoy/groto/parser"
+	"github.com/campoy/groto/proto"
+)
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("names are not sorted: %v", names)
+	}
+	has := map[string]bool{}
+	for _, name := range names {
+		has[name] = true
+	}
+	for _, name := range []string{
+		"google/protobuf/any.proto",
+		"google/protobuf/descriptor.proto",
+		"google/protobuf/duration.proto",
+		"google/protobuf/empty.proto",
+		"google/protobuf/field_mask.proto",
+		"google/protobuf/struct.proto",
+		"google/protobuf/timestamp.proto",
+		"google/protobuf/wrappers.proto",
+		"google/protobuf/compiler/plugin.proto",
+	} {
+		if !has[name] {
+			t.Errorf("missing %s", name)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	files := map[string]*proto.File{}
+	for _, name := range Names() {
+		src, err := fs.ReadFile(FS, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parser.ParseFile(name, bytes.NewReader(src), 0)
+		if err != nil {
+			t.Errorf("could not parse %s: %v", name, err)
+			continue
+		}
+		files[name] = f
+	}
+	if err := linker.Link(files); err != nil {
+		t.Errorf("could not link: %v", err)
+	}
+}